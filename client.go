@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -57,7 +59,12 @@ func (c Client) newRequest(ctx context.Context, method string, uri string, body
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequestWithContext(ctx, method, uri, bytes.NewBuffer(bodyJson))
+
+	return c.newRawRequest(ctx, method, uri, bytes.NewBuffer(bodyJson))
+}
+
+func (c Client) newRawRequest(ctx context.Context, method string, uri string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +82,64 @@ func (c Client) Request(ctx context.Context, method string, path string, req, re
 		return nil, err
 	}
 
+	return c.do(httpReq, resp)
+}
+
+// Sends a request with the body read from the reader as is.
+// Used for large bodies which should not be kept in memory.
+// Options are set as request headers, e.g. Content-Type of a multipart body
+func (c Client) RequestReader(ctx context.Context, method string, path string, body io.Reader, resp interface{}, options map[string]string) (*Response, error) {
+	uri, err := url.JoinPath(c.baseUrl, path)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := c.newRawRequest(ctx, method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range options {
+		httpReq.Header.Set(k, v)
+	}
+
+	return c.do(httpReq, resp)
+}
+
+// Downloads a file by an absolute URL or a path relative to the base URL.
+// Options are sent as headers only to the host of the base URL,
+// so credentials don't leak to other hosts
+func (c Client) Download(ctx context.Context, fileUrl string) (io.ReadCloser, error) {
+	base, err := url.Parse(c.baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	target, err := base.Parse(fileUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if target.Host == base.Host {
+		for k, v := range c.Options {
+			httpReq.Header.Add(k, v)
+		}
+	}
+
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		httpResp.Body.Close()
+		return nil, fmt.Errorf("download %s: unexpected status: %d", fileUrl, httpResp.StatusCode)
+	}
+	return httpResp.Body, nil
+}
+
+func (c Client) do(httpReq *http.Request, resp interface{}) (*Response, error) {
 	httpResp, err := c.client.Do(httpReq)
 	if err != nil {
 		return nil, err
@@ -2,7 +2,9 @@ package core
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -74,3 +76,76 @@ func TestRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestRequestReader(t *testing.T) {
+	body := `{"first_field": "test", "second_field": 123}`
+
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		if string(content) != body {
+			t.Errorf("wrong body: got: %s, expected: %s", content, body)
+		}
+		if r.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("options must be set as headers, got: %v", r.Header)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"first_header": "first-value"}`))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	respStruct := &TestRequestResponse{}
+	resp, err := c.RequestReader(ctx, http.MethodPost, "/", strings.NewReader(body), respStruct, map[string]string{
+		"Content-Type": "text/plain",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK || respStruct.FirstField != "first-value" {
+		t.Errorf("wrong response: %d %+v", resp.StatusCode, respStruct)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	c := NewClient(NewMockHttpClient(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "https://api.example.com/file":
+			if r.Header.Get("Api-Key") != "key" {
+				t.Errorf("credentials must be sent to the API host, got: %v", r.Header)
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("content"))
+		case "https://files.example.com/file":
+			if r.Header.Get("Api-Key") != "" {
+				t.Errorf("credentials must not be sent to other hosts")
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("content"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}), "https://api.example.com", map[string]string{"Api-Key": "key"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	for _, fileUrl := range []string{"/file", "https://api.example.com/file", "https://files.example.com/file"} {
+		body, err := c.Download(ctx, fileUrl)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		content, _ := io.ReadAll(body)
+		body.Close()
+		if string(content) != "content" {
+			t.Errorf("wrong content of %s: %s", fileUrl, content)
+		}
+	}
+
+	if _, err := c.Download(ctx, "/missing"); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
@@ -0,0 +1,152 @@
+// Sends simulated Ozon push notifications to a notification endpoint.
+//
+// Usage:
+//
+//	ozon-notify-sim -url http://localhost:5000/ [flags]
+//
+// Without -type, -scenario or -replay every message type is sent, including TYPE_PING.
+// Fields are overridden with -set, nested fields are separated by dots:
+//
+//	ozon-notify-sim -type TYPE_STATE_CHANGED -set posting_number=1-2-3 -set new_state=posting_delivered
+//
+// Scenario files are JSON:
+//
+//	{
+//		"set": {"posting_number": "1-2-3"},
+//		"steps": [
+//			{"type": "TYPE_NEW_POSTING"},
+//			{"type": "TYPE_STATE_CHANGED", "set": {"new_state": "posting_awaiting_deliver"}, "delay": "1s"},
+//			{"type": "TYPE_POSTING_CANCELLED"}
+//		]
+//	}
+//
+// Captured payloads are replayed from a file with one JSON object per line.
+// Queue and dead letter files of notifications.DurableQueue can be replayed as is
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/diphantxm/ozon-api-client/ozon/notifications"
+)
+
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+	var (
+		url          = flag.String("url", "http://localhost:5000/", "notification endpoint")
+		types        listFlag
+		sets         listFlag
+		headers      listFlag
+		scenarioPath = flag.String("scenario", "", "scenario file")
+		replayPath   = flag.String("replay", "", "file with captured payloads")
+		timeout      = flag.Duration("timeout", 10*time.Second, "request timeout")
+		list         = flag.Bool("list", false, "print supported message types")
+	)
+	flag.Var(&types, "type", "message type to send, can be repeated")
+	flag.Var(&sets, "set", "field override key=value, can be repeated")
+	flag.Var(&headers, "header", "request header \"Name: value\", can be repeated")
+	flag.Parse()
+
+	if *list {
+		for _, mt := range sampleTypes() {
+			fmt.Println(mt)
+		}
+		return
+	}
+
+	if err := run(*url, types, sets, headers, *scenarioPath, *replayPath, *timeout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(url string, types, sets, headers []string, scenarioPath, replayPath string, timeout time.Duration) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	sim := &simulator{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		headers: http.Header{},
+		now:     time.Now,
+	}
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return fmt.Errorf("invalid header %q, expected \"Name: value\"", header)
+		}
+		sim.headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	overrides, err := parseOverrides(sets)
+	if err != nil {
+		return err
+	}
+
+	var results []sendResult
+	switch {
+	case scenarioPath != "":
+		sc, err := readScenario(scenarioPath)
+		if err != nil {
+			return err
+		}
+		for key, value := range overrides {
+			if sc.Set == nil {
+				sc.Set = map[string]interface{}{}
+			}
+			sc.Set[key] = value
+		}
+		results, err = sim.runScenario(ctx, sc)
+		if err != nil {
+			report(os.Stdout, results)
+			return err
+		}
+	case replayPath != "":
+		file, err := os.Open(replayPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		payloads, err := readCaptured(file)
+		if err != nil {
+			return err
+		}
+		results = sim.replay(ctx, payloads)
+	default:
+		messageTypes := sampleTypes()
+		if len(types) > 0 {
+			messageTypes = nil
+			for _, mt := range types {
+				messageTypes = append(messageTypes, notifications.MessageType(mt))
+			}
+		}
+		results, err = sim.sendTypes(ctx, messageTypes, overrides)
+		if err != nil {
+			report(os.Stdout, results)
+			return err
+		}
+	}
+
+	if !report(os.Stdout, results) {
+		return fmt.Errorf("some notifications were not accepted")
+	}
+	return nil
+}
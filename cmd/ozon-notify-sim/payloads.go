@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diphantxm/ozon-api-client/ozon/notifications"
+)
+
+// Realistic notifications of every type. Fields can be overridden
+func samples(now time.Time) map[notifications.MessageType]interface{} {
+	now = now.UTC().Truncate(time.Millisecond)
+	user := notifications.User{Id: "115568", Type: "Customer"}
+	message := notifications.NewMessage{
+		Common:    notifications.Common{MessageType: notifications.NewMessageType},
+		ChatId:    "b646d975-0c9c-4872-9f41-8b1e57181063",
+		ChatType:  "Buyer_Seller",
+		MessageId: "3000000000817031942",
+		CreatedAt: now,
+		User:      user,
+		Data:      []string{"Здравствуйте, когда будет доставка?"},
+		SellerId:  15,
+	}
+	update := notifications.UpdateMessage{NewMessage: message, UpdatedAt: now}
+	update.MessageType = notifications.UpdateMessageType
+	read := notifications.MessageRead{NewMessage: message, LastReadMessageId: message.MessageId}
+	read.MessageType = notifications.MessageReadType
+	read.User = notifications.User{Id: "1", Type: "Support"}
+
+	products := []notifications.Product{{SKU: 147451959, Quantity: 2}}
+
+	return map[notifications.MessageType]interface{}{
+		notifications.PingType: map[string]interface{}{
+			"message_type": notifications.PingType,
+			"time":         now,
+		},
+		notifications.NewPostingType: &notifications.NewPosting{
+			Common:        notifications.Common{MessageType: notifications.NewPostingType},
+			PostingNumber: "24219509-0020-1",
+			Products:      products,
+			InProccessAt:  now,
+			WarehouseId:   18850503335000,
+			SellerId:      15,
+		},
+		notifications.PostingCancelledType: &notifications.PostingCancelled{
+			Common:           notifications.Common{MessageType: notifications.PostingCancelledType},
+			PostingNumber:    "24219509-0020-1",
+			Products:         products,
+			OldState:         "posting_awaiting_packaging",
+			NewState:         "posting_canceled",
+			ChangedStateDate: now,
+			Reason:           notifications.Reason{Id: 352, Message: "Покупатель отменил заказ"},
+			WarehouseId:      18850503335000,
+			SellerId:         15,
+		},
+		notifications.StateChangedType: &notifications.StateChanged{
+			Common:           notifications.Common{MessageType: notifications.StateChangedType},
+			PostingNumber:    "24219509-0020-1",
+			NewState:         "posting_delivering",
+			ChangedStateDate: now,
+			WarehouseId:      18850503335000,
+			SellerId:         15,
+		},
+		notifications.CutoffDateChangedType: &notifications.CutoffDateChanged{
+			Common:        notifications.Common{MessageType: notifications.CutoffDateChangedType},
+			PostingNumber: "24219509-0020-1",
+			NewCutoffDate: now.Add(48 * time.Hour),
+			OldCutoffDate: now.Add(24 * time.Hour),
+			WarehouseId:   18850503335000,
+			SellerId:      15,
+		},
+		notifications.DeliveryDateChangedType: &notifications.DeliveryDateChanged{
+			Common:               notifications.Common{MessageType: notifications.DeliveryDateChangedType},
+			PostingNumber:        "24219509-0020-1",
+			NewDeliveryDateBegin: now.Add(72 * time.Hour),
+			NewDeliveryDateEnd:   now.Add(76 * time.Hour),
+			OldDeliveryDateBegin: now.Add(48 * time.Hour),
+			OldDeliveryDateEnd:   now.Add(52 * time.Hour),
+			WarehouseId:          18850503335000,
+			SellerId:             15,
+		},
+		notifications.MarkStatusChangedType: &notifications.MarkStatusChanged{
+			Common:        notifications.Common{MessageType: notifications.MarkStatusChangedType},
+			PostingNumber: "24219509-0020-1",
+			ProductId:     1234567,
+			ExemplarId:    987,
+			Mark:          "010460704301003721Bt6T1n",
+			MarkType:      "mandatory_mark",
+			CheckStatus:   "passed",
+			ChangedAt:     now,
+			SellerId:      15,
+		},
+		notifications.NewReturnType: &notifications.NewReturn{
+			Common:        notifications.Common{MessageType: notifications.NewReturnType},
+			ReturnId:      1234,
+			PostingNumber: "24219509-0020-1",
+			ReturnSchema:  "FBS",
+			Products:      products,
+			CreatedAt:     now,
+			WarehouseId:   18850503335000,
+			SellerId:      15,
+		},
+		notifications.ReturnStatusChangedType: &notifications.ReturnStatusChanged{
+			Common:        notifications.Common{MessageType: notifications.ReturnStatusChangedType},
+			ReturnId:      1234,
+			PostingNumber: "24219509-0020-1",
+			ReturnSchema:  "FBS",
+			OldStatus:     "waiting_for_seller",
+			NewStatus:     "returned_to_seller",
+			ChangedAt:     now,
+			SellerId:      15,
+		},
+		notifications.CreateOrUpdateType: &notifications.CreateOrUpdateItem{
+			Common:    notifications.Common{MessageType: notifications.CreateOrUpdateType},
+			OfferId:   "PH-1234",
+			ProductId: 1234567,
+			ChangedAt: now,
+			SellerId:  15,
+		},
+		notifications.CreateItemType: &notifications.CreateItem{
+			Common:    notifications.Common{MessageType: notifications.CreateItemType},
+			OfferId:   "PH-1234",
+			ProductId: 1234567,
+			ChangedAt: now,
+			SellerId:  15,
+		},
+		notifications.UpdateItemType: &notifications.UpdateItem{
+			Common:    notifications.Common{MessageType: notifications.UpdateItemType},
+			OfferId:   "PH-1234",
+			ProductId: 1234567,
+			ChangedAt: now,
+			SellerId:  15,
+		},
+		notifications.PriceIndexChangedType: &notifications.PriceIndexChanged{
+			Common:     notifications.Common{MessageType: notifications.PriceIndexChangedType},
+			UpdatedAt:  now,
+			SKU:        147451959,
+			ProductId:  1234567,
+			PriceIndex: 5678,
+			SellerId:   15,
+		},
+		notifications.ColorIndexChangedType: &notifications.ColorIndexChanged{
+			Common:     notifications.Common{MessageType: notifications.ColorIndexChangedType},
+			UpdatedAt:  now,
+			SKU:        147451959,
+			ProductId:  1234567,
+			ColorIndex: "GREEN",
+			SellerId:   15,
+		},
+		notifications.StocksChangedType: &notifications.StocksChanged{
+			Common: notifications.Common{MessageType: notifications.StocksChangedType},
+			Items: []notifications.Item{
+				{
+					UpdatedAt: now,
+					SKU:       147451959,
+					ProductId: 1234567,
+					Stocks: []notifications.Stock{
+						{WarehouseId: 18850503335000, Present: 20, Reserved: 2},
+					},
+				},
+			},
+			SellerId: 15,
+		},
+		notifications.NewMessageType:    &message,
+		notifications.UpdateMessageType: &update,
+		notifications.MessageReadType:   &read,
+		notifications.NewChatType: &notifications.NewChat{
+			Common:    notifications.Common{MessageType: notifications.NewChatType},
+			ChatId:    message.ChatId,
+			ChatType:  message.ChatType,
+			CreatedAt: now,
+			User:      user,
+			SellerId:  15,
+		},
+		notifications.ChatClosedType: &notifications.ChatClosed{
+			Common:   notifications.Common{MessageType: notifications.ChatClosedType},
+			ChatId:   message.ChatId,
+			ChatType: message.ChatType,
+			User:     user,
+			SellerId: 15,
+		},
+	}
+}
+
+// Returns supported message types in alphabetical order
+func sampleTypes() []notifications.MessageType {
+	types := []notifications.MessageType{}
+	for mt := range samples(time.Now()) {
+		types = append(types, mt)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	return types
+}
+
+// Builds the payload of the message type with overridden fields.
+// Keys are JSON field names, nested fields are separated by dots
+func buildPayload(mt notifications.MessageType, now time.Time, overrides map[string]interface{}) ([]byte, error) {
+	sample, ok := samples(now)[mt]
+	if !ok {
+		// Unknown types are sent with overridden fields only
+		sample = map[string]interface{}{"message_type": mt}
+	}
+
+	content, err := json.Marshal(sample)
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal(content, &payload); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := setField(payload, key, overrides[key]); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(payload)
+}
+
+// Sets the field by a path like "products.0.sku"
+func setField(payload map[string]interface{}, path string, value interface{}) error {
+	parts := strings.Split(path, ".")
+	var current interface{} = payload
+	for i, part := range parts {
+		last := i == len(parts)-1
+
+		switch node := current.(type) {
+		case map[string]interface{}:
+			if last {
+				node[part] = value
+				return nil
+			}
+			next, ok := node[part]
+			if !ok {
+				next = map[string]interface{}{}
+				node[part] = next
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(node) {
+				return fmt.Errorf("invalid index %q in %s", part, path)
+			}
+			if last {
+				node[index] = value
+				return nil
+			}
+			current = node[index]
+		default:
+			return fmt.Errorf("field %s is not an object", strings.Join(parts[:i], "."))
+		}
+	}
+	return nil
+}
+
+// Parses "key=value" overrides. Values are parsed as JSON
+// if possible, otherwise they are strings
+func parseOverrides(values []string) (map[string]interface{}, error) {
+	overrides := map[string]interface{}{}
+	for _, value := range values {
+		key, raw, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid override %q, expected key=value", value)
+		}
+
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+			parsed = raw
+		}
+		overrides[key] = parsed
+	}
+	return overrides, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/diphantxm/ozon-api-client/ozon/notifications"
+)
+
+// Sequence of notifications, e.g. new posting, state change and cancellation
+type scenario struct {
+	// Overrides applied to every step
+	Set map[string]interface{} `json:"set"`
+
+	Steps []scenarioStep `json:"steps"`
+}
+
+type scenarioStep struct {
+	// Message type
+	Type notifications.MessageType `json:"type"`
+
+	// Overrides of the step
+	Set map[string]interface{} `json:"set"`
+
+	// Delay before sending, e.g. "1s"
+	Delay string `json:"delay"`
+}
+
+func readScenario(path string) (*scenario, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scenario{}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, fmt.Errorf("parse scenario %s: %w", path, err)
+	}
+	for i, step := range s.Steps {
+		if step.Type == "" {
+			return nil, fmt.Errorf("step %d has no type", i+1)
+		}
+		if step.Delay != "" {
+			if _, err := time.ParseDuration(step.Delay); err != nil {
+				return nil, fmt.Errorf("step %d: %w", i+1, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// Reads captured payloads, one JSON object per line.
+// Entries of the durable queue and dead letter files are supported too
+func readCaptured(r io.Reader) ([][]byte, error) {
+	payloads := [][]byte{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		content := bytes.TrimSpace(scanner.Bytes())
+		if len(content) == 0 {
+			continue
+		}
+
+		entry := struct {
+			MessageType notifications.MessageType `json:"message_type"`
+			Payload     json.RawMessage           `json:"payload"`
+		}{}
+		if err := json.Unmarshal(content, &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(entry.Payload) > 0 {
+			content = entry.Payload
+		}
+		payloads = append(payloads, append([]byte{}, content...))
+	}
+	return payloads, scanner.Err()
+}
+
+// Response to a sent notification
+type sendResult struct {
+	MessageType notifications.MessageType
+
+	// HTTP status code. Zero if the request failed
+	StatusCode int
+
+	// Result field of the response, if present
+	Result *bool
+
+	// Request error or error message of the response
+	Error string
+}
+
+type simulator struct {
+	url     string
+	client  *http.Client
+	headers http.Header
+	now     func() time.Time
+}
+
+func (s *simulator) send(ctx context.Context, payload []byte) sendResult {
+	common := notifications.Common{}
+	json.Unmarshal(payload, &common)
+	result := sendResult{MessageType: common.MessageType}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range s.headers {
+		req.Header[key] = values
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+
+	body := struct {
+		Result *bool `json:"result"`
+		Error  struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	content, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(content, &body); err != nil {
+		result.Error = strings.TrimSpace(string(content))
+		return result
+	}
+	result.Result = body.Result
+	result.Error = body.Error.Message
+	return result
+}
+
+// Sends every type with the same overrides
+func (s *simulator) sendTypes(ctx context.Context, types []notifications.MessageType, overrides map[string]interface{}) ([]sendResult, error) {
+	results := []sendResult{}
+	for _, mt := range types {
+		payload, err := buildPayload(mt, s.now(), overrides)
+		if err != nil {
+			return results, fmt.Errorf("build %s: %w", mt, err)
+		}
+		results = append(results, s.send(ctx, payload))
+	}
+	return results, nil
+}
+
+func (s *simulator) runScenario(ctx context.Context, sc *scenario) ([]sendResult, error) {
+	results := []sendResult{}
+	for i, step := range sc.Steps {
+		if step.Delay != "" {
+			delay, _ := time.ParseDuration(step.Delay)
+			select {
+			case <-ctx.Done():
+				return results, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		overrides := map[string]interface{}{}
+		for key, value := range sc.Set {
+			overrides[key] = value
+		}
+		for key, value := range step.Set {
+			overrides[key] = value
+		}
+		payload, err := buildPayload(step.Type, s.now(), overrides)
+		if err != nil {
+			return results, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		results = append(results, s.send(ctx, payload))
+	}
+	return results, nil
+}
+
+func (s *simulator) replay(ctx context.Context, payloads [][]byte) []sendResult {
+	results := []sendResult{}
+	for _, payload := range payloads {
+		results = append(results, s.send(ctx, payload))
+	}
+	return results
+}
+
+// Prints results as a table. Returns false if any notification wasn't accepted
+func report(w io.Writer, results []sendResult) bool {
+	ok := true
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tSTATUS\tRESULT\tERROR")
+	for _, result := range results {
+		status, res := "-", "-"
+		if result.StatusCode != 0 {
+			status = fmt.Sprint(result.StatusCode)
+		}
+		if result.Result != nil {
+			res = fmt.Sprint(*result.Result)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.MessageType, status, res, result.Error)
+
+		if result.StatusCode != http.StatusOK || result.Error != "" {
+			ok = false
+		}
+	}
+	tw.Flush()
+	return ok
+}
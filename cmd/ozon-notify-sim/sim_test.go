@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diphantxm/ozon-api-client/ozon/notifications"
+)
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestSimulator(t *testing.T, server *notifications.NotificationServer) *simulator {
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	return &simulator{
+		url:     httpServer.URL,
+		client:  httpServer.Client(),
+		headers: http.Header{},
+		now:     func() time.Time { return testNow },
+	}
+}
+
+func TestSendAllTypes(t *testing.T) {
+	server := notifications.NewNotificationServer(0, notifications.WithAckUnhandled(false))
+
+	mu := sync.Mutex{}
+	received := map[notifications.MessageType]interface{}{}
+	handler := func(req interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received[req.(notifications.Notification).NotificationType()] = req
+		return nil
+	}
+	for _, mt := range sampleTypes() {
+		if mt != notifications.PingType {
+			server.Register(mt, handler)
+		}
+	}
+
+	sim := newTestSimulator(t, server)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	results, err := sim.sendTypes(ctx, sampleTypes(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if !report(out, results) {
+		t.Errorf("all notifications must be accepted:\n%s", out)
+	}
+
+	// Payloads are decoded by the server into the sample notifications
+	for mt, sample := range samples(testNow) {
+		if mt == notifications.PingType {
+			continue
+		}
+		if !reflect.DeepEqual(received[mt], sample) {
+			t.Errorf("wrong %s: got: %+v, expected: %+v", mt, received[mt], sample)
+		}
+	}
+}
+
+func TestBuildPayload(t *testing.T) {
+	overrides, err := parseOverrides([]string{
+		"posting_number=1-2-3",
+		"products.0.quantity=5",
+		"warehouse_id=42",
+		`seller_id="15"`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := buildPayload(notifications.NewPostingType, testNow, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posting := &notifications.NewPosting{}
+	if err := json.Unmarshal(payload, posting); err == nil {
+		t.Errorf("string seller id must not be decoded into number")
+	}
+	delete(overrides, "seller_id")
+	payload, _ = buildPayload(notifications.NewPostingType, testNow, overrides)
+	if err := json.Unmarshal(payload, posting); err != nil {
+		t.Fatal(err)
+	}
+	if posting.PostingNumber != "1-2-3" || posting.Products[0].Quantity != 5 || posting.WarehouseId != 42 || !posting.InProccessAt.Equal(testNow) {
+		t.Errorf("wrong posting: %+v", posting)
+	}
+
+	if _, err := buildPayload(notifications.NewPostingType, testNow, map[string]interface{}{"products.9.sku": 1}); err == nil {
+		t.Errorf("expected error for invalid index")
+	}
+	if _, err := parseOverrides([]string{"invalid"}); err == nil {
+		t.Errorf("expected error for invalid override")
+	}
+}
+
+func TestScenarioAndReplay(t *testing.T) {
+	server := notifications.NewNotificationServer(0)
+
+	events := []string{}
+	notifications.On(server, func(ctx context.Context, posting *notifications.NewPosting) error {
+		events = append(events, "new "+posting.PostingNumber)
+		return nil
+	})
+	notifications.On(server, func(ctx context.Context, state *notifications.StateChanged) error {
+		events = append(events, state.NewState+" "+state.PostingNumber)
+		return nil
+	})
+	notifications.On(server, func(ctx context.Context, cancelled *notifications.PostingCancelled) error {
+		events = append(events, "cancelled "+cancelled.PostingNumber)
+		return notifications.Retryable(context.DeadlineExceeded)
+	})
+
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	err := os.WriteFile(path, []byte(`{
+		"set": {"posting_number": "1-2-3"},
+		"steps": [
+			{"type": "TYPE_NEW_POSTING"},
+			{"type": "TYPE_STATE_CHANGED", "set": {"new_state": "posting_awaiting_deliver"}, "delay": "1ms"},
+			{"type": "TYPE_POSTING_CANCELLED"}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := readScenario(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sim := newTestSimulator(t, server)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	results, err := sim.runScenario(ctx, sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"new 1-2-3", "posting_awaiting_deliver 1-2-3", "cancelled 1-2-3"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("wrong events: %v", events)
+	}
+	if len(results) != 3 || results[0].Result == nil || !*results[0].Result ||
+		results[2].StatusCode != http.StatusGatewayTimeout || results[2].Error == "" {
+		t.Errorf("wrong results: %+v", results)
+	}
+
+	out := &bytes.Buffer{}
+	if report(out, results) {
+		t.Errorf("failed notification must be reported")
+	}
+	if !strings.Contains(out.String(), "TYPE_POSTING_CANCELLED  504") {
+		t.Errorf("wrong report:\n%s", out)
+	}
+
+	// Raw payload and dead letter entry
+	events = nil
+	payloads, err := readCaptured(strings.NewReader(`{"message_type": "TYPE_NEW_POSTING", "posting_number": "4-5-6"}
+
+{"id": 3, "message_type": "TYPE_STATE_CHANGED", "payload": {"message_type": "TYPE_STATE_CHANGED", "posting_number": "4-5-6", "new_state": "posting_delivered"}, "attempts": 5}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = sim.replay(ctx, payloads)
+	if !report(&bytes.Buffer{}, results) || !reflect.DeepEqual(events, []string{"new 4-5-6", "posting_delivered 4-5-6"}) {
+		t.Errorf("wrong replay: %v %+v", events, results)
+	}
+}
@@ -249,6 +249,15 @@ type ProductTurnoverItem struct {
 
 	// Product stock level
 	IDCGrade string `json:"idc_grade"`
+
+	// Product name
+	Name string `json:"name"`
+
+	// Product identifier in the seller's system
+	OfferId string `json:"offer_id"`
+
+	// Product identifier in the Ozon system, SKU
+	SKU int64 `json:"sku"`
 }
 
 // Use the method to get the product turnover rate and the number of days the current stock will last.
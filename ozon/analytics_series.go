@@ -0,0 +1,254 @@
+package ozon
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	core "github.com/diphantxm/ozon-api-client"
+)
+
+const (
+	// Maximum number of metrics in one analytics request
+	analyticsMaxMetrics = 14
+
+	// Maximum number of rows in one analytics response
+	analyticsMaxLimit = 1000
+
+	// Default length of a date range in one analytics request
+	analyticsDefaultChunkDays = 30
+)
+
+type AnalyticsSeriesQuery struct {
+	// Date from which the data will be in the series
+	DateFrom time.Time
+
+	// Date up to which the data will be in the series, inclusive
+	DateTo time.Time
+
+	// Data grouping. Rows of the series are keyed by these dimensions
+	Dimension []GetAnalyticsDataDimension
+
+	// Metrics to get. If there are more than 14 metrics,
+	// they are requested in several groups and merged
+	Metrics []GetAnalyticsDataFilterMetric
+
+	// Filters
+	Filters []GetAnalyticsDataFilter
+
+	// Number of days in one request.
+	//
+	// Default is 30
+	ChunkDays int
+
+	// Number of rows in one request. Maximum is 1000.
+	//
+	// Default is 1000
+	Limit int64
+}
+
+// Analytics data as a table.
+// Each row has a value for every dimension and metric of the query
+type AnalyticsSeries struct {
+	// Dimensions in the order of row dimension values
+	Dimensions []GetAnalyticsDataDimension `json:"dimensions"`
+
+	// Metrics in the order of row metric values
+	Metrics []GetAnalyticsDataFilterMetric `json:"metrics"`
+
+	// Rows sorted by dimension values
+	Rows []AnalyticsSeriesRow `json:"rows"`
+}
+
+type AnalyticsSeriesRow struct {
+	// Dimension values
+	Dimensions []GetAnalyticsDataResultDimension `json:"dimensions"`
+
+	// Metric values
+	Metrics []float64 `json:"metrics"`
+}
+
+// Gets analytics data for any date range and number of metrics.
+//
+// The date range is split into chunks, metrics are split into groups of 14
+// and each request is paged with `offset`. Rows with equal dimension values
+// are merged into one row: metrics from different groups fill their columns,
+// values from different chunks are summed up. Add a time dimension, such as `day`,
+// to the query if metrics are not additive
+func (c Analytics) Series(ctx context.Context, query *AnalyticsSeriesQuery) (*AnalyticsSeries, error) {
+	if query.DateTo.Before(query.DateFrom) {
+		return nil, fmt.Errorf("date to %s is before date from %s", query.DateTo, query.DateFrom)
+	}
+	if len(query.Dimension) == 0 {
+		return nil, fmt.Errorf("at least one dimension is required")
+	}
+	if len(query.Metrics) == 0 {
+		return nil, fmt.Errorf("at least one metric is required")
+	}
+
+	chunkDays := query.ChunkDays
+	if chunkDays <= 0 {
+		chunkDays = analyticsDefaultChunkDays
+	}
+	limit := query.Limit
+	if limit <= 0 || limit > analyticsMaxLimit {
+		limit = analyticsMaxLimit
+	}
+
+	series := &AnalyticsSeries{
+		Dimensions: query.Dimension,
+		Metrics:    query.Metrics,
+	}
+	rows := map[string]*AnalyticsSeriesRow{}
+
+	for from := query.DateFrom; !from.After(query.DateTo); from = from.AddDate(0, 0, chunkDays) {
+		to := from.AddDate(0, 0, chunkDays-1)
+		if to.After(query.DateTo) {
+			to = query.DateTo
+		}
+
+		for first := 0; first < len(query.Metrics); first += analyticsMaxMetrics {
+			last := first + analyticsMaxMetrics
+			if last > len(query.Metrics) {
+				last = len(query.Metrics)
+			}
+
+			params := &GetAnalyticsDataParams{
+				DateFrom:  core.NewTimeFormat(from, core.ShortDateLayout),
+				DateTo:    core.NewTimeFormat(to, core.ShortDateLayout),
+				Dimension: query.Dimension,
+				Filters:   query.Filters,
+				Limit:     limit,
+				Metrics:   query.Metrics[first:last],
+			}
+			if err := c.fetchSeriesPages(ctx, params, first, len(query.Metrics), rows); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	series.Rows = make([]AnalyticsSeriesRow, 0, len(keys))
+	for _, key := range keys {
+		series.Rows = append(series.Rows, *rows[key])
+	}
+
+	return series, nil
+}
+
+// Requests all pages and merges metrics into rows starting from the column
+func (c Analytics) fetchSeriesPages(ctx context.Context, params *GetAnalyticsDataParams, column, columns int, rows map[string]*AnalyticsSeriesRow) error {
+	for {
+		resp, err := c.GetAnalyticsData(ctx, params)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("get analytics data: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		for _, data := range resp.Result.Data {
+			key := seriesRowKey(data.Dimensions)
+
+			row, ok := rows[key]
+			if !ok {
+				row = &AnalyticsSeriesRow{
+					Dimensions: data.Dimensions,
+					Metrics:    make([]float64, columns),
+				}
+				rows[key] = row
+			}
+
+			for i, value := range data.Metrics {
+				if column+i >= columns {
+					break
+				}
+				row.Metrics[column+i] += value
+			}
+		}
+
+		if int64(len(resp.Result.Data)) < params.Limit {
+			return nil
+		}
+		params.Offset += params.Limit
+	}
+}
+
+func seriesRowKey(dimensions []GetAnalyticsDataResultDimension) string {
+	ids := make([]string, 0, len(dimensions))
+	for _, dimension := range dimensions {
+		ids = append(ids, dimension.Id)
+	}
+	return strings.Join(ids, "\x00")
+}
+
+// Writes the series as CSV with a header.
+// There are two columns for each dimension: identifier and name
+func (s *AnalyticsSeries) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := make([]string, 0, 2*len(s.Dimensions)+len(s.Metrics))
+	for _, dimension := range s.Dimensions {
+		header = append(header, string(dimension), string(dimension)+"_name")
+	}
+	for _, metric := range s.Metrics {
+		header = append(header, string(metric))
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range s.Rows {
+		record := make([]string, 0, len(header))
+		for _, dimension := range row.Dimensions {
+			record = append(record, dimension.Id, dimension.Name)
+		}
+		for _, value := range row.Metrics {
+			record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Writes the series as JSON Lines, one object per row.
+// Dimension values are written by dimension name, names are written with `_name` suffix
+func (s *AnalyticsSeries) WriteJSONL(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+
+	for _, row := range s.Rows {
+		record := make(map[string]interface{}, 2*len(s.Dimensions)+len(s.Metrics))
+		for i, dimension := range s.Dimensions {
+			if i >= len(row.Dimensions) {
+				break
+			}
+			record[string(dimension)] = row.Dimensions[i].Id
+			record[string(dimension)+"_name"] = row.Dimensions[i].Name
+		}
+		for i, metric := range s.Metrics {
+			record[string(metric)] = row.Metrics[i]
+		}
+
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
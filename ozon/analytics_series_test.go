@@ -0,0 +1,154 @@
+package ozon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAnalyticsSeries(t *testing.T) {
+	t.Parallel()
+
+	type request struct {
+		DateFrom string   `json:"date_from"`
+		DateTo   string   `json:"date_to"`
+		Limit    int64    `json:"limit"`
+		Offset   int64    `json:"offset"`
+		Metrics  []string `json:"metrics"`
+	}
+
+	var mu sync.Mutex
+	requests := []request{}
+
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		req := request{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+
+		// The first page of each chunk is full, the second one has a single row
+		rows := []string{}
+		if req.Offset == 0 {
+			rows = append(rows,
+				fmt.Sprintf(`{"dimensions": [{"id": "2", "name": "second"}], "metrics": [%s]}`, metricValues(len(req.Metrics), 1)),
+				fmt.Sprintf(`{"dimensions": [{"id": "1", "name": "first"}], "metrics": [%s]}`, metricValues(len(req.Metrics), 1)),
+			)
+		} else {
+			rows = append(rows,
+				fmt.Sprintf(`{"dimensions": [{"id": "3", "name": "third"}], "metrics": [%s]}`, metricValues(len(req.Metrics), 2)),
+			)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprintf(`{"result": {"data": [%s], "totals": []}}`, strings.Join(rows, ","))))
+	})
+
+	metrics := make([]GetAnalyticsDataFilterMetric, 0, 15)
+	for i := 0; i < 15; i++ {
+		metrics = append(metrics, GetAnalyticsDataFilterMetric(fmt.Sprintf("metric%d", i)))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	series, err := c.Analytics().Series(ctx, &AnalyticsSeriesQuery{
+		DateFrom:  time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		DateTo:    time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC),
+		Dimension: []GetAnalyticsDataDimension{SKUDimension},
+		Metrics:   metrics,
+		ChunkDays: 7,
+		Limit:     2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 chunks * 2 metric groups * 2 pages
+	if len(requests) != 8 {
+		t.Fatalf("expected 8 requests, got: %d", len(requests))
+	}
+	if requests[0].DateFrom != "2023-01-01" || requests[0].DateTo != "2023-01-07" {
+		t.Errorf("wrong first chunk: %s - %s", requests[0].DateFrom, requests[0].DateTo)
+	}
+	if requests[7].DateFrom != "2023-01-08" || requests[7].DateTo != "2023-01-10" {
+		t.Errorf("wrong last chunk: %s - %s", requests[7].DateFrom, requests[7].DateTo)
+	}
+	if len(requests[0].Metrics) != 14 || len(requests[2].Metrics) != 1 {
+		t.Errorf("metrics must be split into groups of 14, got: %d and %d", len(requests[0].Metrics), len(requests[2].Metrics))
+	}
+	if requests[1].Offset != 2 {
+		t.Errorf("expected offset 2 for the second page, got: %d", requests[1].Offset)
+	}
+
+	if len(series.Rows) != 3 {
+		t.Fatalf("expected 3 rows, got: %d", len(series.Rows))
+	}
+	if series.Rows[0].Dimensions[0].Id != "1" {
+		t.Errorf("rows must be sorted by dimensions, got: %s", series.Rows[0].Dimensions[0].Id)
+	}
+	for _, row := range series.Rows {
+		if len(row.Metrics) != 15 {
+			t.Errorf("expected 15 metrics, got: %d", len(row.Metrics))
+		}
+	}
+	// Each chunk adds 1 to the value
+	if series.Rows[0].Metrics[0] != 2 || series.Rows[0].Metrics[14] != 2 {
+		t.Errorf("metrics must be summed up across chunks, got: %v", series.Rows[0].Metrics)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := series.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Errorf("expected header and 3 rows in csv, got: %d lines", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "sku,sku_name,metric0") || !strings.HasPrefix(lines[1], "1,first,2") {
+		t.Errorf("wrong csv: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := series.WriteJSONL(buf); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines in jsonl, got: %d", len(lines))
+	}
+	record := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(lines[2]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["sku"] != "3" || record["sku_name"] != "third" || record["metric14"] != float64(4) {
+		t.Errorf("wrong jsonl record: %v", record)
+	}
+
+	if _, err := c.Analytics().Series(ctx, &AnalyticsSeriesQuery{
+		DateFrom:  time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC),
+		DateTo:    time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		Dimension: []GetAnalyticsDataDimension{SKUDimension},
+		Metrics:   metrics,
+	}); err == nil {
+		t.Errorf("expected error for invalid date range")
+	}
+}
+
+func metricValues(n int, value int) string {
+	values := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		values = append(values, fmt.Sprint(value))
+	}
+	return strings.Join(values, ",")
+}
@@ -169,7 +169,10 @@ func TestGetProductTurnover(t *testing.T) {
 					"ads": 0,
 					"current_stock": 0,
 					"idc": 0,
-					"idc_grade": "GRADES_NONE"
+					"idc_grade": "GRADES_NONE",
+					"name": "string",
+					"offer_id": "string",
+					"sku": 0
 				  }
 				]
 			}`,
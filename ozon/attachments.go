@@ -0,0 +1,462 @@
+package ozon
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	core "github.com/diphantxm/ozon-api-client"
+)
+
+// Number of bytes used to detect MIME type of a file
+const attachmentSniffLen = 512
+
+// Size and type restrictions Ozon applies to uploaded files
+type AttachmentLimits struct {
+	// Maximum file size in bytes. Size is not limited if 0
+	MaxSize int64
+
+	// Allowed MIME types. Any type is allowed if empty
+	MIMETypes []string
+}
+
+var (
+	// Restrictions for files sent to chats
+	ChatFileLimits = AttachmentLimits{
+		MaxSize:   10 << 20,
+		MIMETypes: []string{"image/jpeg", "image/png", "application/pdf"},
+	}
+
+	// Restrictions for invoices. Available file types: JPEG and PDF. Maximum file size: 10 MB
+	InvoiceFileLimits = AttachmentLimits{
+		MaxSize:   10 << 20,
+		MIMETypes: []string{"image/jpeg", "application/pdf"},
+	}
+
+	// Restrictions for certificate files. Valid extensions are jpg, jpeg, png, pdf
+	CertificateFileLimits = AttachmentLimits{
+		MIMETypes: []string{"image/jpeg", "image/png", "application/pdf"},
+	}
+)
+
+func (l AttachmentLimits) allowsType(mimeType string) bool {
+	if len(l.MIMETypes) == 0 {
+		return true
+	}
+	for _, allowed := range l.MIMETypes {
+		if allowed == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+// Reason why a file would be rejected
+type AttachmentErrorReason string
+
+const (
+	// File is larger than allowed
+	AttachmentTooLarge AttachmentErrorReason = "too_large"
+
+	// File type is not allowed
+	AttachmentTypeNotAllowed AttachmentErrorReason = "type_not_allowed"
+
+	// File is empty
+	AttachmentEmpty AttachmentErrorReason = "empty"
+)
+
+// Returned when a file doesn't satisfy Ozon restrictions
+// and would be rejected on upload
+type AttachmentError struct {
+	// File name
+	Name string
+
+	// Detected MIME type
+	MIMEType string
+
+	// File size in bytes. If the file is too large and its size
+	// is unknown in advance, number of bytes read before the limit was exceeded
+	Size int64
+
+	Reason AttachmentErrorReason
+
+	// Restrictions the file was checked against
+	Limits AttachmentLimits
+}
+
+func (e *AttachmentError) Error() string {
+	switch e.Reason {
+	case AttachmentTooLarge:
+		return fmt.Sprintf("attachment %s is too large: %d bytes, maximum is %d", e.Name, e.Size, e.Limits.MaxSize)
+	case AttachmentTypeNotAllowed:
+		return fmt.Sprintf("attachment %s has type %s, allowed types: %s", e.Name, e.MIMEType, strings.Join(e.Limits.MIMETypes, ", "))
+	case AttachmentEmpty:
+		return fmt.Sprintf("attachment %s is empty", e.Name)
+	}
+	return fmt.Sprintf("attachment %s is rejected: %s", e.Name, e.Reason)
+}
+
+// File to be uploaded to Ozon. Content is read and encoded
+// to base64 while the request is being sent
+type Attachment struct {
+	// File name with extension
+	Name string
+
+	// Detected MIME type
+	MIMEType string
+
+	// File size in bytes, -1 if unknown
+	Size int64
+
+	reader *bufio.Reader
+	closer io.Closer
+}
+
+// Creates an attachment from a reader. MIME type is detected by the content
+// and then by the name. If the name has no extension, it's added
+// according to the detected type.
+//
+// Size is known in advance for files, `bytes.Reader`, `strings.Reader`
+// and `bytes.Buffer`. Otherwise it's checked while the content is uploaded
+func NewAttachment(name string, r io.Reader) (*Attachment, error) {
+	// Size must be taken before the content is read
+	size := int64(-1)
+	switch v := r.(type) {
+	case interface{ Stat() (fs.FileInfo, error) }:
+		if info, err := v.Stat(); err == nil && info.Mode().IsRegular() {
+			size = info.Size()
+		}
+	case interface{ Len() int }:
+		size = int64(v.Len())
+	}
+
+	reader := bufio.NewReaderSize(r, attachmentSniffLen)
+	head, err := reader.Peek(attachmentSniffLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	a := &Attachment{
+		Name:     name,
+		MIMEType: detectMIMEType(name, head),
+		Size:     size,
+		reader:   reader,
+	}
+	if a.Size < 0 && len(head) < attachmentSniffLen {
+		a.Size = int64(len(head))
+	}
+
+	if filepath.Ext(a.Name) == "" {
+		a.Name += attachmentExtension(a.MIMEType)
+	}
+
+	return a, nil
+}
+
+// Opens a file to be uploaded. Attachment must be closed after uploading
+func OpenAttachment(path string) (*Attachment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := NewAttachment(filepath.Base(path), file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	a.closer = file
+
+	return a, nil
+}
+
+// Closes the underlying file if the attachment was opened by path
+func (a *Attachment) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// Checks the attachment against the restrictions. Returns `*AttachmentError`
+// if the attachment would be rejected. If size is unknown, only type is checked
+func (a *Attachment) Check(limits AttachmentLimits) error {
+	if !limits.allowsType(a.MIMEType) {
+		return a.error(AttachmentTypeNotAllowed, a.Size, limits)
+	}
+	if a.Size == 0 {
+		return a.error(AttachmentEmpty, 0, limits)
+	}
+	if limits.MaxSize > 0 && a.Size > limits.MaxSize {
+		return a.error(AttachmentTooLarge, a.Size, limits)
+	}
+	return nil
+}
+
+func (a *Attachment) error(reason AttachmentErrorReason, size int64, limits AttachmentLimits) *AttachmentError {
+	return &AttachmentError{
+		Name:     a.Name,
+		MIMEType: a.MIMEType,
+		Size:     size,
+		Reason:   reason,
+		Limits:   limits,
+	}
+}
+
+type attachmentField struct {
+	key   string
+	value string
+}
+
+// Writes JSON object with base64 encoded content under contentKey
+// and other string fields. Content is never kept in memory as a whole
+func (a *Attachment) writeJSON(w io.Writer, limits AttachmentLimits, contentKey string, fields []attachmentField) error {
+	key, _ := json.Marshal(contentKey)
+	if _, err := fmt.Fprintf(w, `{%s:"`, key); err != nil {
+		return err
+	}
+
+	encoder := base64.NewEncoder(base64.StdEncoding, w)
+	size, err := io.Copy(encoder, a.limitedReader(limits))
+	if err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	if size == 0 {
+		return a.error(AttachmentEmpty, 0, limits)
+	}
+
+	if _, err := io.WriteString(w, `"`); err != nil {
+		return err
+	}
+	for _, field := range fields {
+		key, _ := json.Marshal(field.key)
+		value, _ := json.Marshal(field.value)
+		if _, err := fmt.Fprintf(w, `,%s:%s`, key, value); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, `}`)
+	return err
+}
+
+func (a *Attachment) limitedReader(limits AttachmentLimits) io.Reader {
+	if limits.MaxSize <= 0 {
+		return a.reader
+	}
+	return &attachmentLimitReader{attachment: a, limits: limits}
+}
+
+type attachmentLimitReader struct {
+	attachment *Attachment
+	limits     AttachmentLimits
+	read       int64
+}
+
+func (r *attachmentLimitReader) Read(p []byte) (int, error) {
+	n, err := r.attachment.reader.Read(p)
+	r.read += int64(n)
+	if r.read > r.limits.MaxSize {
+		return n, r.attachment.error(AttachmentTooLarge, r.read, r.limits)
+	}
+	return n, err
+}
+
+// Checks the attachment and sends it as a JSON body with base64 encoded content.
+// The body is encoded while it's being sent
+func uploadAttachment(ctx context.Context, client *core.Client, url string, file *Attachment, limits AttachmentLimits, contentKey string, fields []attachmentField, resp interface{}) (*core.Response, error) {
+	if err := file.Check(limits); err != nil {
+		return nil, err
+	}
+
+	body, writer := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := file.writeJSON(writer, limits, contentKey, fields)
+		writer.CloseWithError(err)
+		done <- err
+	}()
+
+	response, err := client.RequestReader(ctx, http.MethodPost, url, body, resp, nil)
+
+	// Unblock the writer if the body wasn't read completely
+	body.Close()
+	if writeErr := <-done; writeErr != nil && writeErr != io.ErrClosedPipe {
+		return nil, writeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Sends a file to an existing chat by its identifier.
+// Unlike SendFile, content is encoded to base64 while it's being sent
+func (c Chats) SendAttachment(ctx context.Context, chatId string, file *Attachment) (*SendFileResponse, error) {
+	url := "/v1/chat/send/file"
+
+	resp := &SendFileResponse{}
+
+	response, err := uploadAttachment(ctx, c.client, url, file, ChatFileLimits, "base64_content", []attachmentField{
+		{key: "chat_id", value: chatId},
+		{key: "name", value: file.Name},
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	response.CopyCommonResponse(&resp.CommonResponse)
+
+	return resp, nil
+}
+
+// Uploads an invoice for the shipment.
+// Unlike Upload, content is encoded to base64 while it's being sent
+func (c Invoices) UploadAttachment(ctx context.Context, postingNumber string, file *Attachment) (*UploadInvoiceResponse, error) {
+	url := "/v1/invoice/file/upload"
+
+	resp := &UploadInvoiceResponse{}
+
+	response, err := uploadAttachment(ctx, c.client, url, file, InvoiceFileLimits, "base64_content", []attachmentField{
+		{key: "posting_number", value: postingNumber},
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	response.CopyCommonResponse(&resp.CommonResponse)
+
+	return resp, nil
+}
+
+// Adds a certificate with files for products.
+// Unlike AddForProducts, files are sent as multipart form while they're being read
+func (c Certificates) AddFilesForProducts(ctx context.Context, params *AddCertificatesForProductsParams, files ...*Attachment) (*AddCertificatesForProductsResponse, error) {
+	url := "/v1/product/certificate/create"
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no certificate files")
+	}
+	for _, file := range files {
+		if err := file.Check(CertificateFileLimits); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &AddCertificatesForProductsResponse{}
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	done := make(chan error, 1)
+	go func() {
+		err := writeCertificateForm(form, params, files)
+		writer.CloseWithError(err)
+		done <- err
+	}()
+
+	response, err := c.client.RequestReader(ctx, http.MethodPost, url, body, resp, map[string]string{
+		"Content-Type": form.FormDataContentType(),
+	})
+
+	// Unblock the writer if the body wasn't read completely
+	body.Close()
+	if writeErr := <-done; writeErr != nil && writeErr != io.ErrClosedPipe {
+		return nil, writeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	response.CopyCommonResponse(&resp.CommonResponse)
+
+	return resp, nil
+}
+
+func writeCertificateForm(form *multipart.Writer, params *AddCertificatesForProductsParams, files []*Attachment) error {
+	fields := []attachmentField{
+		{key: "name", value: params.Name},
+		{key: "number", value: params.Number},
+		{key: "type_code", value: params.TypeCode},
+		{key: "accordance_type_code", value: params.AccordanceTypeCode},
+		{key: "issue_date", value: params.IssueDate.Format(time.RFC3339)},
+	}
+	if !params.ExpireDate.IsZero() {
+		fields = append(fields, attachmentField{key: "expire_date", value: params.ExpireDate.Format(time.RFC3339)})
+	}
+	for _, field := range fields {
+		if err := form.WriteField(field.key, field.value); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+			"name":     "files",
+			"filename": file.Name,
+		}))
+		header.Set("Content-Type", file.MIMEType)
+
+		part, err := form.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		size, err := io.Copy(part, file.limitedReader(CertificateFileLimits))
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return file.error(AttachmentEmpty, 0, CertificateFileLimits)
+		}
+	}
+
+	return form.Close()
+}
+
+func detectMIMEType(name string, head []byte) string {
+	detected := ""
+	if len(head) > 0 {
+		detected, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	}
+
+	if detected == "" || detected == "application/octet-stream" || detected == "text/plain" {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); byExt != "" {
+			byExt, _, _ = mime.ParseMediaType(byExt)
+			return byExt
+		}
+	}
+	if detected == "" {
+		return "application/octet-stream"
+	}
+
+	return detected
+}
+
+func attachmentExtension(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "application/pdf":
+		return ".pdf"
+	}
+
+	extensions, err := mime.ExtensionsByType(mimeType)
+	if err != nil || len(extensions) == 0 {
+		return ""
+	}
+	return extensions[0]
+}
@@ -0,0 +1,167 @@
+package ozon
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestSendAttachment(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("%PDF-1.4\n" + strings.Repeat("content", 1000))
+
+	requests := 0
+	var body map[string]string
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body = map[string]string{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code": 3, "message": "invalid body"}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"result": "success"}`))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	file, err := NewAttachment("invoice", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Name != "invoice.pdf" || file.MIMEType != "application/pdf" || file.Size != int64(len(content)) {
+		t.Errorf("wrong attachment: %+v", file)
+	}
+
+	resp, err := c.Chats().SendAttachment(ctx, "chat", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Result != "success" {
+		t.Errorf("wrong response: %+v", resp)
+	}
+
+	decoded, _ := base64.StdEncoding.DecodeString(body["base64_content"])
+	if !bytes.Equal(decoded, content) {
+		t.Errorf("wrong content: %s", body["base64_content"])
+	}
+	if body["chat_id"] != "chat" || body["name"] != "invoice.pdf" {
+		t.Errorf("wrong body: %v", body)
+	}
+
+	tests := []struct {
+		name   string
+		reader io.Reader
+		reason AttachmentErrorReason
+	}{
+		// Size is known in advance
+		{
+			"large.pdf",
+			bytes.NewReader(append([]byte("%PDF-1.4\n"), make([]byte, ChatFileLimits.MaxSize)...)),
+			AttachmentTooLarge,
+		},
+		// Size is checked while uploading
+		{
+			"large.pdf",
+			io.MultiReader(strings.NewReader("%PDF-1.4\n"), io.LimitReader(zeroReader{}, ChatFileLimits.MaxSize)),
+			AttachmentTooLarge,
+		},
+		{
+			"notes.txt",
+			strings.NewReader("plain text"),
+			AttachmentTypeNotAllowed,
+		},
+		{
+			"empty.pdf",
+			strings.NewReader(""),
+			AttachmentEmpty,
+		},
+	}
+
+	for _, test := range tests {
+		requests = 0
+
+		file, err := NewAttachment(test.name, test.reader)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		_, err = c.Chats().SendAttachment(ctx, "chat", file)
+		attachmentErr := &AttachmentError{}
+		if !errors.As(err, &attachmentErr) || attachmentErr.Reason != test.reason {
+			t.Errorf("expected attachment error %s, got: %v", test.reason, err)
+		}
+		if file.Size >= 0 && requests != 0 {
+			t.Errorf("file must be rejected before uploading: %s", test.name)
+		}
+	}
+}
+
+func TestUploadInvoiceAttachment(t *testing.T) {
+	t.Parallel()
+
+	content := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, []byte("jpeg content")...)
+	path := filepath.Join(t.TempDir(), "invoice.jpg")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]string
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "v1/invoice/file/upload" && r.URL.Path != "/v1/invoice/file/upload" {
+			t.Errorf("unexpected request: %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"url": "https://ozon.ru/invoice.jpg"}`))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	file, err := OpenAttachment(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if file.MIMEType != "image/jpeg" || file.Size != int64(len(content)) {
+		t.Errorf("wrong attachment: %+v", file)
+	}
+
+	resp, err := c.Invoices().UploadAttachment(ctx, "posting", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.URL != "https://ozon.ru/invoice.jpg" {
+		t.Errorf("wrong response: %+v", resp)
+	}
+
+	decoded, _ := base64.StdEncoding.DecodeString(body["base64_content"])
+	if !bytes.Equal(decoded, content) || body["posting_number"] != "posting" {
+		t.Errorf("wrong body: %v", body)
+	}
+}
@@ -0,0 +1,360 @@
+package ozon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/diphantxm/ozon-api-client/ozon/notifications"
+)
+
+const (
+	// Maximum number of cancellation requests in a list request
+	cancellationsBatchSize = 100
+
+	// Status of cancellation requests waiting for a decision
+	cancellationStateOnApproval = "ON_APPROVAL"
+)
+
+// Decision on a cancellation request
+type CancellationAction string
+
+const (
+	// Cancellation is approved, the shipment is canceled
+	CancellationActionApprove CancellationAction = "approve"
+
+	// Cancellation is rejected, the shipment must be delivered
+	CancellationActionReject CancellationAction = "reject"
+
+	// Shipment state doesn't allow to decide automatically.
+	// The request is left for the seller account or auto approval
+	CancellationActionSkip CancellationAction = "skip"
+)
+
+// Decision made on a cancellation request
+type CancellationDecision struct {
+	// Decision time
+	Time time.Time `json:"time"`
+
+	// Cancellation request identifier
+	CancellationId int64 `json:"cancellation_id"`
+
+	// Shipment number
+	PostingNumber string `json:"posting_number"`
+
+	// Shipment status at the decision time
+	ShipmentStatus ShipmentStatus `json:"shipment_status"`
+
+	// Shipment substatus at the decision time
+	ShipmentSubstatus ShipmentSubstatus `json:"shipment_substatus"`
+
+	// Action taken or proposed
+	Action CancellationAction `json:"action"`
+
+	// Comment sent with the decision
+	Comment string `json:"comment,omitempty"`
+
+	// Why the decision was made
+	Reason string `json:"reason"`
+
+	// true, if the decision was sent
+	Executed bool `json:"executed"`
+
+	// true, if the decision wasn't sent because of dry-run mode
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Error of sending the decision
+	Error string `json:"error,omitempty"`
+}
+
+// Checks if the shipment is handed over to delivery.
+// Returns false as the second value if it can't be decided by the shipment state
+type ShipmentHandOverCheck func(shipment *GetShipmentDataByIdentifierResult) (handedOver bool, known bool)
+
+// Default check of shipment hand over.
+//
+// Shipments awaiting registration, packaging or shipping are not handed over.
+// Shipments with delivering date or in delivery are handed over.
+// Other states, e.g. arbitration, are unknown
+func IsShipmentHandedOver(shipment *GetShipmentDataByIdentifierResult) (bool, bool) {
+	if !shipment.DeliveringDate.IsZero() {
+		return true, true
+	}
+
+	switch shipment.Status {
+	case AwaitingApprove, AwaitingPackaging, AwaitingDeliver, AwaitingVerification, CancelledSubstatus:
+		return false, true
+	case AcceptanceInProgress, DriverPickup, Delivering, Delivered, SentBySeller:
+		return true, true
+	}
+	return false, false
+}
+
+type CancellationWorkflowOption func(w *CancellationWorkflow)
+
+// Comment for rejected requests.
+//
+// Default is "Заказ уже передан в службу доставки"
+func WithCancellationRejectComment(comment string) CancellationWorkflowOption {
+	return func(w *CancellationWorkflow) {
+		w.rejectComment = comment
+	}
+}
+
+// Comment for approved requests. Default is empty
+func WithCancellationApproveComment(comment string) CancellationWorkflowOption {
+	return func(w *CancellationWorkflow) {
+		w.approveComment = comment
+	}
+}
+
+// Check of shipment hand over. Default is IsShipmentHandedOver
+func WithShipmentHandOverCheck(check ShipmentHandOverCheck) CancellationWorkflowOption {
+	return func(w *CancellationWorkflow) {
+		w.handedOver = check
+	}
+}
+
+// Make decisions without sending them
+func WithCancellationDryRun(dryRun bool) CancellationWorkflowOption {
+	return func(w *CancellationWorkflow) {
+		w.dryRun = dryRun
+	}
+}
+
+// Interval between processing runs in Run. Default is 5 minutes
+func WithCancellationPollInterval(interval time.Duration) CancellationWorkflowOption {
+	return func(w *CancellationWorkflow) {
+		w.pollInterval = interval
+	}
+}
+
+// Called for every decision, e.g. to keep a log of decisions
+func WithCancellationDecisionHandler(handler func(decision CancellationDecision)) CancellationWorkflowOption {
+	return func(w *CancellationWorkflow) {
+		w.onDecision = handler
+	}
+}
+
+// Called for errors in Run. Default handler logs errors
+func WithCancellationErrorHandler(handler func(err error)) CancellationWorkflowOption {
+	return func(w *CancellationWorkflow) {
+		w.onError = handler
+	}
+}
+
+// Decides on rFBS cancellation requests by the shipment state.
+// Requests are approved if the shipment isn't handed over to delivery yet
+// and rejected with a comment otherwise.
+//
+// Requests are processed on schedule with Run or
+// triggered by `TYPE_POSTING_CANCELLED` notifications
+type CancellationWorkflow struct {
+	cancellations *Cancellations
+	fbs           *FBS
+
+	rejectComment  string
+	approveComment string
+	handedOver     ShipmentHandOverCheck
+	dryRun         bool
+	pollInterval   time.Duration
+	onDecision     func(decision CancellationDecision)
+	onError        func(err error)
+
+	mu         sync.Mutex
+	inProgress map[int64]bool
+}
+
+func NewCancellationWorkflow(cancellations *Cancellations, fbs *FBS, opts ...CancellationWorkflowOption) *CancellationWorkflow {
+	w := &CancellationWorkflow{
+		cancellations: cancellations,
+		fbs:           fbs,
+		rejectComment: "Заказ уже передан в службу доставки",
+		handedOver:    IsShipmentHandedOver,
+		pollInterval:  5 * time.Minute,
+		onDecision:    func(decision CancellationDecision) {},
+		onError: func(err error) {
+			log.Print(err)
+		},
+		inProgress: map[int64]bool{},
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Processes requests waiting for approval until the context is canceled
+func (w *CancellationWorkflow) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Process(ctx); err != nil && ctx.Err() == nil {
+			w.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Processes all requests waiting for approval once
+func (w *CancellationWorkflow) Process(ctx context.Context) ([]CancellationDecision, error) {
+	return w.process(ctx, &ListCancellationsFilter{State: cancellationStateOnApproval})
+}
+
+// Processes requests waiting for approval for the shipment
+// from `TYPE_POSTING_CANCELLED` notification.
+// Can be registered in notifications server
+func (w *CancellationWorkflow) HandleNotification(ctx context.Context, notification *notifications.PostingCancelled) error {
+	_, err := w.process(ctx, &ListCancellationsFilter{
+		PostingNumber: notification.PostingNumber,
+		State:         cancellationStateOnApproval,
+	})
+	return err
+}
+
+func (w *CancellationWorkflow) process(ctx context.Context, filter *ListCancellationsFilter) ([]CancellationDecision, error) {
+	// Decided requests leave the filter, so all requests
+	// are listed before deciding to keep offsets valid
+	requests := []CancellationInfo{}
+	params := &ListCancellationsParams{
+		Filter: filter,
+		Limit:  cancellationsBatchSize,
+	}
+	for {
+		resp, err := w.cancellations.List(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("list cancellations: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		requests = append(requests, resp.Result...)
+		if len(resp.Result) < cancellationsBatchSize {
+			break
+		}
+		params.Offset += cancellationsBatchSize
+	}
+
+	decisions := []CancellationDecision{}
+	for i := range requests {
+		decision, err := w.Decide(ctx, &requests[i])
+		if err != nil {
+			return decisions, err
+		}
+		if decision != nil {
+			decisions = append(decisions, *decision)
+		}
+	}
+
+	return decisions, nil
+}
+
+// Checks the shipment state and sends the decision on the request.
+// Returns nil if the request is already being processed
+func (w *CancellationWorkflow) Decide(ctx context.Context, request *CancellationInfo) (*CancellationDecision, error) {
+	if !w.start(request.CancellationId) {
+		return nil, nil
+	}
+	defer w.finish(request.CancellationId)
+
+	shipment, err := w.fbs.GetShipmentDataByIdentifier(ctx, &GetShipmentDataByIdentifierParams{
+		PostingNumber: request.PostingNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if shipment.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get shipment %s: %d %s", request.PostingNumber, shipment.StatusCode, shipment.Message)
+	}
+
+	decision := CancellationDecision{
+		Time:              time.Now(),
+		CancellationId:    request.CancellationId,
+		PostingNumber:     request.PostingNumber,
+		ShipmentStatus:    shipment.Result.Status,
+		ShipmentSubstatus: shipment.Result.Substatus,
+	}
+
+	handedOver, known := w.handedOver(&shipment.Result)
+	switch {
+	case !known:
+		decision.Action = CancellationActionSkip
+		decision.Reason = fmt.Sprintf("shipment status %s doesn't allow automatic decision", shipment.Result.Status)
+	case handedOver:
+		decision.Action = CancellationActionReject
+		decision.Comment = w.rejectComment
+		decision.Reason = "shipment is handed over to delivery"
+	default:
+		decision.Action = CancellationActionApprove
+		decision.Comment = w.approveComment
+		decision.Reason = "shipment isn't handed over to delivery"
+	}
+
+	if decision.Action != CancellationActionSkip {
+		w.execute(ctx, &decision)
+	}
+	w.onDecision(decision)
+
+	return &decision, nil
+}
+
+func (w *CancellationWorkflow) execute(ctx context.Context, decision *CancellationDecision) {
+	if w.dryRun {
+		decision.DryRun = true
+		return
+	}
+
+	params := &ApproveRejectCancellationsParams{
+		CancellationId: decision.CancellationId,
+		Comment:        decision.Comment,
+	}
+
+	var (
+		resp *ApproveRejectCancellationsResponse
+		err  error
+	)
+	if decision.Action == CancellationActionApprove {
+		resp, err = w.cancellations.Approve(ctx, params)
+	} else {
+		resp, err = w.cancellations.Reject(ctx, params)
+	}
+	if err != nil {
+		decision.Error = err.Error()
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		decision.Error = fmt.Sprintf("%s cancellation: %d %s", decision.Action, resp.StatusCode, resp.Message)
+		return
+	}
+	decision.Executed = true
+}
+
+func (w *CancellationWorkflow) start(cancellationId int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.inProgress[cancellationId] {
+		return false
+	}
+	w.inProgress[cancellationId] = true
+	return true
+}
+
+func (w *CancellationWorkflow) finish(cancellationId int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.inProgress, cancellationId)
+}
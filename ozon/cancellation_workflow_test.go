@@ -0,0 +1,191 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diphantxm/ozon-api-client/ozon/notifications"
+)
+
+type cancellationsMock struct {
+	mu        sync.Mutex
+	filters   []ListCancellationsFilter
+	decisions []string
+}
+
+func (m *cancellationsMock) handler(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var response string
+	path := "/" + strings.TrimPrefix(r.URL.Path, "/")
+	switch path {
+	case "/v1/conditional-cancellation/list":
+		params := ListCancellationsParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+		m.filters = append(m.filters, *params.Filter)
+
+		response = `{"result": [
+			{"cancellation_id": 1, "posting_number": "1-1"},
+			{"cancellation_id": 2, "posting_number": "2-1"},
+			{"cancellation_id": 3, "posting_number": "3-1"},
+			{"cancellation_id": 4, "posting_number": "4-1"}
+		], "total": 4}`
+		if params.Filter.PostingNumber != "" {
+			response = `{"result": [{"cancellation_id": 2, "posting_number": "2-1"}], "total": 1}`
+		}
+	case "/v3/posting/fbs/get":
+		params := GetShipmentDataByIdentifierParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+
+		switch params.PostingNumber {
+		case "1-1":
+			response = `{"result": {"posting_number": "1-1", "status": "awaiting_deliver"}}`
+		case "2-1":
+			response = `{"result": {"posting_number": "2-1", "status": "delivering", "delivering_date": "2024-01-01T10:00:00Z"}}`
+		case "3-1":
+			response = `{"result": {"posting_number": "3-1", "status": "arbitration"}}`
+		case "4-1":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code": 5, "message": "posting not found"}`))
+			return
+		}
+	case "/v1/conditional-cancellation/approve", "/v1/conditional-cancellation/reject":
+		params := ApproveRejectCancellationsParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+		m.decisions = append(m.decisions, fmt.Sprintf("%s %d %s", path, params.CancellationId, params.Comment))
+		response = `{}`
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(response))
+}
+
+func TestCancellationWorkflow(t *testing.T) {
+	t.Parallel()
+
+	mock := &cancellationsMock{}
+	c := NewMockClient(mock.handler)
+
+	decided := []CancellationDecision{}
+	workflow := NewCancellationWorkflow(c.Cancellations(), c.FBS(),
+		WithCancellationRejectComment("Уже в пути"),
+		WithCancellationDecisionHandler(func(decision CancellationDecision) {
+			decided = append(decided, decision)
+		}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	decisions, err := workflow.Process(ctx)
+	if err == nil {
+		t.Fatalf("expected error for unknown shipment")
+	}
+
+	expected := []struct {
+		action   CancellationAction
+		executed bool
+	}{
+		{CancellationActionApprove, true},
+		{CancellationActionReject, true},
+		{CancellationActionSkip, false},
+	}
+	if len(decisions) != len(expected) || len(decided) != len(expected) {
+		t.Fatalf("wrong decisions: %+v", decisions)
+	}
+	for i, e := range expected {
+		if decisions[i].Action != e.action || decisions[i].Executed != e.executed || decisions[i].Error != "" {
+			t.Errorf("wrong decision: %+v", decisions[i])
+		}
+	}
+	if decisions[1].ShipmentStatus != Delivering || decisions[1].Comment != "Уже в пути" {
+		t.Errorf("wrong rejection: %+v", decisions[1])
+	}
+
+	mock.mu.Lock()
+	if strings.Join(mock.decisions, ",") != "/v1/conditional-cancellation/approve 1 ,/v1/conditional-cancellation/reject 2 Уже в пути" {
+		t.Errorf("wrong decisions sent: %v", mock.decisions)
+	}
+	if len(mock.filters) != 1 || mock.filters[0].State != "ON_APPROVAL" {
+		t.Errorf("wrong filter: %+v", mock.filters)
+	}
+	mock.mu.Unlock()
+
+	if err := workflow.HandleNotification(ctx, &notifications.PostingCancelled{PostingNumber: "2-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if filter := mock.filters[len(mock.filters)-1]; filter.PostingNumber != "2-1" || filter.State != "ON_APPROVAL" {
+		t.Errorf("wrong filter: %+v", filter)
+	}
+	if len(mock.decisions) != 3 {
+		t.Errorf("wrong decisions sent: %v", mock.decisions)
+	}
+}
+
+func TestCancellationWorkflowDryRun(t *testing.T) {
+	t.Parallel()
+
+	mock := &cancellationsMock{}
+	c := NewMockClient(mock.handler)
+
+	workflow := NewCancellationWorkflow(c.Cancellations(), c.FBS(),
+		WithCancellationDryRun(true),
+		WithShipmentHandOverCheck(func(shipment *GetShipmentDataByIdentifierResult) (bool, bool) {
+			return shipment.Status == Delivering, true
+		}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	decision, err := workflow.Decide(ctx, &CancellationInfo{CancellationId: 3, PostingNumber: "3-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Action != CancellationActionApprove || !decision.DryRun || decision.Executed {
+		t.Errorf("wrong decision: %+v", decision)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.decisions) != 0 {
+		t.Errorf("decisions must not be sent in dry-run mode, got: %v", mock.decisions)
+	}
+}
+
+func TestIsShipmentHandedOver(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		shipment   GetShipmentDataByIdentifierResult
+		handedOver bool
+		known      bool
+	}{
+		{GetShipmentDataByIdentifierResult{Status: AwaitingPackaging}, false, true},
+		{GetShipmentDataByIdentifierResult{Status: AwaitingDeliver}, false, true},
+		{GetShipmentDataByIdentifierResult{Status: AwaitingDeliver, DeliveringDate: time.Now()}, true, true},
+		{GetShipmentDataByIdentifierResult{Status: DriverPickup}, true, true},
+		{GetShipmentDataByIdentifierResult{Status: Delivered}, true, true},
+		{GetShipmentDataByIdentifierResult{Status: Arbitration}, false, false},
+	}
+
+	for _, test := range tests {
+		handedOver, known := IsShipmentHandedOver(&test.shipment)
+		if handedOver != test.handedOver || known != test.known {
+			t.Errorf("wrong result for %s: got: %v %v", test.shipment.Status, handedOver, known)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package ozon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Maximum number of certificates or products in a list request
+const certificatesPageSize = 1000
+
+// Certificate to be uploaded from disk
+type CertificateUpload struct {
+	// Certificate name. No more than 100 characters
+	Name string
+
+	// Certificate number. No more than 100 characters
+	Number string
+
+	// Certificate type from `DirectoryOfDocumentTypes`
+	TypeCode string
+
+	// Accordance type from `ListOfAccordanceTypes`
+	AccordanceTypeCode string
+
+	// Issue date of the certificate
+	IssueDate time.Time
+
+	// Expiration date of the certificate. Can be empty for permanent certificates
+	ExpireDate time.Time
+
+	// Paths to certificate files. Valid extensions are jpg, jpeg, png, pdf
+	Files []string
+}
+
+// Certificate with products bound to it
+type TrackedCertificate struct {
+	ListCertificatesResultCert
+
+	// Products bound to the certificate
+	Products []CertificateProduct
+}
+
+// true, if the certificate has expiration date and it's before the time
+func (c *TrackedCertificate) ExpiresBefore(t time.Time) bool {
+	return !c.ExpireDate.IsZero() && c.ExpireDate.Before(t)
+}
+
+// Product bound to a certificate
+type CertificateProduct struct {
+	// Product identifier
+	ProductId int64
+
+	// Status of the product processing when binding to a certificate
+	ProductStatusCode string
+}
+
+// Change of a certificate moderation status since the previous sync
+type CertificateStatusChange struct {
+	// Certificate identifier
+	CertificateId int32
+
+	// Certificate number
+	CertificateNumber string
+
+	// Status before the sync. Empty for new certificates
+	OldStatus string
+
+	// Status after the sync
+	NewStatus string
+
+	// Certificate rejection reason
+	RejectionReasonCode string
+
+	// Moderator's comment
+	VerificationComment string
+}
+
+// Product that will lose certification
+type ExpiringCertificateProduct struct {
+	// Product identifier
+	ProductId int64
+
+	// Certificate with the latest expiration date the product is bound to
+	CertificateId int32
+
+	// Certificate number
+	CertificateNumber string
+
+	// Date when the product loses certification
+	ExpireDate time.Time
+
+	// Number of days left. Negative if certification is already lost
+	DaysLeft int
+}
+
+type CertificateManagerOption func(m *CertificateManager)
+
+// Certificate statuses which products keep certification with.
+// Default is "verified"
+func WithValidCertificateStatuses(statuses ...string) CertificateManagerOption {
+	return func(m *CertificateManager) {
+		m.validStatuses = map[string]bool{}
+		for _, status := range statuses {
+			m.validStatuses[status] = true
+		}
+	}
+}
+
+// Uploads certificates from disk and tracks
+// their moderation status and expiration dates
+type CertificateManager struct {
+	certificates *Certificates
+
+	validStatuses map[string]bool
+	now           func() time.Time
+
+	mu              sync.Mutex
+	types           map[string]bool
+	accordanceTypes map[string]bool
+	tracked         map[int32]*TrackedCertificate
+}
+
+func NewCertificateManager(certificates *Certificates, opts ...CertificateManagerOption) *CertificateManager {
+	m := &CertificateManager{
+		certificates:  certificates,
+		validStatuses: map[string]bool{"verified": true},
+		now:           time.Now,
+		tracked:       map[int32]*TrackedCertificate{},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Validates the certificate type and accordance type
+// and uploads the certificate files. Returns the certificate identifier
+func (m *CertificateManager) Upload(ctx context.Context, upload *CertificateUpload) (int, error) {
+	if err := m.Validate(ctx, upload); err != nil {
+		return 0, err
+	}
+
+	files := make([]*Attachment, 0, len(upload.Files))
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, path := range upload.Files {
+		file, err := OpenAttachment(path)
+		if err != nil {
+			return 0, err
+		}
+		files = append(files, file)
+	}
+
+	resp, err := m.certificates.AddFilesForProducts(ctx, &AddCertificatesForProductsParams{
+		Name:               upload.Name,
+		Number:             upload.Number,
+		TypeCode:           upload.TypeCode,
+		AccordanceTypeCode: upload.AccordanceTypeCode,
+		IssueDate:          upload.IssueDate,
+		ExpireDate:         upload.ExpireDate,
+	}, files...)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("add certificate: %d %s", resp.StatusCode, resp.Message)
+	}
+
+	return resp.Id, nil
+}
+
+// Checks the certificate before uploading. Types and accordance types
+// are loaded once and cached
+func (m *CertificateManager) Validate(ctx context.Context, upload *CertificateUpload) error {
+	if upload.Name == "" || upload.Number == "" {
+		return fmt.Errorf("certificate name and number are required")
+	}
+	if len([]rune(upload.Name)) > 100 || len([]rune(upload.Number)) > 100 {
+		return fmt.Errorf("certificate name and number must be no more than 100 characters")
+	}
+	if upload.IssueDate.IsZero() {
+		return fmt.Errorf("certificate issue date is required")
+	}
+	if !upload.ExpireDate.IsZero() && !upload.ExpireDate.After(upload.IssueDate) {
+		return fmt.Errorf("certificate expire date must be after issue date")
+	}
+	if len(upload.Files) == 0 {
+		return fmt.Errorf("no certificate files")
+	}
+
+	types, accordanceTypes, err := m.loadTypes(ctx)
+	if err != nil {
+		return err
+	}
+	if !types[upload.TypeCode] {
+		return fmt.Errorf("unknown certificate type %q", upload.TypeCode)
+	}
+	if !accordanceTypes[upload.AccordanceTypeCode] {
+		return fmt.Errorf("unknown accordance type %q", upload.AccordanceTypeCode)
+	}
+
+	return nil
+}
+
+func (m *CertificateManager) loadTypes(ctx context.Context) (map[string]bool, map[string]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.types != nil {
+		return m.types, m.accordanceTypes, nil
+	}
+
+	types, err := m.certificates.DirectoryOfDocumentTypes(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if types.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("get certificate types: %d %s", types.StatusCode, types.Message)
+	}
+
+	accordanceTypes, err := m.certificates.ListOfAccordanceTypes(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if accordanceTypes.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("get accordance types: %d %s", accordanceTypes.StatusCode, accordanceTypes.Message)
+	}
+
+	m.types = map[string]bool{}
+	for _, t := range types.Result {
+		m.types[t.Value] = true
+	}
+	m.accordanceTypes = map[string]bool{}
+	for _, t := range accordanceTypes.Result.Base {
+		m.accordanceTypes[t.Code] = true
+	}
+	for _, t := range accordanceTypes.Result.Hazard {
+		m.accordanceTypes[t.Code] = true
+	}
+
+	return m.types, m.accordanceTypes, nil
+}
+
+// Loads all certificates with their products.
+// Returns moderation status changes since the previous sync
+func (m *CertificateManager) Sync(ctx context.Context) ([]CertificateStatusChange, error) {
+	tracked := map[int32]*TrackedCertificate{}
+
+	params := &ListCertificatesParams{Page: 1, PageSize: certificatesPageSize}
+	for {
+		resp, err := m.certificates.List(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("list certificates: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		for _, cert := range resp.Result.Certificates {
+			tracked[cert.CertificateId] = &TrackedCertificate{ListCertificatesResultCert: cert}
+		}
+
+		if params.Page >= resp.Result.PageCount || len(resp.Result.Certificates) == 0 {
+			break
+		}
+		params.Page++
+	}
+
+	for _, cert := range tracked {
+		if cert.ProductsCount == 0 {
+			continue
+		}
+
+		products, err := m.listProducts(ctx, cert.CertificateId)
+		if err != nil {
+			return nil, err
+		}
+		cert.Products = products
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changes := []CertificateStatusChange{}
+	for id, cert := range tracked {
+		oldStatus := ""
+		if previous, ok := m.tracked[id]; ok {
+			oldStatus = previous.StatusCode
+		}
+		if oldStatus == cert.StatusCode {
+			continue
+		}
+
+		changes = append(changes, CertificateStatusChange{
+			CertificateId:       id,
+			CertificateNumber:   cert.CertificateNumber,
+			OldStatus:           oldStatus,
+			NewStatus:           cert.StatusCode,
+			RejectionReasonCode: cert.RejectionReasonCode,
+			VerificationComment: cert.VerificationComment,
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].CertificateId < changes[j].CertificateId
+	})
+	m.tracked = tracked
+
+	return changes, nil
+}
+
+func (m *CertificateManager) listProducts(ctx context.Context, certificateId int32) ([]CertificateProduct, error) {
+	products := []CertificateProduct{}
+
+	params := &ListProductsForCertificateParams{
+		CertificateId: certificateId,
+		Page:          1,
+		PageSize:      certificatesPageSize,
+	}
+	for {
+		resp, err := m.certificates.ListProductsForCertificate(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("list products of certificate %d: %d %s", certificateId, resp.StatusCode, resp.Message)
+		}
+
+		for _, item := range resp.Result.Items {
+			products = append(products, CertificateProduct{
+				ProductId:         item.ProductId,
+				ProductStatusCode: item.ProductStatusCode,
+			})
+		}
+
+		if int64(len(products)) >= resp.Result.Count || len(resp.Result.Items) == 0 {
+			return products, nil
+		}
+		params.Page++
+	}
+}
+
+// Returns certificates loaded by the last sync sorted by identifier
+func (m *CertificateManager) Certificates() []TrackedCertificate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	certificates := make([]TrackedCertificate, 0, len(m.tracked))
+	for _, cert := range m.tracked {
+		certificates = append(certificates, *cert)
+	}
+	sort.Slice(certificates, func(i, j int) bool {
+		return certificates[i].CertificateId < certificates[j].CertificateId
+	})
+	return certificates
+}
+
+// Returns certificates loaded by the last sync that expire within the days
+func (m *CertificateManager) ExpiringCertificates(days int) []TrackedCertificate {
+	deadline := m.now().AddDate(0, 0, days)
+
+	certificates := []TrackedCertificate{}
+	for _, cert := range m.Certificates() {
+		if cert.ExpiresBefore(deadline) {
+			certificates = append(certificates, cert)
+		}
+	}
+	return certificates
+}
+
+// Returns products that will lose certification within the days,
+// sorted by expiration date. A product keeps certification while
+// any of its certificates with a valid status is not expired,
+// so only the latest expiration date of the product counts
+func (m *CertificateManager) ExpiringProducts(days int) []ExpiringCertificateProduct {
+	now := m.now()
+	deadline := now.AddDate(0, 0, days)
+
+	latest := map[int64]*TrackedCertificate{}
+	for _, cert := range m.Certificates() {
+		cert := cert
+		if !m.validStatuses[cert.StatusCode] {
+			continue
+		}
+
+		for _, product := range cert.Products {
+			current, ok := latest[product.ProductId]
+			switch {
+			case !ok:
+				latest[product.ProductId] = &cert
+			case current.ExpireDate.IsZero():
+				// Permanent certificate
+			case cert.ExpireDate.IsZero() || cert.ExpireDate.After(current.ExpireDate):
+				latest[product.ProductId] = &cert
+			}
+		}
+	}
+
+	products := []ExpiringCertificateProduct{}
+	for productId, cert := range latest {
+		if !cert.ExpiresBefore(deadline) {
+			continue
+		}
+
+		products = append(products, ExpiringCertificateProduct{
+			ProductId:         productId,
+			CertificateId:     cert.CertificateId,
+			CertificateNumber: cert.CertificateNumber,
+			ExpireDate:        cert.ExpireDate,
+			DaysLeft:          int(cert.ExpireDate.Sub(now).Hours() / 24),
+		})
+	}
+	sort.Slice(products, func(i, j int) bool {
+		if !products[i].ExpireDate.Equal(products[j].ExpireDate) {
+			return products[i].ExpireDate.Before(products[j].ExpireDate)
+		}
+		return products[i].ProductId < products[j].ProductId
+	})
+
+	return products
+}
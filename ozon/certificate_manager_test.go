@@ -0,0 +1,213 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type certificatesMock struct {
+	mu           sync.Mutex
+	thirdStatus  string
+	uploadFields map[string]string
+	uploadFiles  map[string]string
+}
+
+func (m *certificatesMock) handler(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var response string
+	switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+	case "/v1/product/certificate/types":
+		response = `{"result": [{"name": "Declaration", "value": "declaration"}]}`
+	case "/v2/product/certificate/accordance-types/list":
+		response = `{"result": {"base": [{"code": "gost"}], "hazard": [{"code": "hazard_gost"}]}}`
+	case "/v1/product/certificate/create":
+		reader, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.uploadFields, m.uploadFiles = map[string]string{}, map[string]string{}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			content, _ := io.ReadAll(part)
+			if part.FileName() != "" {
+				m.uploadFiles[part.FileName()] = part.Header.Get("Content-Type") + " " + string(content)
+			} else {
+				m.uploadFields[part.FormName()] = string(content)
+			}
+		}
+		response = `{"id": 42}`
+	case "/v1/product/certificate/list":
+		params := ListCertificatesParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+
+		response = `{"result": {"page_count": 2, "certificates": [
+			{"certificate_id": 1, "certificate_number": "N1", "status_code": "verified", "expire_date": "2024-06-10T00:00:00Z", "products_count": 2},
+			{"certificate_id": 2, "certificate_number": "N2", "status_code": "verified", "expire_date": "2025-01-01T00:00:00Z", "products_count": 1}
+		]}}`
+		if params.Page == 2 {
+			response = `{"result": {"page_count": 2, "certificates": [
+				{"certificate_id": 3, "certificate_number": "N3", "status_code": "` + m.thirdStatus + `", "rejection_reason_code": "blurry", "expire_date": "2024-06-05T00:00:00Z", "products_count": 1},
+				{"certificate_id": 4, "certificate_number": "N4", "status_code": "verified", "products_count": 1}
+			]}}`
+		}
+	case "/v1/product/certificate/products/list":
+		params := ListProductsForCertificateParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+
+		products := map[int32]string{
+			1: `{"product_id": 10}, {"product_id": 20}`,
+			2: `{"product_id": 20}`,
+			3: `{"product_id": 30}`,
+			4: `{"product_id": 40}`,
+		}[params.CertificateId]
+		response = `{"result": {"count": ` + string(rune('0'+strings.Count(products, "{"))) + `, "items": [` + products + `]}}`
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(response))
+}
+
+func TestCertificateManagerUpload(t *testing.T) {
+	t.Parallel()
+
+	mock := &certificatesMock{}
+	c := NewMockClient(mock.handler)
+	manager := NewCertificateManager(c.Certificates())
+
+	path := filepath.Join(t.TempDir(), "certificate.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4 certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	upload := &CertificateUpload{
+		Name:               "Declaration",
+		Number:             "N1",
+		TypeCode:           "declaration",
+		AccordanceTypeCode: "hazard_gost",
+		IssueDate:          time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Files:              []string{path},
+	}
+	id, err := manager.Upload(ctx, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 42 {
+		t.Errorf("wrong certificate id: %d", id)
+	}
+
+	mock.mu.Lock()
+	if mock.uploadFields["number"] != "N1" || mock.uploadFields["issue_date"] != "2024-01-01T00:00:00Z" || mock.uploadFields["accordance_type_code"] != "hazard_gost" {
+		t.Errorf("wrong fields: %v", mock.uploadFields)
+	}
+	if _, ok := mock.uploadFields["expire_date"]; ok {
+		t.Errorf("expire date must not be sent for permanent certificates")
+	}
+	if mock.uploadFiles["certificate.pdf"] != "application/pdf %PDF-1.4 certificate" {
+		t.Errorf("wrong files: %v", mock.uploadFiles)
+	}
+	mock.mu.Unlock()
+
+	invalid := *upload
+	invalid.TypeCode = "unknown"
+	if _, err := manager.Upload(ctx, &invalid); err == nil {
+		t.Errorf("expected error for unknown type")
+	}
+
+	invalid = *upload
+	invalid.AccordanceTypeCode = "unknown"
+	if _, err := manager.Upload(ctx, &invalid); err == nil {
+		t.Errorf("expected error for unknown accordance type")
+	}
+
+	invalid = *upload
+	invalid.ExpireDate = invalid.IssueDate.AddDate(0, 0, -1)
+	if _, err := manager.Upload(ctx, &invalid); err == nil {
+		t.Errorf("expected error for expire date before issue date")
+	}
+
+	text := filepath.Join(t.TempDir(), "certificate.txt")
+	if err := os.WriteFile(text, []byte("certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid = *upload
+	invalid.Files = []string{text}
+	if _, err := manager.Upload(ctx, &invalid); err == nil {
+		t.Errorf("expected error for text file")
+	}
+}
+
+func TestCertificateManagerExpiry(t *testing.T) {
+	t.Parallel()
+
+	mock := &certificatesMock{thirdStatus: "moderation"}
+	c := NewMockClient(mock.handler)
+	manager := NewCertificateManager(c.Certificates())
+	manager.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	changes, err := manager.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 4 || changes[2].OldStatus != "" || changes[2].NewStatus != "moderation" {
+		t.Errorf("wrong changes: %+v", changes)
+	}
+
+	certificates := manager.Certificates()
+	if len(certificates) != 4 || len(certificates[0].Products) != 2 || certificates[3].Products[0].ProductId != 40 {
+		t.Errorf("wrong certificates: %+v", certificates)
+	}
+
+	expiring := manager.ExpiringCertificates(30)
+	if len(expiring) != 2 || expiring[0].CertificateId != 1 || expiring[1].CertificateId != 3 {
+		t.Errorf("wrong expiring certificates: %+v", expiring)
+	}
+
+	// Product 20 is covered by certificate 2, product 30 isn't verified
+	products := manager.ExpiringProducts(30)
+	if len(products) != 1 || products[0].ProductId != 10 || products[0].CertificateId != 1 || products[0].DaysLeft != 9 {
+		t.Errorf("wrong expiring products: %+v", products)
+	}
+	if products := manager.ExpiringProducts(365); len(products) != 2 || products[1].ProductId != 20 {
+		t.Errorf("wrong expiring products: %+v", products)
+	}
+
+	mock.mu.Lock()
+	mock.thirdStatus = "declined"
+	mock.mu.Unlock()
+
+	changes, err = manager.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].CertificateId != 3 || changes[0].OldStatus != "moderation" ||
+		changes[0].NewStatus != "declined" || changes[0].RejectionReasonCode != "blurry" {
+		t.Errorf("wrong changes: %+v", changes)
+	}
+}
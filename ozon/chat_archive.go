@@ -0,0 +1,518 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Name of the file with the incremental index in the archive directory
+	chatArchiveIndexFile = "index.json"
+
+	// Maximum number of messages requested at once
+	chatArchiveHistoryLimit = 1000
+
+	// Maximum number of chats requested at once
+	chatArchiveListLimit = 100
+)
+
+// Links to files in Markdown message content
+var chatArchiveLinkPattern = regexp.MustCompile(`\]\((https?://[^)\s]+)\)`)
+
+// Characters not allowed in names of downloaded files
+var chatArchiveFileNamePattern = regexp.MustCompile(`[^\w.-]+`)
+
+// Message saved to a chat archive
+type ArchivedChatMessage struct {
+	ChatHistoryMessage
+
+	// Paths of downloaded files relative to the chat directory
+	Files []string `json:"files,omitempty"`
+
+	// Errors of files that failed to download
+	FileErrors []string `json:"file_errors,omitempty"`
+}
+
+// Chat saved to an archive
+type ChatArchive struct {
+	// Chat identifier
+	ChatId string `json:"chat_id"`
+
+	// Chat type
+	ChatType string `json:"chat_type"`
+
+	// Chat creation date
+	CreatedAt time.Time `json:"created_at"`
+
+	// Messages sorted from old to new
+	Messages []ArchivedChatMessage `json:"messages"`
+}
+
+// Incremental index of a chat archive directory
+type ChatArchiveIndex struct {
+	Chats map[string]ChatArchiveIndexEntry `json:"chats"`
+}
+
+type ChatArchiveIndexEntry struct {
+	// Identifier of the last archived message
+	LastMessageId string `json:"last_message_id"`
+
+	// Number of archived messages
+	MessagesCount int `json:"messages_count"`
+
+	// Date of the last archive update
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ChatArchiveParams struct {
+	// Archive messages created not earlier than this date. Not limited if zero.
+	//
+	// Used only on the first run for a chat, later runs continue from the last archived message
+	Since time.Time
+
+	// Archive messages created not later than this date. Not limited if zero
+	Till time.Time
+
+	// Filter by chat status. All chats are archived if empty
+	ChatStatus string
+
+	// Archive only these chats. Chats are taken from Chats.List if empty
+	ChatIds []string
+}
+
+// Result of archiving a chat
+type ChatArchiveResult struct {
+	// Chat identifier
+	ChatId string
+
+	// Number of messages added to the archive
+	NewMessages int
+
+	// Number of downloaded files
+	DownloadedFiles int
+
+	// Number of files that failed to download
+	FailedFiles int
+}
+
+// Downloads a file referenced in a message
+type ChatFileDownloader func(ctx context.Context, url string) (io.ReadCloser, error)
+
+type ChatArchiverOption func(a *ChatArchiver)
+
+// Function used to download files referenced in messages.
+//
+// By default files are downloaded with the API client,
+// so Client-Id and Api-Key are sent to the API host
+func WithChatFileDownloader(downloader ChatFileDownloader) ChatArchiverOption {
+	return func(a *ChatArchiver) {
+		a.download = downloader
+	}
+}
+
+// Download files referenced in messages. Default is true
+func WithChatArchiveFiles(download bool) ChatArchiverOption {
+	return func(a *ChatArchiver) {
+		a.downloadFiles = download
+	}
+}
+
+// Saves chats to a directory. Each chat is saved to its own subdirectory
+// with messages in JSON, HTML transcript and downloaded files.
+// The directory keeps an index, so only new messages are fetched on re-runs
+type ChatArchiver struct {
+	chats *Chats
+	dir   string
+
+	download      ChatFileDownloader
+	downloadFiles bool
+}
+
+func NewChatArchiver(chats *Chats, dir string, opts ...ChatArchiverOption) *ChatArchiver {
+	a := &ChatArchiver{
+		chats:         chats,
+		dir:           dir,
+		download:      chats.client.Download,
+		downloadFiles: true,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// Archives chats and updates the index. The index is saved
+// after each chat, so an interrupted run can be continued.
+// Failed downloads don't stop archiving, they are recorded in the messages
+func (a *ChatArchiver) Archive(ctx context.Context, params *ChatArchiveParams) ([]ChatArchiveResult, error) {
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	index, err := a.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	chats, err := a.listChats(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []ChatArchiveResult{}
+	for _, chat := range chats {
+		result, err := a.archiveChat(ctx, chat, index, params)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, *result)
+
+		if result.NewMessages == 0 {
+			continue
+		}
+		if err := a.saveJSON(filepath.Join(a.dir, chatArchiveIndexFile), index); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// Returns the index of the archive directory
+func (a *ChatArchiver) Index() (*ChatArchiveIndex, error) {
+	index := &ChatArchiveIndex{Chats: map[string]ChatArchiveIndexEntry{}}
+
+	content, err := os.ReadFile(filepath.Join(a.dir, chatArchiveIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, index); err != nil {
+		return nil, err
+	}
+	if index.Chats == nil {
+		index.Chats = map[string]ChatArchiveIndexEntry{}
+	}
+	return index, nil
+}
+
+// Returns an archived chat
+func (a *ChatArchiver) Chat(chatId string) (*ChatArchive, error) {
+	content, err := os.ReadFile(filepath.Join(a.chatDir(chatId), "messages.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &ChatArchive{}
+	if err := json.Unmarshal(content, archive); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func (a *ChatArchiver) listChats(ctx context.Context, params *ChatArchiveParams) ([]ListChatsChatData, error) {
+	if len(params.ChatIds) > 0 {
+		chats := make([]ListChatsChatData, 0, len(params.ChatIds))
+		for _, id := range params.ChatIds {
+			chats = append(chats, ListChatsChatData{ChatId: id})
+		}
+		return chats, nil
+	}
+
+	filter := &ListChatsFilter{ChatStatus: params.ChatStatus}
+	chats := []ListChatsChatData{}
+	for offset := int64(0); ; offset += chatArchiveListLimit {
+		resp, err := a.chats.List(ctx, &ListChatsParams{
+			Filter: filter,
+			Limit:  chatArchiveListLimit,
+			Offset: offset,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("list chats: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		for _, chat := range resp.Chats {
+			// Chat has no messages in the date range
+			if !params.Till.IsZero() && chat.CreatedAt.After(params.Till) {
+				continue
+			}
+			chats = append(chats, chat)
+		}
+
+		if len(resp.Chats) < chatArchiveListLimit || offset+chatArchiveListLimit >= resp.TotalChatsCount {
+			break
+		}
+	}
+
+	return chats, nil
+}
+
+func (a *ChatArchiver) archiveChat(ctx context.Context, chat ListChatsChatData, index *ChatArchiveIndex, params *ChatArchiveParams) (*ChatArchiveResult, error) {
+	result := &ChatArchiveResult{ChatId: chat.ChatId}
+	entry := index.Chats[chat.ChatId]
+
+	messages, err := a.fetchMessages(ctx, chat.ChatId, entry.LastMessageId, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return result, nil
+	}
+
+	archive := &ChatArchive{ChatId: chat.ChatId}
+	if entry.LastMessageId != "" {
+		archive, err = a.Chat(chat.ChatId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if chat.ChatType != "" {
+		archive.ChatType = chat.ChatType
+		archive.CreatedAt = chat.CreatedAt
+	}
+
+	dir := a.chatDir(chat.ChatId)
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0o755); err != nil {
+		return nil, err
+	}
+
+	archived := map[string]bool{}
+	for _, message := range archive.Messages {
+		archived[message.MessageId] = true
+	}
+	for _, message := range messages {
+		if archived[message.MessageId] {
+			continue
+		}
+		archived[message.MessageId] = true
+
+		archivedMessage := ArchivedChatMessage{ChatHistoryMessage: message}
+		if a.downloadFiles {
+			archivedMessage.Files, archivedMessage.FileErrors = a.downloadMessageFiles(ctx, dir, message)
+			result.DownloadedFiles += len(archivedMessage.Files)
+			result.FailedFiles += len(archivedMessage.FileErrors)
+		}
+
+		archive.Messages = append(archive.Messages, archivedMessage)
+		result.NewMessages++
+	}
+
+	if err := a.saveJSON(filepath.Join(dir, "messages.json"), archive); err != nil {
+		return nil, err
+	}
+	if err := a.saveTranscript(filepath.Join(dir, "transcript.html"), archive); err != nil {
+		return nil, err
+	}
+
+	index.Chats[chat.ChatId] = ChatArchiveIndexEntry{
+		LastMessageId: archive.Messages[len(archive.Messages)-1].MessageId,
+		MessagesCount: len(archive.Messages),
+		UpdatedAt:     time.Now(),
+	}
+
+	return result, nil
+}
+
+// Returns messages in the date range sorted from old to new.
+// If the chat was archived before, only messages after
+// the last archived one are fetched
+func (a *ChatArchiver) fetchMessages(ctx context.Context, chatId string, lastMessageId string, params *ChatArchiveParams) ([]ChatHistoryMessage, error) {
+	direction := "Backward"
+	if lastMessageId != "" {
+		direction = "Forward"
+	}
+
+	messages := []ChatHistoryMessage{}
+	seen := map[string]bool{lastMessageId: true}
+	from := lastMessageId
+	for {
+		resp, err := a.chats.History(ctx, &ChatHistoryParams{
+			ChatId:        chatId,
+			Direction:     direction,
+			FromMessageId: from,
+			Limit:         chatArchiveHistoryLimit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("chat %s history: %d %s", chatId, resp.StatusCode, resp.Message)
+		}
+
+		done := !resp.HasNext || len(resp.Messages) == 0
+		for _, message := range resp.Messages {
+			if seen[message.MessageId] {
+				continue
+			}
+			seen[message.MessageId] = true
+
+			if !params.Since.IsZero() && message.CreatedAt.Before(params.Since) {
+				// Older messages are not needed when going back in time
+				if direction == "Backward" {
+					done = true
+				}
+				continue
+			}
+			if !params.Till.IsZero() && message.CreatedAt.After(params.Till) {
+				// Newer messages are fetched on the next run
+				if direction == "Forward" {
+					done = true
+				}
+				continue
+			}
+			messages = append(messages, message)
+		}
+		if done {
+			break
+		}
+		from = resp.Messages[len(resp.Messages)-1].MessageId
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		left, _ := strconv.ParseUint(messages[i].MessageId, 10, 64)
+		right, _ := strconv.ParseUint(messages[j].MessageId, 10, 64)
+		return left < right
+	})
+
+	return messages, nil
+}
+
+// Returns paths of downloaded files and errors of failed ones
+func (a *ChatArchiver) downloadMessageFiles(ctx context.Context, dir string, message ChatHistoryMessage) ([]string, []string) {
+	files := []string{}
+	var errs []string
+	for _, data := range message.Data {
+		for _, match := range chatArchiveLinkPattern.FindAllStringSubmatch(data, -1) {
+			link := match[1]
+
+			name := chatArchiveFileNamePattern.ReplaceAllString(path.Base(strings.SplitN(link, "?", 2)[0]), "_")
+			name = filepath.Join("files", message.MessageId+"_"+name)
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				files = append(files, filepath.ToSlash(name))
+				continue
+			}
+
+			if err := a.downloadFile(ctx, link, filepath.Join(dir, name)); err != nil {
+				errs = append(errs, fmt.Sprintf("download %s: %s", link, err))
+				continue
+			}
+			files = append(files, filepath.ToSlash(name))
+		}
+	}
+	return files, errs
+}
+
+func (a *ChatArchiver) downloadFile(ctx context.Context, url string, dst string) error {
+	body, err := a.download(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (a *ChatArchiver) saveJSON(path string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content)
+}
+
+func (a *ChatArchiver) saveTranscript(path string, archive *ChatArchive) error {
+	content := &strings.Builder{}
+	if err := chatTranscriptTemplate.Execute(content, archive); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(content.String()))
+}
+
+func (a *ChatArchiver) chatDir(chatId string) string {
+	return filepath.Join(a.dir, chatArchiveFileNamePattern.ReplaceAllString(chatId, "_"))
+}
+
+// Human readable name of a chat participant type
+func chatUserRole(userType string) string {
+	switch strings.ToLower(userType) {
+	case "customer":
+		return "Customer"
+	case "seller":
+		return "Seller"
+	case "crm":
+		return "System"
+	case "courier":
+		return "Courier"
+	case "support":
+		return "Support"
+	}
+	return userType
+}
+
+var chatTranscriptTemplate = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"role":  chatUserRole,
+	"lower": strings.ToLower,
+	"date": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05 MST")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Chat {{.ChatId}}</title>
+<style>
+body { font-family: sans-serif; max-width: 800px; margin: 0 auto; }
+.message { border-radius: 8px; margin: 8px 0; padding: 8px 12px; background: #f1f1f1; }
+.message.seller { background: #e3f0ff; margin-left: 80px; }
+.message.crm, .message.support { background: #fff6d9; }
+.meta { color: #666; font-size: 12px; }
+.data { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Chat {{.ChatId}}</h1>
+{{if .ChatType}}<p class="meta">{{.ChatType}}, created {{date .CreatedAt}}</p>{{end}}
+{{range .Messages}}<div class="message {{lower .User.Type}}" id="message-{{.MessageId}}">
+<div class="meta">{{role .User.Type}}{{if .User.Id}} {{.User.Id}}{{end}} &middot; {{date .CreatedAt}}{{with .Context}}{{if .OrderNumber}} &middot; order {{.OrderNumber}}{{end}}{{if .SKU}} &middot; SKU {{.SKU}}{{end}}{{end}}</div>
+{{range .Data}}<div class="data">{{.}}</div>
+{{end}}{{range .Files}}<div class="file"><a href="{{.}}">{{.}}</a></div>
+{{end}}{{range .FileErrors}}<div class="file meta">{{.}}</div>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,211 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/diphantxm/ozon-api-client"
+)
+
+func TestChatArchiver(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	history := []ChatHistoryParams{}
+	newMessages := false
+
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var response string
+		switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+		case "/v2/chat/list":
+			response = `{
+				"chats": [
+					{"chat_id": "chat", "chat_type": "Buyer_Seller", "created_at": "2023-01-01T00:00:00Z"},
+					{"chat_id": "future", "chat_type": "Buyer_Seller", "created_at": "2023-03-01T00:00:00Z"}
+				],
+				"total_chats_count": 2
+			}`
+		case "/v3/chat/history":
+			params := ChatHistoryParams{}
+			json.NewDecoder(r.Body).Decode(&params)
+			history = append(history, params)
+
+			switch {
+			case params.Direction == "Backward" && params.FromMessageId == "":
+				response = `{
+					"has_next": true,
+					"messages": [
+						{"created_at": "2023-01-03T00:00:00Z", "data": ["Thank you"], "message_id": "3", "user": {"id": "1", "type": "customer"}},
+						{"created_at": "2023-01-02T00:00:00Z", "data": ["Invoice: [invoice.pdf](https://cdn.ozon.ru/files/invoice.pdf?token=1)"], "message_id": "2", "user": {"id": "2", "type": "seller"}}
+					]
+				}`
+			case params.Direction == "Backward" && params.FromMessageId == "2":
+				response = `{
+					"has_next": false,
+					"messages": [
+						{"context": {"order_number": "123-0001"}, "created_at": "2023-01-01T00:00:00Z", "data": ["Where is <b>my</b> invoice?"], "message_id": "1", "user": {"id": "1", "type": "customer"}}
+					]
+				}`
+			case params.Direction == "Forward" && params.FromMessageId == "3" && newMessages:
+				response = `{
+					"has_next": false,
+					"messages": [
+						{"created_at": "2023-01-04T00:00:00Z", "data": ["Order is delivered"], "message_id": "4", "user": {"id": "0", "type": "crm"}},
+						{"created_at": "2023-02-04T00:00:00Z", "data": ["Out of range"], "message_id": "5", "user": {"id": "1", "type": "customer"}}
+					]
+				}`
+			default:
+				response = `{"has_next": false, "messages": []}`
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(response))
+	})
+
+	downloads := []string{}
+	dir := t.TempDir()
+	archiver := NewChatArchiver(c.Chats(), dir, WithChatFileDownloader(func(ctx context.Context, url string) (io.ReadCloser, error) {
+		downloads = append(downloads, url)
+		return io.NopCloser(strings.NewReader("%PDF-1.4")), nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	params := &ChatArchiveParams{Till: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)}
+	results, err := archiver.Archive(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].NewMessages != 3 || results[0].DownloadedFiles != 1 {
+		t.Errorf("wrong results: %+v", results)
+	}
+
+	archive, err := archiver.Chat("chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, message := range archive.Messages {
+		ids = append(ids, message.MessageId)
+	}
+	if strings.Join(ids, ",") != "1,2,3" || archive.ChatType != "Buyer_Seller" {
+		t.Errorf("wrong archive: %+v", archive)
+	}
+	if len(archive.Messages[1].Files) != 1 || archive.Messages[1].Files[0] != "files/2_invoice.pdf" {
+		t.Errorf("wrong files: %v", archive.Messages[1].Files)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "chat", "files", "2_invoice.pdf")); string(content) != "%PDF-1.4" {
+		t.Errorf("file is not downloaded: %s", content)
+	}
+
+	transcript, err := os.ReadFile(filepath.Join(dir, "chat", "transcript.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Customer 1", "Seller 2", "order 123-0001", "&lt;b&gt;my&lt;/b&gt;", `href="files/2_invoice.pdf"`} {
+		if !strings.Contains(string(transcript), expected) {
+			t.Errorf("transcript must contain %q", expected)
+		}
+	}
+
+	// Only new messages are fetched on re-runs
+	mu.Lock()
+	history = history[:0]
+	newMessages = true
+	mu.Unlock()
+
+	results, err = NewChatArchiver(c.Chats(), dir, WithChatArchiveFiles(false)).Archive(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].NewMessages != 1 {
+		t.Errorf("wrong results: %+v", results)
+	}
+
+	mu.Lock()
+	if len(history) != 1 || history[0].Direction != "Forward" || history[0].FromMessageId != "3" {
+		t.Errorf("history must be fetched from the last archived message, got: %+v", history)
+	}
+	mu.Unlock()
+
+	index, err := archiver.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := index.Chats["chat"]; entry.LastMessageId != "4" || entry.MessagesCount != 4 {
+		t.Errorf("wrong index: %+v", index)
+	}
+
+	transcript, _ = os.ReadFile(filepath.Join(dir, "chat", "transcript.html"))
+	if !strings.Contains(string(transcript), "System 0") || strings.Contains(string(transcript), "Out of range") {
+		t.Errorf("transcript must be updated within the date range")
+	}
+	if len(downloads) != 1 {
+		t.Errorf("files must be downloaded once, got: %v", downloads)
+	}
+}
+
+func TestChatArchiverDownloadFailure(t *testing.T) {
+	t.Parallel()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case DefaultAPIBaseUrl + "/v3/chat/history":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{
+				"has_next": false,
+				"messages": [
+					{"created_at": "2023-01-02T00:00:00Z", "data": ["[photo.jpg](` + DefaultAPIBaseUrl + `/v2/chat/file/photo.jpg) [missing.pdf](https://cdn.example.com/missing.pdf)"], "message_id": "2"},
+					{"created_at": "2023-01-01T00:00:00Z", "data": ["[invoice.pdf](` + DefaultAPIBaseUrl + `/v2/chat/file/invoice.pdf)"], "message_id": "1"}
+				]
+			}`))
+		case DefaultAPIBaseUrl + "/v2/chat/file/photo.jpg", DefaultAPIBaseUrl + "/v2/chat/file/invoice.pdf":
+			if r.Header.Get("Client-Id") != "client" || r.Header.Get("Api-Key") != "key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("content"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	c := NewClient(WithHttpClient(core.NewMockHttpClient(handler)), WithClientId("client"), WithAPIKey("key"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	archiver := NewChatArchiver(c.Chats(), t.TempDir())
+	results, err := archiver.Archive(ctx, &ChatArchiveParams{ChatIds: []string{"chat"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].NewMessages != 2 || results[0].DownloadedFiles != 2 || results[0].FailedFiles != 1 {
+		t.Errorf("wrong results: %+v", results)
+	}
+
+	archive, err := archiver.Chat("chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := archive.Messages[1]
+	if len(message.Files) != 1 || len(message.FileErrors) != 1 || !strings.Contains(message.FileErrors[0], "missing.pdf") {
+		t.Errorf("failed download must be recorded in the message, got: %+v", message)
+	}
+}
@@ -0,0 +1,636 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diphantxm/ozon-api-client/ozon/notifications"
+)
+
+// Incoming chat message passed to chat bot handlers
+type ChatMessage struct {
+	// Chat identifier
+	ChatId string
+
+	// Message identifier
+	MessageId uint64
+
+	// Message creation date
+	CreatedAt time.Time
+
+	// Message text
+	Text string
+
+	// Chat participant identifier
+	UserId string
+
+	// Chat participant type
+	UserType string
+
+	// Product SKU the message is about. 0 if unknown
+	SKU int64
+
+	// Order number the message is about
+	OrderNumber string
+}
+
+// Replies to a chat message. Empty reply is not sent
+type ChatHandler func(ctx context.Context, msg *ChatMessage) (reply string, err error)
+
+// Decides if a handler should process a message
+type ChatMatcher interface {
+	Match(msg *ChatMessage) bool
+}
+
+type ChatMatcherFunc func(msg *ChatMessage) bool
+
+func (f ChatMatcherFunc) Match(msg *ChatMessage) bool {
+	return f(msg)
+}
+
+// Matches messages with text matching the regular expression
+func MatchPattern(pattern *regexp.Regexp) ChatMatcher {
+	return ChatMatcherFunc(func(msg *ChatMessage) bool {
+		return pattern.MatchString(msg.Text)
+	})
+}
+
+// Matches messages containing any of the keywords, case insensitive.
+// Use it to describe intents, for example `MatchKeywords("where", "track", "delivery")`
+func MatchKeywords(keywords ...string) ChatMatcher {
+	lower := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		lower = append(lower, strings.ToLower(keyword))
+	}
+
+	return ChatMatcherFunc(func(msg *ChatMessage) bool {
+		text := strings.ToLower(msg.Text)
+		for _, keyword := range lower {
+			if strings.Contains(text, keyword) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Stores chat cursors and processed messages,
+// so the bot doesn't answer messages again after restart
+type ChatBotStore interface {
+	// Returns the last processed message identifier in the chat. 0 if there is none
+	Cursor(chatId string) (uint64, error)
+
+	// Saves the last processed message identifier in the chat.
+	// Messages up to the cursor are processed
+	SetCursor(chatId string, messageId uint64) error
+
+	// Reports whether the message is already processed or is not after the cursor
+	IsProcessed(chatId string, messageId uint64) (bool, error)
+
+	// Marks the message as processed
+	MarkProcessed(chatId string, messageId uint64) error
+}
+
+type chatBotState struct {
+	Cursors   map[string]uint64          `json:"cursors"`
+	Processed map[string]map[uint64]bool `json:"processed"`
+}
+
+// Keeps chat bot state in memory
+type MemoryChatBotStore struct {
+	mu    sync.Mutex
+	state chatBotState
+}
+
+func NewMemoryChatBotStore() *MemoryChatBotStore {
+	return &MemoryChatBotStore{
+		state: chatBotState{
+			Cursors:   map[string]uint64{},
+			Processed: map[string]map[uint64]bool{},
+		},
+	}
+}
+
+func (s *MemoryChatBotStore) Cursor(chatId string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.Cursors[chatId], nil
+}
+
+func (s *MemoryChatBotStore) SetCursor(chatId string, messageId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if messageId <= s.state.Cursors[chatId] {
+		return nil
+	}
+	s.state.Cursors[chatId] = messageId
+
+	// Messages up to the cursor are processed, so they aren't kept
+	for id := range s.state.Processed[chatId] {
+		if id <= messageId {
+			delete(s.state.Processed[chatId], id)
+		}
+	}
+	if len(s.state.Processed[chatId]) == 0 {
+		delete(s.state.Processed, chatId)
+	}
+	return nil
+}
+
+func (s *MemoryChatBotStore) IsProcessed(chatId string, messageId uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return messageId <= s.state.Cursors[chatId] || s.state.Processed[chatId][messageId], nil
+}
+
+func (s *MemoryChatBotStore) MarkProcessed(chatId string, messageId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Processed[chatId]; !ok {
+		s.state.Processed[chatId] = map[uint64]bool{}
+	}
+	s.state.Processed[chatId][messageId] = true
+	return nil
+}
+
+// Keeps chat bot state in a JSON file. The file is rewritten on each change
+type FileChatBotStore struct {
+	MemoryChatBotStore
+
+	path string
+}
+
+// Opens the store, the file is created on the first change if it doesn't exist
+func NewFileChatBotStore(path string) (*FileChatBotStore, error) {
+	s := &FileChatBotStore{path: path}
+	s.state = chatBotState{
+		Cursors:   map[string]uint64{},
+		Processed: map[string]map[uint64]bool{},
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &s.state); err != nil {
+		return nil, err
+	}
+	if s.state.Cursors == nil {
+		s.state.Cursors = map[string]uint64{}
+	}
+	if s.state.Processed == nil {
+		s.state.Processed = map[string]map[uint64]bool{}
+	}
+
+	return s, nil
+}
+
+func (s *FileChatBotStore) SetCursor(chatId string, messageId uint64) error {
+	if err := s.MemoryChatBotStore.SetCursor(chatId, messageId); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileChatBotStore) MarkProcessed(chatId string, messageId uint64) error {
+	if err := s.MemoryChatBotStore.MarkProcessed(chatId, messageId); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileChatBotStore) save() error {
+	s.mu.Lock()
+	content, err := json.Marshal(s.state)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, content)
+}
+
+type ChatBotOption func(b *ChatBot)
+
+// Store for cursors and processed messages.
+//
+// Default is in-memory store
+func WithChatBotStore(store ChatBotStore) ChatBotOption {
+	return func(b *ChatBot) {
+		b.store = store
+	}
+}
+
+// Minimal interval between replies in one chat.
+//
+// Default is 1 second
+func WithReplyInterval(interval time.Duration) ChatBotOption {
+	return func(b *ChatBot) {
+		b.replyInterval = interval
+	}
+}
+
+// Interval between polling chats for new messages.
+//
+// Default is 10 seconds
+func WithChatPollInterval(interval time.Duration) ChatBotOption {
+	return func(b *ChatBot) {
+		b.pollInterval = interval
+	}
+}
+
+// Types of chat participants whose messages are handled.
+//
+// Default is customer
+func WithChatUserTypes(userTypes ...string) ChatBotOption {
+	return func(b *ChatBot) {
+		b.userTypes = map[string]bool{}
+		for _, userType := range userTypes {
+			b.userTypes[strings.ToLower(userType)] = true
+		}
+	}
+}
+
+// Mark chat messages as read after they are processed. Failures are passed
+// to the error handler, so a message isn't answered again because of them
+func WithMarkAsRead(markAsRead bool) ChatBotOption {
+	return func(b *ChatBot) {
+		b.markAsRead = markAsRead
+	}
+}
+
+// Number of attempts to process a message. The message
+// is marked as processed after the last failed attempt.
+//
+// Default is 3
+func WithChatMessageAttempts(attempts int) ChatBotOption {
+	return func(b *ChatBot) {
+		b.maxAttempts = attempts
+	}
+}
+
+// Callback invoked when polling or marking messages as read fails.
+//
+// By default errors are logged
+func WithChatBotErrorHandler(handler func(err error)) ChatBotOption {
+	return func(b *ChatBot) {
+		b.onError = handler
+	}
+}
+
+type chatRoute struct {
+	matcher ChatMatcher
+	handler ChatHandler
+}
+
+// Replies to chat messages. Messages are received from
+// `TYPE_NEW_MESSAGE` notifications or by polling chats.
+//
+// Each message is passed to the first handler that matches it.
+// Messages are processed once, even if they are received both ways
+type ChatBot struct {
+	chats *Chats
+
+	routes   []chatRoute
+	fallback ChatHandler
+
+	store         ChatBotStore
+	replyInterval time.Duration
+	pollInterval  time.Duration
+	userTypes     map[string]bool
+	markAsRead    bool
+	maxAttempts   int
+	onError       func(err error)
+
+	mu          sync.Mutex
+	chatLocks   map[string]*sync.Mutex
+	lastReplies map[string]time.Time
+	attempts    map[string]int
+}
+
+func NewChatBot(chats *Chats, opts ...ChatBotOption) *ChatBot {
+	b := &ChatBot{
+		chats:         chats,
+		store:         NewMemoryChatBotStore(),
+		replyInterval: time.Second,
+		pollInterval:  10 * time.Second,
+		userTypes:     map[string]bool{"customer": true},
+		maxAttempts:   3,
+		onError: func(err error) {
+			log.Print(err)
+		},
+		chatLocks:   map[string]*sync.Mutex{},
+		lastReplies: map[string]time.Time{},
+		attempts:    map[string]int{},
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Registers a handler for messages matching the matcher.
+// Handlers are checked in the order of registration
+func (b *ChatBot) Handle(matcher ChatMatcher, handler ChatHandler) {
+	b.routes = append(b.routes, chatRoute{matcher: matcher, handler: handler})
+}
+
+// Registers a handler for messages that don't match any other handler
+func (b *ChatBot) HandleDefault(handler ChatHandler) {
+	b.fallback = handler
+}
+
+// Processes a message from `TYPE_NEW_MESSAGE` notification.
+// Can be registered in notifications server
+func (b *ChatBot) HandleNotification(ctx context.Context, notification *notifications.NewMessage) error {
+	messageId, err := strconv.ParseUint(notification.MessageId, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid message id %q: %w", notification.MessageId, err)
+	}
+
+	return b.Process(ctx, &ChatMessage{
+		ChatId:    notification.ChatId,
+		MessageId: messageId,
+		CreatedAt: notification.CreatedAt,
+		Text:      strings.Join(notification.Data, "\n"),
+		UserId:    notification.User.Id,
+		UserType:  notification.User.Type,
+	})
+}
+
+// Polls chats with unread messages until the context is canceled
+func (b *ChatBot) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.Poll(ctx); err != nil && ctx.Err() == nil {
+			b.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Processes new messages in opened chats with unread messages once.
+// A failed chat doesn't stop polling of the others, errors of all chats are joined
+func (b *ChatBot) Poll(ctx context.Context) error {
+	params := &ListChatsParams{
+		Filter: &ListChatsFilter{ChatStatus: "Opened", UnreadOnly: true},
+		Limit:  100,
+	}
+
+	var errs []error
+	for {
+		chats, err := b.chats.List(ctx, params)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if chats.StatusCode != http.StatusOK {
+			return errors.Join(append(errs, fmt.Errorf("list chats: %d %s", chats.StatusCode, chats.Message))...)
+		}
+
+		for _, chat := range chats.Chats {
+			if err := b.pollChat(ctx, chat); err != nil {
+				errs = append(errs, err)
+			}
+			if ctx.Err() != nil {
+				return errors.Join(errs...)
+			}
+		}
+
+		if int64(len(chats.Chats)) < params.Limit {
+			return errors.Join(errs...)
+		}
+		params.Offset += params.Limit
+	}
+}
+
+func (b *ChatBot) pollChat(ctx context.Context, chat ListChatsChatData) error {
+	cursor, err := b.store.Cursor(chat.ChatId)
+	if err != nil {
+		return err
+	}
+	if cursor == 0 && chat.FirstUnreadMessageId > 0 {
+		cursor = chat.FirstUnreadMessageId - 1
+	}
+
+	const limit = 100
+	for {
+		updates, err := b.chats.Update(ctx, &UpdateChatParams{
+			ChatId:        chat.ChatId,
+			FromMessageId: cursor,
+			Limit:         limit,
+		})
+		if err != nil {
+			return err
+		}
+		if updates.StatusCode != http.StatusOK {
+			return fmt.Errorf("update chat %s: %d %s", chat.ChatId, updates.StatusCode, updates.Message)
+		}
+
+		next := cursor
+		var errs []error
+		for _, update := range updates.Result {
+			if update.Type == "text" {
+				err := b.Process(ctx, &ChatMessage{
+					ChatId:      chat.ChatId,
+					MessageId:   update.Id,
+					CreatedAt:   update.CreatedAt,
+					Text:        update.Text,
+					UserId:      update.User.Id,
+					UserType:    update.User.Type,
+					SKU:         update.Context.Item.SKU,
+					OrderNumber: update.Context.Order.OrderNumber,
+				})
+				if err != nil {
+					errs = append(errs, err)
+				}
+				// Later messages wait until the failed one is retried or skipped
+				if err != nil && !b.isSkipped(chat.ChatId, update.Id) {
+					break
+				}
+			}
+			if update.Id > next {
+				next = update.Id
+			}
+		}
+
+		// Cursor is saved once per page, processed messages are saved by Process
+		if next > cursor {
+			if err := b.store.SetCursor(chat.ChatId, next); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 || len(updates.Result) < limit || next == cursor {
+			return errors.Join(errs...)
+		}
+		cursor = next
+	}
+}
+
+// true, if the failed message is marked as processed after the last attempt
+func (b *ChatBot) isSkipped(chatId string, messageId uint64) bool {
+	processed, err := b.store.IsProcessed(chatId, messageId)
+	return err == nil && processed
+}
+
+// Passes the message to the matching handler and sends the reply.
+// Messages that are already processed and messages from other
+// participant types are skipped. A message that fails too many times
+// is marked as processed, so it isn't retried anymore
+func (b *ChatBot) Process(ctx context.Context, msg *ChatMessage) error {
+	lock := b.chatLock(msg.ChatId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	processed, err := b.store.IsProcessed(msg.ChatId, msg.MessageId)
+	if err != nil {
+		return err
+	}
+	if processed {
+		return nil
+	}
+
+	if b.userTypes[strings.ToLower(msg.UserType)] {
+		if err := b.dispatch(ctx, msg); err != nil {
+			err = fmt.Errorf("chat %s, message %d: %w", msg.ChatId, msg.MessageId, err)
+			if b.attempt(msg) < b.maxAttempts {
+				return err
+			}
+			return errors.Join(fmt.Errorf("%w: giving up after %d attempts", err, b.maxAttempts), b.store.MarkProcessed(msg.ChatId, msg.MessageId))
+		}
+	}
+
+	b.mu.Lock()
+	delete(b.attempts, chatMessageKey(msg))
+	b.mu.Unlock()
+
+	return b.store.MarkProcessed(msg.ChatId, msg.MessageId)
+}
+
+// Counts failed attempts to process the message
+func (b *ChatBot) attempt(msg *ChatMessage) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := chatMessageKey(msg)
+	b.attempts[key]++
+	attempts := b.attempts[key]
+	if attempts >= b.maxAttempts {
+		delete(b.attempts, key)
+	}
+	return attempts
+}
+
+func chatMessageKey(msg *ChatMessage) string {
+	return msg.ChatId + ":" + strconv.FormatUint(msg.MessageId, 10)
+}
+
+func (b *ChatBot) dispatch(ctx context.Context, msg *ChatMessage) error {
+	handler := b.fallback
+	for _, route := range b.routes {
+		if route.matcher.Match(msg) {
+			handler = route.handler
+			break
+		}
+	}
+	if handler == nil {
+		return nil
+	}
+
+	reply, err := handler(ctx, msg)
+	if err != nil {
+		return err
+	}
+
+	if reply != "" {
+		if err := b.throttle(ctx, msg.ChatId); err != nil {
+			return err
+		}
+
+		resp, err := b.chats.SendMessage(ctx, &SendMessageParams{ChatId: msg.ChatId, Text: reply})
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("send message: %d %s", resp.StatusCode, resp.Message)
+		}
+	}
+
+	// The reply is already sent, so the message must not be processed again
+	if b.markAsRead {
+		if err := b.markRead(ctx, msg); err != nil {
+			b.onError(fmt.Errorf("chat %s, message %d: %w", msg.ChatId, msg.MessageId, err))
+		}
+	}
+
+	return nil
+}
+
+func (b *ChatBot) markRead(ctx context.Context, msg *ChatMessage) error {
+	resp, err := b.chats.MarkAsRead(ctx, &MarkAsReadParams{ChatId: msg.ChatId, FromMessageId: msg.MessageId})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mark as read: %d %s", resp.StatusCode, resp.Message)
+	}
+	return nil
+}
+
+// Waits until a reply can be sent to the chat
+func (b *ChatBot) throttle(ctx context.Context, chatId string) error {
+	b.mu.Lock()
+	wait := time.Until(b.lastReplies[chatId].Add(b.replyInterval))
+	b.mu.Unlock()
+
+	if wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	b.mu.Lock()
+	b.lastReplies[chatId] = time.Now()
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *ChatBot) chatLock(chatId string) *sync.Mutex {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lock, ok := b.chatLocks[chatId]
+	if !ok {
+		lock = &sync.Mutex{}
+		b.chatLocks[chatId] = lock
+	}
+	return lock
+}
@@ -0,0 +1,341 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diphantxm/ozon-api-client/ozon/notifications"
+)
+
+type chatBotMock struct {
+	mu      sync.Mutex
+	sent    []SendMessageParams
+	sentAt  []time.Time
+	read    []MarkAsReadParams
+	updates []UpdateChatParams
+
+	// Marking messages as read fails
+	failRead bool
+}
+
+func (m *chatBotMock) handler(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var response string
+	switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+	case "/v2/chat/list":
+		response = `{
+			"chats": [
+				{"chat_id": "chat", "chat_status": "Opened", "first_unread_message_id": 10, "unread_count": 3}
+			]
+		}`
+	case "/v1/chat/updates":
+		params := UpdateChatParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+		m.updates = append(m.updates, params)
+		response = `{
+			"result": [
+				{"id": 10, "text": "Where is my order?", "type": "text", "user": {"id": "1", "type": "customer"}},
+				{"id": 11, "text": "Reply from seller", "type": "text", "user": {"id": "2", "type": "seller"}},
+				{"id": 12, "text": "Hello", "type": "text", "user": {"id": "1", "type": "customer"}},
+				{"id": 13, "type": "file", "user": {"id": "1", "type": "customer"}}
+			]
+		}`
+	case "/v1/chat/send/message":
+		params := SendMessageParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+		m.sent = append(m.sent, params)
+		m.sentAt = append(m.sentAt, time.Now())
+		response = `{"result": "success"}`
+	case "/v2/chat/read":
+		if m.failRead {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"code": 13, "message": "internal error"}`))
+			return
+		}
+		params := MarkAsReadParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+		m.read = append(m.read, params)
+		response = `{"unread_count": 0}`
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(response))
+}
+
+func newTestChatBot(c *Client, opts ...ChatBotOption) *ChatBot {
+	bot := NewChatBot(c.Chats(), opts...)
+	bot.Handle(MatchKeywords("where", "track"), func(ctx context.Context, msg *ChatMessage) (string, error) {
+		return "Your order is on the way", nil
+	})
+	bot.Handle(MatchPattern(regexp.MustCompile(`(?i)^(hi|hello)`)), func(ctx context.Context, msg *ChatMessage) (string, error) {
+		return "Hello!", nil
+	})
+	bot.HandleDefault(func(ctx context.Context, msg *ChatMessage) (string, error) {
+		return "We will answer soon", nil
+	})
+	return bot
+}
+
+func TestChatBotPoll(t *testing.T) {
+	t.Parallel()
+
+	mock := &chatBotMock{}
+	c := NewMockClient(mock.handler)
+
+	store, err := NewFileChatBotStore(filepath.Join(t.TempDir(), "chatbot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot := newTestChatBot(c, WithChatBotStore(store), WithReplyInterval(50*time.Millisecond), WithMarkAsRead(true))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	if err := bot.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.mu.Lock()
+	if len(mock.updates) != 1 || mock.updates[0].FromMessageId != 9 {
+		t.Errorf("chat must be updated from the first unread message, got: %+v", mock.updates)
+	}
+	if len(mock.sent) != 2 {
+		t.Fatalf("expected 2 replies, got: %+v", mock.sent)
+	}
+	if mock.sent[0].Text != "Your order is on the way" || mock.sent[1].Text != "Hello!" {
+		t.Errorf("wrong replies: %+v", mock.sent)
+	}
+	if interval := mock.sentAt[1].Sub(mock.sentAt[0]); interval < 50*time.Millisecond {
+		t.Errorf("replies must be throttled, got interval: %s", interval)
+	}
+	if len(mock.read) != 2 || mock.read[1].FromMessageId != 12 {
+		t.Errorf("messages must be marked as read, got: %+v", mock.read)
+	}
+	mock.mu.Unlock()
+
+	cursor, _ := store.Cursor("chat")
+	if cursor != 13 {
+		t.Errorf("expected cursor 13, got: %d", cursor)
+	}
+
+	// Messages are not answered again after restart
+	store, err = NewFileChatBotStore(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot = newTestChatBot(c, WithChatBotStore(store))
+	if err := bot.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	err = bot.HandleNotification(ctx, &notifications.NewMessage{
+		ChatId:    "chat",
+		MessageId: "10",
+		User:      notifications.User{Id: "1", Type: "Customer"},
+		Data:      []string{"Where is my order?"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.updates) != 2 || mock.updates[1].FromMessageId != 13 {
+		t.Errorf("chat must be updated from the cursor, got: %+v", mock.updates)
+	}
+	if len(mock.sent) != 2 {
+		t.Errorf("processed messages must not be answered again, got: %+v", mock.sent)
+	}
+}
+
+func TestChatBotNotification(t *testing.T) {
+	t.Parallel()
+
+	mock := &chatBotMock{}
+	c := NewMockClient(mock.handler)
+	bot := newTestChatBot(c, WithReplyInterval(0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	err := bot.HandleNotification(ctx, &notifications.NewMessage{
+		ChatId:    "other",
+		MessageId: "100",
+		User:      notifications.User{Id: "1", Type: "Customer"},
+		Data:      []string{"Is it available in red?"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = bot.HandleNotification(ctx, &notifications.NewMessage{
+		ChatId:    "other",
+		MessageId: "invalid",
+	})
+	if err == nil {
+		t.Errorf("expected error for invalid message id")
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.sent) != 1 || mock.sent[0].Text != "We will answer soon" || mock.sent[0].ChatId != "other" {
+		t.Errorf("message must be answered by the default handler, got: %+v", mock.sent)
+	}
+}
+
+func TestChatBotMarkAsReadFailed(t *testing.T) {
+	t.Parallel()
+
+	mock := &chatBotMock{failRead: true}
+	c := NewMockClient(mock.handler)
+
+	var errs []error
+	bot := newTestChatBot(c, WithReplyInterval(0), WithMarkAsRead(true), WithChatBotErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	notification := &notifications.NewMessage{
+		ChatId:    "chat",
+		MessageId: "100",
+		User:      notifications.User{Id: "1", Type: "Customer"},
+		Data:      []string{"Hello"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := bot.HandleNotification(ctx, notification); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.sent) != 1 {
+		t.Errorf("message must be answered once, got: %+v", mock.sent)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "mark as read") {
+		t.Errorf("mark as read error must be reported, got: %v", errs)
+	}
+}
+
+func TestChatBotPollFailedMessage(t *testing.T) {
+	t.Parallel()
+
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		var response string
+		switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+		case "/v2/chat/list":
+			response = `{"chats": [{"chat_id": "first"}, {"chat_id": "second"}]}`
+		case "/v1/chat/updates":
+			params := UpdateChatParams{}
+			json.NewDecoder(r.Body).Decode(&params)
+			response = `{"result": [
+				{"id": 1, "text": "fail", "type": "text", "user": {"type": "customer"}},
+				{"id": 2, "text": "ok", "type": "text", "user": {"type": "customer"}}
+			]}`
+			if params.FromMessageId >= 2 {
+				response = `{"result": []}`
+			}
+		case "/v1/chat/send/message":
+			response = `{"result": "success"}`
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(response))
+	})
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+	bot := NewChatBot(c.Chats(), WithReplyInterval(0), WithChatMessageAttempts(2))
+	bot.HandleDefault(func(ctx context.Context, msg *ChatMessage) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		handled[msg.ChatId+":"+msg.Text]++
+		if msg.ChatId == "first" && msg.Text == "fail" {
+			return "", errors.New("handler failed")
+		}
+		return "reply", nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// The failed message is retried before the later ones, other chats are polled
+	if err := bot.Poll(ctx); err == nil || !strings.Contains(err.Error(), "chat first, message 1") {
+		t.Errorf("error of the failed message must be returned, got: %v", err)
+	}
+	mu.Lock()
+	if handled["first:ok"] != 0 || handled["second:fail"] != 1 || handled["second:ok"] != 1 {
+		t.Errorf("wrong handled messages after the first poll: %v", handled)
+	}
+	mu.Unlock()
+
+	// The message is skipped after the last attempt
+	if err := bot.Poll(ctx); err == nil || !strings.Contains(err.Error(), "giving up") {
+		t.Errorf("expected giving up error, got: %v", err)
+	}
+	if err := bot.Poll(ctx); err != nil {
+		t.Errorf("skipped message must not be retried, got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if handled["first:fail"] != 2 || handled["first:ok"] != 1 {
+		t.Errorf("wrong handled messages: %v", handled)
+	}
+	if cursor, _ := bot.store.Cursor("first"); cursor != 2 {
+		t.Errorf("expected cursor 2, got: %d", cursor)
+	}
+}
+
+func TestFileChatBotStorePrune(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "chatbot.json")
+	store, err := NewFileChatBotStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []uint64{1, 2, 5} {
+		if err := store.MarkProcessed("chat", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetCursor("chat", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewFileChatBotStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.state.Processed["chat"]) != 1 || !store.state.Processed["chat"][5] {
+		t.Errorf("messages up to the cursor must be pruned, got: %v", store.state.Processed)
+	}
+	for _, id := range []uint64{1, 3, 5} {
+		if processed, _ := store.IsProcessed("chat", id); !processed {
+			t.Errorf("message %d must be processed", id)
+		}
+	}
+	if processed, _ := store.IsProcessed("chat", 4); processed {
+		t.Errorf("message after the cursor must not be processed")
+	}
+}
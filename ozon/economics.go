@@ -0,0 +1,357 @@
+package ozon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+type FulfilmentScheme string
+
+const (
+	FulfilmentSchemeFBO FulfilmentScheme = "FBO"
+	FulfilmentSchemeFBS FulfilmentScheme = "FBS"
+)
+
+// Per-unit costs of selling a product under one fulfilment scheme
+type SchemeCosts struct {
+	// Sales commission percentage
+	CommissionPercent float64 `json:"commission_percent"`
+
+	// Acquiring fee percentage
+	AcquiringPercent float64 `json:"acquiring_percent"`
+
+	// Fixed logistics costs: shipment processing, pipeline and last mile
+	Logistics float64 `json:"logistics"`
+}
+
+// Calculates margin, breakeven price and target price of a product
+// under each fulfilment scheme.
+//
+// Profit for a price P is calculated as
+//
+//	P - VAT(P) - P * (commission + acquiring) / 100 - logistics - cost price
+//
+// where VAT(P) is the VAT included in the price
+type UnitEconomicsCalculator struct {
+	// Product identifier
+	ProductId int64 `json:"product_id"`
+
+	// Product identifier in the seller's system
+	OfferId string `json:"offer_id"`
+
+	// Current product price
+	Price float64 `json:"price"`
+
+	// Cost price of a unit, specified by the seller
+	CostPrice float64 `json:"cost_price"`
+
+	// VAT rate, for example 0.2
+	VATRate float64 `json:"vat_rate"`
+
+	// Costs for each fulfilment scheme
+	Schemes map[FulfilmentScheme]SchemeCosts `json:"schemes"`
+}
+
+// Creates a calculator from product price information.
+// VAT rate is taken from the product price if vat is empty
+func NewUnitEconomicsCalculator(item *GetProductPriceInfoResultItem, costPrice float64, vat VAT) (*UnitEconomicsCalculator, error) {
+	vatRate := item.Price.VAT
+	if vat != "" {
+		rate, err := strconv.ParseFloat(string(vat), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vat rate %q: %w", vat, err)
+		}
+		vatRate = rate
+	}
+
+	// Acquiring is returned as an amount for the current price,
+	// convert it to percentage so it can be applied to any price
+	var acquiringPercent float64
+	if item.Price.Price > 0 {
+		acquiringPercent = item.Acquiring / item.Price.Price * 100
+	}
+
+	commissions := item.Commissions
+	return &UnitEconomicsCalculator{
+		ProductId: item.ProductId,
+		OfferId:   item.OfferId,
+		Price:     item.Price.Price,
+		CostPrice: costPrice,
+		VATRate:   vatRate,
+		Schemes: map[FulfilmentScheme]SchemeCosts{
+			FulfilmentSchemeFBO: {
+				CommissionPercent: commissions.SalesCommissionFBORate,
+				AcquiringPercent:  acquiringPercent,
+				Logistics:         commissions.FBOOrderPackagingFee + commissions.FBOPipelineTo + commissions.FBOLastMile,
+			},
+			FulfilmentSchemeFBS: {
+				CommissionPercent: commissions.SalesCommissionFBSRate,
+				AcquiringPercent:  acquiringPercent,
+				Logistics:         commissions.FBSShipmentProcessingFromFee + commissions.FBSPipelineTo + commissions.FBSLastMile,
+			},
+		},
+	}, nil
+}
+
+// Creates a calculator for an economy product MOQ.
+// Cost price is multiplied by MOQ size, logistics costs are charged once per MOQ
+func (c *UnitEconomicsCalculator) ForQuant(quant *EconomyInfoItemQuant) (*UnitEconomicsCalculator, error) {
+	price, err := strconv.ParseFloat(quant.Price, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price of quant %s: %w", quant.QuantCode, err)
+	}
+
+	size := quant.QuantSize
+	if size <= 0 {
+		size = 1
+	}
+
+	schemes := make(map[FulfilmentScheme]SchemeCosts, len(c.Schemes))
+	for scheme, costs := range c.Schemes {
+		schemes[scheme] = costs
+	}
+
+	return &UnitEconomicsCalculator{
+		ProductId: c.ProductId,
+		OfferId:   c.OfferId,
+		Price:     price,
+		CostPrice: c.CostPrice * float64(size),
+		VATRate:   c.VATRate,
+		Schemes:   schemes,
+	}, nil
+}
+
+func (c *UnitEconomicsCalculator) costs(scheme FulfilmentScheme) (SchemeCosts, error) {
+	costs, ok := c.Schemes[scheme]
+	if !ok {
+		return SchemeCosts{}, fmt.Errorf("unknown fulfilment scheme: %s", scheme)
+	}
+	return costs, nil
+}
+
+// Share of the price left after VAT, commission and acquiring
+func (c *UnitEconomicsCalculator) revenueRate(costs SchemeCosts) float64 {
+	return 1/(1+c.VATRate) - (costs.CommissionPercent+costs.AcquiringPercent)/100
+}
+
+// Costs that don't depend on the price
+func (c *UnitEconomicsCalculator) fixedCosts(costs SchemeCosts) float64 {
+	return costs.Logistics + c.CostPrice
+}
+
+// Profit from selling a unit at the price
+func (c *UnitEconomicsCalculator) Profit(scheme FulfilmentScheme, price float64) (float64, error) {
+	costs, err := c.costs(scheme)
+	if err != nil {
+		return 0, err
+	}
+
+	return price*c.revenueRate(costs) - c.fixedCosts(costs), nil
+}
+
+// Profit as a share of the price
+func (c *UnitEconomicsCalculator) Margin(scheme FulfilmentScheme, price float64) (float64, error) {
+	if price <= 0 {
+		return 0, fmt.Errorf("price must be positive: %f", price)
+	}
+
+	profit, err := c.Profit(scheme, price)
+	if err != nil {
+		return 0, err
+	}
+
+	return profit / price, nil
+}
+
+// Minimum price at which selling a unit doesn't bring a loss
+func (c *UnitEconomicsCalculator) BreakevenPrice(scheme FulfilmentScheme) (float64, error) {
+	return c.PriceForMargin(scheme, 0)
+}
+
+// Price needed to get the target margin, for example 0.25 for 25%
+func (c *UnitEconomicsCalculator) PriceForMargin(scheme FulfilmentScheme, margin float64) (float64, error) {
+	costs, err := c.costs(scheme)
+	if err != nil {
+		return 0, err
+	}
+
+	rate := c.revenueRate(costs) - margin
+	if rate <= 0 {
+		return 0, fmt.Errorf("margin %f is unreachable for %s scheme", margin, scheme)
+	}
+
+	return c.fixedCosts(costs) / rate, nil
+}
+
+// Reports whether selling a unit at the price gives at least the target margin
+func (c *UnitEconomicsCalculator) IsProfitable(scheme FulfilmentScheme, price, margin float64) (bool, error) {
+	actual, err := c.Margin(scheme, price)
+	if err != nil {
+		return false, err
+	}
+
+	return actual >= margin, nil
+}
+
+// Calculates unit economics for the current price under each scheme
+func (c *UnitEconomicsCalculator) Calculate(targetMargin float64) []UnitEconomics {
+	result := make([]UnitEconomics, 0, len(c.Schemes))
+	for _, scheme := range []FulfilmentScheme{FulfilmentSchemeFBO, FulfilmentSchemeFBS} {
+		if _, ok := c.Schemes[scheme]; !ok {
+			continue
+		}
+
+		economics := UnitEconomics{
+			ProductId: c.ProductId,
+			OfferId:   c.OfferId,
+			Scheme:    scheme,
+			Price:     c.Price,
+		}
+		economics.Profit, _ = c.Profit(scheme, c.Price)
+		if c.Price > 0 {
+			economics.Margin, _ = c.Margin(scheme, c.Price)
+		}
+		economics.BreakevenPrice, _ = c.BreakevenPrice(scheme)
+		economics.TargetPrice, _ = c.PriceForMargin(scheme, targetMargin)
+
+		result = append(result, economics)
+	}
+
+	return result
+}
+
+type UnitEconomics struct {
+	// Product identifier
+	ProductId int64 `json:"product_id"`
+
+	// Product identifier in the seller's system
+	OfferId string `json:"offer_id"`
+
+	// Economy product identifier. Empty for regular products
+	QuantCode string `json:"quant_code"`
+
+	// Fulfilment scheme
+	Scheme FulfilmentScheme `json:"scheme"`
+
+	// Current product price
+	Price float64 `json:"price"`
+
+	// Profit from selling a unit at the current price
+	Profit float64 `json:"profit"`
+
+	// Profit as a share of the current price
+	Margin float64 `json:"margin"`
+
+	// Minimum price at which selling a unit doesn't bring a loss.
+	// 0 if costs can't be covered at any price
+	BreakevenPrice float64 `json:"breakeven_price"`
+
+	// Price needed to get the target margin.
+	// 0 if the target margin is unreachable
+	TargetPrice float64 `json:"target_price"`
+}
+
+type GetUnitEconomicsParams struct {
+	// Cost prices of units by product identifier in the seller's system
+	CostPrices map[string]float64
+
+	// VAT rate. If empty, VAT rate of the product price is used
+	VAT VAT
+
+	// Target margin, for example 0.25 for 25%
+	TargetMargin float64
+
+	// Economy products identifiers to calculate unit economics for MOQs
+	QuantCodes []string
+}
+
+type GetUnitEconomicsResponse struct {
+	// Unit economics of products and MOQs
+	Items []UnitEconomics
+
+	// Calculators for products by product identifier in the seller's system
+	Calculators map[string]*UnitEconomicsCalculator
+}
+
+// Calculates unit economics for products with known cost prices
+// using their commissions and prices. Economy products are calculated
+// for each MOQ if their codes are passed
+func (c Products) GetUnitEconomics(ctx context.Context, params *GetUnitEconomicsParams) (*GetUnitEconomicsResponse, error) {
+	result := &GetUnitEconomicsResponse{
+		Calculators: map[string]*UnitEconomicsCalculator{},
+	}
+	if len(params.CostPrices) == 0 {
+		return result, nil
+	}
+
+	offerIds := make([]string, 0, len(params.CostPrices))
+	for offerId := range params.CostPrices {
+		offerIds = append(offerIds, offerId)
+	}
+
+	priceParams := &GetProductPriceInfoParams{
+		Filter: GetProductPriceInfoFilter{OfferId: offerIds},
+		Limit:  1000,
+	}
+	for {
+		resp, err := c.GetProductPriceInfo(ctx, priceParams)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("get product price info: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		for i := range resp.Items {
+			item := &resp.Items[i]
+
+			calculator, err := NewUnitEconomicsCalculator(item, params.CostPrices[item.OfferId], params.VAT)
+			if err != nil {
+				return nil, err
+			}
+			result.Calculators[item.OfferId] = calculator
+			result.Items = append(result.Items, calculator.Calculate(params.TargetMargin)...)
+		}
+
+		if resp.Cursor == "" || len(resp.Items) == 0 {
+			break
+		}
+		priceParams.Cursor = resp.Cursor
+	}
+
+	if len(params.QuantCodes) == 0 {
+		return result, nil
+	}
+
+	quants, err := c.EconomyInfo(ctx, &GetEconomyInfoParams{QuantCode: params.QuantCodes})
+	if err != nil {
+		return nil, err
+	}
+	if quants.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get economy info: %d %s", quants.StatusCode, quants.Message)
+	}
+
+	for _, item := range quants.Items {
+		calculator, ok := result.Calculators[item.OfferId]
+		if !ok {
+			continue
+		}
+
+		for i := range item.QuantInfo.Quants {
+			quant := &item.QuantInfo.Quants[i]
+
+			quantCalculator, err := calculator.ForQuant(quant)
+			if err != nil {
+				return nil, err
+			}
+			for _, economics := range quantCalculator.Calculate(params.TargetMargin) {
+				economics.QuantCode = quant.QuantCode
+				result.Items = append(result.Items, economics)
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,193 @@
+package ozon
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+
+	core "github.com/diphantxm/ozon-api-client"
+)
+
+func TestUnitEconomicsCalculator(t *testing.T) {
+	t.Parallel()
+
+	item := &GetProductPriceInfoResultItem{
+		Acquiring: 15,
+		Commissions: GetProductPriceInfoResultItemCommission{
+			FBOLastMile:                  30,
+			FBOPipelineTo:                20,
+			FBOOrderPackagingFee:         50,
+			FBSLastMile:                  30,
+			FBSPipelineTo:                40,
+			FBSShipmentProcessingFromFee: 25,
+			SalesCommissionFBORate:       10,
+			SalesCommissionFBSRate:       12,
+		},
+		OfferId:   "offer",
+		ProductId: 1,
+		Price:     GetProductPriceInfoResultItemPrice{Price: 1000, VAT: 0.1},
+	}
+
+	calculator, err := NewUnitEconomicsCalculator(item, 400, VAT02)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		scheme    FulfilmentScheme
+		profit    float64
+		breakeven float64
+		target    float64
+	}{
+		{
+			FulfilmentSchemeFBO,
+			1000*(1/1.2-0.115) - 500,
+			500 / (1/1.2 - 0.115),
+			500 / (1/1.2 - 0.115 - 0.25),
+		},
+		{
+			FulfilmentSchemeFBS,
+			1000*(1/1.2-0.135) - 495,
+			495 / (1/1.2 - 0.135),
+			495 / (1/1.2 - 0.135 - 0.25),
+		},
+	}
+
+	for _, test := range tests {
+		profit, err := calculator.Profit(test.scheme, 1000)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !almostEqual(profit, test.profit) {
+			t.Errorf("wrong profit for %s: got: %f, expected: %f", test.scheme, profit, test.profit)
+		}
+
+		breakeven, err := calculator.BreakevenPrice(test.scheme)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !almostEqual(breakeven, test.breakeven) {
+			t.Errorf("wrong breakeven price for %s: got: %f, expected: %f", test.scheme, breakeven, test.breakeven)
+		}
+		if profit, _ := calculator.Profit(test.scheme, breakeven); !almostEqual(profit, 0) {
+			t.Errorf("profit at breakeven price must be 0, got: %f", profit)
+		}
+
+		target, err := calculator.PriceForMargin(test.scheme, 0.25)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !almostEqual(target, test.target) {
+			t.Errorf("wrong target price for %s: got: %f, expected: %f", test.scheme, target, test.target)
+		}
+		if margin, _ := calculator.Margin(test.scheme, target); !almostEqual(margin, 0.25) {
+			t.Errorf("margin at target price must be 0.25, got: %f", margin)
+		}
+	}
+
+	if _, err := calculator.PriceForMargin(FulfilmentSchemeFBO, 0.9); err == nil {
+		t.Errorf("expected error for unreachable margin")
+	}
+	if _, err := calculator.Profit("unknown", 1000); err == nil {
+		t.Errorf("expected error for unknown scheme")
+	}
+
+	quantCalculator, err := calculator.ForQuant(&EconomyInfoItemQuant{Price: "3000", QuantSize: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	profit, _ := quantCalculator.Profit(FulfilmentSchemeFBO, 3000)
+	if expected := 3000*(1/1.2-0.115) - 2100; !almostEqual(profit, expected) {
+		t.Errorf("wrong quant profit: got: %f, expected: %f", profit, expected)
+	}
+}
+
+func TestGetUnitEconomics(t *testing.T) {
+	t.Parallel()
+
+	c := NewMockClient(newMockRouter(map[string]string{
+		"/v5/product/info/prices": `{
+			"items": [
+				{
+					"acquiring": 10,
+					"commissions": {
+						"fbo_deliv_to_customer_amount": 30,
+						"fbo_direct_flow_trans_max_amount": 20,
+						"fbo_fulfillment_amount": 50,
+						"fbs_deliv_to_customer_amount": 30,
+						"fbs_direct_flow_trans_max_amount": 20,
+						"fbs_first_mile_max_amount": 25,
+						"sales_percent_fbo": 10,
+						"sales_percent_fbs": 12
+					},
+					"offer_id": "offer",
+					"price": {
+						"price": 1000,
+						"vat": 0.2
+					},
+					"product_id": 1
+				}
+			],
+			"cursor": "",
+			"total": 1
+		}`,
+		"/v1/product/quant/info": `{
+			"items": [
+				{
+					"offer_id": "offer",
+					"product_id": 1,
+					"quant_info": {
+						"quants": [
+							{
+								"price": "4500",
+								"quant_code": "quant",
+								"quant_sice": 5
+							}
+						]
+					}
+				}
+			]
+		}`,
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	resp, err := c.Products().GetUnitEconomics(ctx, &GetUnitEconomicsParams{
+		CostPrices:   map[string]float64{"offer": 400},
+		TargetMargin: 0.2,
+		QuantCodes:   []string{"quant"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Items) != 4 {
+		t.Fatalf("expected 4 items, got: %d", len(resp.Items))
+	}
+	if resp.Items[0].Scheme != FulfilmentSchemeFBO || resp.Items[0].QuantCode != "" {
+		t.Errorf("first item must be FBO economics of a product, got: %+v", resp.Items[0])
+	}
+	if resp.Items[2].QuantCode != "quant" || resp.Items[2].Price != 4500 {
+		t.Errorf("third item must be economics of a quant, got: %+v", resp.Items[2])
+	}
+	if resp.Items[0].Margin <= 0 || resp.Items[0].BreakevenPrice >= 1000 {
+		t.Errorf("product must be profitable, got: %+v", resp.Items[0])
+	}
+	if _, ok := resp.Calculators["offer"]; !ok {
+		t.Errorf("calculator for offer is absent")
+	}
+
+	c = NewMockClient(core.NewMockHttpHandler(http.StatusUnauthorized, `{"code": 16, "message": "Client-Id and Api-Key headers are required"}`, nil))
+	if _, err := c.Products().GetUnitEconomics(ctx, &GetUnitEconomicsParams{CostPrices: map[string]float64{"offer": 400}}); err == nil {
+		t.Errorf("expected error for unauthorized request")
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
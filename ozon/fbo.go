@@ -1042,6 +1042,44 @@ func (c FBO) CreateSupplyFromDraft(ctx context.Context, params *CreateSupplyFrom
 	return resp, nil
 }
 
+type GetSupplyFromDraftStatusParams struct {
+	// Identifier of the supply request creation operation
+	OperationId string `json:"operation_id"`
+}
+
+type GetSupplyFromDraftStatusResponse struct {
+	core.CommonResponse
+
+	// Errors
+	ErrorMessages []string `json:"error_messages"`
+
+	// Operation result
+	Result GetSupplyFromDraftStatusResult `json:"result"`
+
+	// Request creation status
+	Status string `json:"status"`
+}
+
+type GetSupplyFromDraftStatusResult struct {
+	// Supply requests identifiers
+	OrderIds []int64 `json:"order_ids"`
+}
+
+// Get status of supply request creation from a draft
+func (c FBO) GetSupplyFromDraftStatus(ctx context.Context, params *GetSupplyFromDraftStatusParams) (*GetSupplyFromDraftStatusResponse, error) {
+	url := "/v1/draft/supply/create/status"
+
+	resp := &GetSupplyFromDraftStatusResponse{}
+
+	response, err := c.client.Request(ctx, http.MethodGet, url, params, resp, nil)
+	if err != nil {
+		return nil, err
+	}
+	response.CopyCommonResponse(&resp.CommonResponse)
+
+	return resp, nil
+}
+
 type GetDraftTimeslotsParams struct {
 	// Start date of the available supply time slots period
 	DateFrom time.Time `json:"date_from"`
@@ -1151,6 +1151,65 @@ func TestCreateSupplyFromDraft(t *testing.T) {
 	}
 }
 
+func TestGetSupplyFromDraftStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		statusCode int
+		headers    map[string]string
+		params     *GetSupplyFromDraftStatusParams
+		response   string
+	}{
+		// Test Ok
+		{
+			http.StatusOK,
+			map[string]string{"Client-Id": "my-client-id", "Api-Key": "my-api-key"},
+			&GetSupplyFromDraftStatusParams{
+				OperationId: "string",
+			},
+			`{
+				"error_messages": [
+					"string"
+				],
+				"result": {
+					"order_ids": [
+						0
+					]
+				},
+				"status": "DraftSupplyCreateStatusUnknown"
+			}`,
+		},
+		// Test No Client-Id or Api-Key
+		{
+			http.StatusUnauthorized,
+			map[string]string{},
+			&GetSupplyFromDraftStatusParams{},
+			`{
+				"code": 16,
+				"message": "Client-Id and Api-Key headers are required"
+			}`,
+		},
+	}
+
+	for _, test := range tests {
+		c := NewMockClient(core.NewMockHttpHandler(test.statusCode, test.response, test.headers))
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		resp, err := c.FBO().GetSupplyFromDraftStatus(ctx, test.params)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		compareJsonResponse(t, test.response, &GetSupplyFromDraftStatusResponse{})
+
+		if resp.StatusCode != test.statusCode {
+			t.Errorf("got wrong status code: got: %d, expected: %d", resp.StatusCode, test.statusCode)
+		}
+	}
+}
+
 func TestGetDraftTimeslots(t *testing.T) {
 	t.Parallel()
 
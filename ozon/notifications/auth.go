@@ -0,0 +1,210 @@
+package notifications
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	// Request is sent from an address which is not allowed
+	ErrSourceNotAllowed = errors.New("source address is not allowed")
+
+	// Request has invalid or no credentials
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// Checks a notification request before its body is read.
+// Requests are rejected with 403 status code for ErrSourceNotAllowed
+// and with 401 status code for other errors
+type Authenticator interface {
+	Authenticate(r *http.Request) error
+}
+
+type AuthenticatorFunc func(r *http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) error {
+	return f(r)
+}
+
+// Allows requests only from the networks. If the request comes from
+// a trusted proxy, the client address is taken from X-Forwarded-For.
+// Ozon addresses are not built in, use the ranges from your Ozon
+// notification settings or from Ozon support
+type IPAllowlist struct {
+	networks       []*net.IPNet
+	trustedProxies []*net.IPNet
+}
+
+// Creates the allowlist from networks in CIDR notation or single addresses.
+// X-Forwarded-For is ignored if there are no trusted proxies
+func NewIPAllowlist(networks []string, trustedProxies []string) (*IPAllowlist, error) {
+	allowed, err := parseNetworks(networks)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := parseNetworks(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IPAllowlist{
+		networks:       allowed,
+		trustedProxies: proxies,
+	}, nil
+}
+
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *IPAllowlist) Authenticate(r *http.Request) error {
+	ip := a.ClientIP(r)
+	if ip == nil || !containsIP(a.networks, ip) {
+		return fmt.Errorf("%w: %s", ErrSourceNotAllowed, ip)
+	}
+	return nil
+}
+
+// Returns the client address. X-Forwarded-For is read from right to left
+// while addresses belong to trusted proxies, so clients can't spoof it
+func (a *IPAllowlist) ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(a.trustedProxies, ip) {
+		return ip
+	}
+
+	forwarded := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		forwardedIP := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if forwardedIP == nil {
+			return nil
+		}
+		ip = forwardedIP
+		if !containsIP(a.trustedProxies, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// Requires the header to contain the secret. Requests are rejected
+// if the secret is empty, so a missing secret doesn't leave the endpoint open
+type SharedSecret struct {
+	// Header name
+	Header string
+
+	// Expected header value
+	Secret string
+}
+
+// Creates the authenticator. Header and secret must not be empty
+func NewSharedSecret(header, secret string) (*SharedSecret, error) {
+	if header == "" {
+		return nil, errors.New("header name is empty")
+	}
+	if secret == "" {
+		return nil, errors.New("secret is empty")
+	}
+	return &SharedSecret{Header: header, Secret: secret}, nil
+}
+
+func (a *SharedSecret) Authenticate(r *http.Request) error {
+	if a.Secret == "" {
+		return fmt.Errorf("%w: secret is not configured", ErrUnauthorized)
+	}
+	if !secureEqual(r.Header.Get(a.Header), a.Secret) {
+		return fmt.Errorf("%w: invalid %s header", ErrUnauthorized, a.Header)
+	}
+	return nil
+}
+
+// Requires HTTP basic authentication. Requests are rejected if the username
+// or the password is empty, so missing credentials don't leave the endpoint open
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Creates the authenticator. Username and password must not be empty
+func NewBasicAuth(username, password string) (*BasicAuth, error) {
+	if username == "" {
+		return nil, errors.New("username is empty")
+	}
+	if password == "" {
+		return nil, errors.New("password is empty")
+	}
+	return &BasicAuth{Username: username, Password: password}, nil
+}
+
+func (a *BasicAuth) Authenticate(r *http.Request) error {
+	if a.Username == "" || a.Password == "" {
+		return fmt.Errorf("%w: basic auth credentials are not configured", ErrUnauthorized)
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return fmt.Errorf("%w: no basic auth credentials", ErrUnauthorized)
+	}
+	// Both are compared to not leak which one is wrong
+	usernameOk := secureEqual(username, a.Username)
+	passwordOk := secureEqual(password, a.Password)
+	if !usernameOk || !passwordOk {
+		return fmt.Errorf("%w: invalid basic auth credentials", ErrUnauthorized)
+	}
+	return nil
+}
+
+func secureEqual(got, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
+
+// Runs authenticators in order. Returns the first error
+func (ns *NotificationServer) authenticate(r *http.Request) error {
+	for _, authenticator := range ns.authenticators {
+		if err := authenticator.Authenticate(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
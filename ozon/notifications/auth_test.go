@@ -0,0 +1,143 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIPAllowlist(t *testing.T) {
+	allowlist, err := NewIPAllowlist([]string{"195.34.21.0/24", "2001:db8::1"}, []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		remoteAddr string
+		forwarded  []string
+		allowed    bool
+	}{
+		{"195.34.21.7:4000", nil, true},
+		{"[2001:db8::1]:4000", nil, true},
+		{"8.8.8.8:4000", nil, false},
+		// Forwarded header is ignored for untrusted sources
+		{"8.8.8.8:4000", []string{"195.34.21.7"}, false},
+		{"10.0.0.1:4000", []string{"195.34.21.7"}, true},
+		{"10.0.0.1:4000", []string{"195.34.21.7, 10.0.0.2"}, true},
+		{"10.0.0.1:4000", []string{"195.34.21.7", "10.0.0.2"}, true},
+		// Spoofed address on the left is not used
+		{"10.0.0.1:4000", []string{"195.34.21.7, 8.8.8.8"}, false},
+		{"10.0.0.1:4000", []string{"garbage"}, false},
+		{"10.0.0.1:4000", nil, false},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = testCase.remoteAddr
+		for _, forwarded := range testCase.forwarded {
+			req.Header.Add("X-Forwarded-For", forwarded)
+		}
+
+		err := allowlist.Authenticate(req)
+		if testCase.allowed && err != nil {
+			t.Errorf("%s %v must be allowed: %s", testCase.remoteAddr, testCase.forwarded, err)
+		}
+		if !testCase.allowed && !errors.Is(err, ErrSourceNotAllowed) {
+			t.Errorf("%s %v must be rejected: %v", testCase.remoteAddr, testCase.forwarded, err)
+		}
+	}
+
+	if _, err := NewIPAllowlist([]string{"invalid"}, nil); err == nil {
+		t.Errorf("expected error for invalid network")
+	}
+}
+
+func TestNotificationServerAuthentication(t *testing.T) {
+	allowlist, err := NewIPAllowlist([]string{"192.0.2.0/24"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := NewSharedSecret("X-Secret", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	basicAuth, err := NewBasicAuth("ozon", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := 0
+	server := NewNotificationServer(0,
+		WithAuthenticators(allowlist, secret, basicAuth),
+		WithRejectHandler(func(r *http.Request, err error) { rejected++ }),
+	)
+	called := 0
+	On(server, func(ctx context.Context, notification *NewPosting) error {
+		called++
+		return nil
+	})
+
+	send := func(remoteAddr, secret string, basicAuth bool) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(newPostingTest(t).raw))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Secret", secret)
+		if basicAuth {
+			req.SetBasicAuth("ozon", "pass")
+		}
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	if code := send("192.0.2.1:1234", "s3cret", true); code != http.StatusOK {
+		t.Errorf("wrong status code: %d", code)
+	}
+	if code := send("198.51.100.1:1234", "s3cret", true); code != http.StatusForbidden {
+		t.Errorf("wrong status code for unknown source: %d", code)
+	}
+	if code := send("192.0.2.1:1234", "wrong", true); code != http.StatusUnauthorized {
+		t.Errorf("wrong status code for invalid secret: %d", code)
+	}
+	if code := send("192.0.2.1:1234", "s3cret", false); code != http.StatusUnauthorized {
+		t.Errorf("wrong status code without basic auth: %d", code)
+	}
+	if called != 1 || rejected != 3 {
+		t.Errorf("handler called %d times, %d requests rejected", called, rejected)
+	}
+}
+
+func TestSharedSecretEmpty(t *testing.T) {
+	if _, err := NewSharedSecret("X-Secret", ""); err == nil {
+		t.Errorf("expected error for empty secret")
+	}
+	if _, err := NewSharedSecret("", "s3cret"); err == nil {
+		t.Errorf("expected error for empty header")
+	}
+
+	// Misconfigured authenticator must not accept requests without the header
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	if err := (&SharedSecret{Header: "X-Secret"}).Authenticate(req); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected unauthorized error, got: %v", err)
+	}
+}
+
+func TestBasicAuthEmpty(t *testing.T) {
+	if _, err := NewBasicAuth("ozon", ""); err == nil {
+		t.Errorf("expected error for empty password")
+	}
+	if _, err := NewBasicAuth("", "pass"); err == nil {
+		t.Errorf("expected error for empty username")
+	}
+
+	// Empty credentials must not match misconfigured authenticator
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Authorization", "Basic Og==")
+	for _, auth := range []*BasicAuth{{}, {Username: "ozon"}, {Password: "pass"}} {
+		if err := auth.Authenticate(req); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("expected unauthorized error for %+v, got: %v", auth, err)
+		}
+	}
+}
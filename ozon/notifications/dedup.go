@@ -0,0 +1,293 @@
+package notifications
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification with a key that is the same for repeated deliveries of the event
+type Idempotent interface {
+	IdempotencyKey() string
+}
+
+func (n *NewPosting) IdempotencyKey() string {
+	return n.PostingNumber
+}
+
+func (n *PostingCancelled) IdempotencyKey() string {
+	return n.PostingNumber + ":" + n.NewState
+}
+
+func (n *StateChanged) IdempotencyKey() string {
+	return n.PostingNumber + ":" + n.NewState
+}
+
+func (n *CutoffDateChanged) IdempotencyKey() string {
+	return n.PostingNumber + ":" + formatKeyTime(n.NewCutoffDate)
+}
+
+func (n *DeliveryDateChanged) IdempotencyKey() string {
+	return n.PostingNumber + ":" + formatKeyTime(n.NewDeliveryDateBegin) + ":" + formatKeyTime(n.NewDeliveryDateEnd)
+}
+
+func (n *MarkStatusChanged) IdempotencyKey() string {
+	return fmt.Sprintf("%s:%d:%s:%s", n.PostingNumber, n.ExemplarId, n.Mark, n.CheckStatus)
+}
+
+func (n *NewReturn) IdempotencyKey() string {
+	return strconv.FormatInt(n.ReturnId, 10)
+}
+
+func (n *ReturnStatusChanged) IdempotencyKey() string {
+	return fmt.Sprintf("%d:%s:%s", n.ReturnId, n.NewStatus, formatKeyTime(n.ChangedAt))
+}
+
+func (n *CreateOrUpdateItem) IdempotencyKey() string {
+	return fmt.Sprintf("%d:%s:%t", n.ProductId, formatKeyTime(n.ChangedAt), n.IsError)
+}
+
+func (n *CreateItem) IdempotencyKey() string {
+	return fmt.Sprintf("%d:%s:%t", n.ProductId, formatKeyTime(n.ChangedAt), n.IsError)
+}
+
+func (n *UpdateItem) IdempotencyKey() string {
+	return fmt.Sprintf("%d:%s:%t", n.ProductId, formatKeyTime(n.ChangedAt), n.IsError)
+}
+
+func (n *PriceIndexChanged) IdempotencyKey() string {
+	return fmt.Sprintf("%d:%d:%s:%d", n.ProductId, n.SKU, formatKeyTime(n.UpdatedAt), n.PriceIndex)
+}
+
+func (n *ColorIndexChanged) IdempotencyKey() string {
+	return fmt.Sprintf("%d:%d:%s:%s", n.ProductId, n.SKU, formatKeyTime(n.UpdatedAt), n.ColorIndex)
+}
+
+func (n *NewMessage) IdempotencyKey() string {
+	return n.MessageId
+}
+
+func (n *UpdateMessage) IdempotencyKey() string {
+	return n.MessageId + ":" + formatKeyTime(n.UpdatedAt)
+}
+
+func (n *MessageRead) IdempotencyKey() string {
+	return n.ChatId + ":" + n.LastReadMessageId
+}
+
+func (n *NewChat) IdempotencyKey() string {
+	return n.ChatId
+}
+
+func (n *ChatClosed) IdempotencyKey() string {
+	return n.ChatId
+}
+
+func formatKeyTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// Returns the idempotency key prefixed with the message type. Notifications
+// without their own key, e.g. StocksChanged, are identified by the payload hash
+func idempotencyKey(mt MessageType, req interface{}, content []byte) string {
+	if idempotent, ok := req.(Idempotent); ok {
+		return string(mt) + ":" + idempotent.IdempotencyKey()
+	}
+
+	hash := sha256.Sum256(content)
+	return string(mt) + ":" + hex.EncodeToString(hash[:])
+}
+
+// Storage of idempotency keys of processed notifications
+type IdempotencyStore interface {
+	// Returns true if the key is stored and not expired
+	Contains(key string) (bool, error)
+
+	// Stores the key until the expiration time
+	Add(key string, expiresAt time.Time) error
+}
+
+type idempotencyRecord struct {
+	key       string
+	expiresAt time.Time
+}
+
+// Stores keys in memory. When the number of keys exceeds
+// the maximum size, the oldest keys are removed
+type MemoryIdempotencyStore struct {
+	maxSize int
+	now     func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]time.Time
+	records []idempotencyRecord
+}
+
+// Creates the store. Size is not limited if maxSize is not positive
+func NewMemoryIdempotencyStore(maxSize int) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		maxSize: maxSize,
+		now:     time.Now,
+		keys:    map[string]time.Time{},
+	}
+}
+
+func (s *MemoryIdempotencyStore) Contains(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.keys[key]
+	return ok && s.now().Before(expiresAt), nil
+}
+
+func (s *MemoryIdempotencyStore) Add(key string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(key, expiresAt)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) add(key string, expiresAt time.Time) {
+	s.keys[key] = expiresAt
+	s.records = append(s.records, idempotencyRecord{key: key, expiresAt: expiresAt})
+	s.evict()
+}
+
+// Removes expired keys from the beginning and the oldest keys over the limit
+func (s *MemoryIdempotencyStore) evict() {
+	now := s.now()
+	for len(s.records) > 0 {
+		record := s.records[0]
+		if !now.After(record.expiresAt) && (s.maxSize <= 0 || len(s.keys) <= s.maxSize) {
+			break
+		}
+
+		s.records = s.records[1:]
+		// The key could be added again later
+		if s.keys[record.key].Equal(record.expiresAt) {
+			delete(s.keys, record.key)
+		}
+	}
+}
+
+// Number of stored keys
+func (s *MemoryIdempotencyStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.keys)
+}
+
+// Keeps keys in memory and appends them to a file, so they survive restarts.
+// The file is rewritten with actual keys when it grows twice as large
+type FileIdempotencyStore struct {
+	*MemoryIdempotencyStore
+
+	path    string
+	file    *os.File
+	written int
+}
+
+// Opens the store and loads keys which are not expired.
+// Size is not limited if maxSize is not positive
+func OpenFileIdempotencyStore(path string, maxSize int) (*FileIdempotencyStore, error) {
+	s := &FileIdempotencyStore{
+		MemoryIdempotencyStore: NewMemoryIdempotencyStore(maxSize),
+		path:                   path,
+	}
+
+	err := readLines(path, func(line string) error {
+		key, expires, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil
+		}
+		expiresAt, err := time.Parse(time.RFC3339Nano, expires)
+		if err != nil {
+			// Partially written line
+			return nil
+		}
+		if !s.now().Before(expiresAt) {
+			return nil
+		}
+		s.add(key, expiresAt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileIdempotencyStore) Add(key string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(key, expiresAt)
+	if _, err := s.file.WriteString(key + "\t" + formatKeyTime(expiresAt) + "\n"); err != nil {
+		return err
+	}
+	s.written++
+
+	if s.written > 2*len(s.keys) && s.written > 1000 {
+		return s.compact()
+	}
+	return nil
+}
+
+// Rewrites the file with stored keys. The current file is kept open
+// until the new one replaces it, so keys are still appended on failure
+func (s *FileIdempotencyStore) compact() error {
+	tmp := s.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	written := 0
+	for _, record := range s.records {
+		if !s.keys[record.key].Equal(record.expiresAt) {
+			continue
+		}
+		writer.WriteString(record.key + "\t" + formatKeyTime(record.expiresAt) + "\n")
+		written++
+	}
+	if err := writer.Flush(); err != nil {
+		return fail(err)
+	}
+	// The new file is written through the same handle after it's renamed
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fail(err)
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.written = written
+	return nil
+}
+
+// Closes the file
+func (s *FileIdempotencyStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,245 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeduplication(t *testing.T) {
+	server := NewNotificationServer(0, WithDeduplication(NewMemoryIdempotencyStore(100), time.Hour))
+
+	calls := 0
+	fail := true
+	keys := []string{}
+	On(server, func(ctx context.Context, notification *StateChanged) error {
+		calls++
+		metadata, _ := MetadataFromContext(ctx)
+		keys = append(keys, metadata.IdempotencyKey)
+		if fail {
+			fail = false
+			return errors.New("temporary error")
+		}
+		return nil
+	})
+
+	send := func(raw string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(raw))
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	raw := stateChangedTest(t).raw
+	// Failed notification is not stored, so it's retried
+	if code := send(raw); code != http.StatusInternalServerError {
+		t.Errorf("wrong status code: %d", code)
+	}
+	for i := 0; i < 3; i++ {
+		if code := send(raw); code != http.StatusOK {
+			t.Errorf("wrong status code: %d", code)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("duplicates must be skipped: %d calls", calls)
+	}
+
+	state := stateChangedTest(t).object.(*StateChanged)
+	if keys[1] != "TYPE_STATE_CHANGED:"+state.PostingNumber+":"+state.NewState {
+		t.Errorf("wrong idempotency key: %s", keys[1])
+	}
+
+	// Same posting with another state is a different event
+	if code := send(strings.Replace(raw, state.NewState, "posting_cancelled", 1)); code != http.StatusOK {
+		t.Errorf("wrong status code: %d", code)
+	}
+	if calls != 3 {
+		t.Errorf("new state must be processed: %d calls", calls)
+	}
+}
+
+func TestDeduplicationQueue(t *testing.T) {
+	queue, err := OpenDurableQueue(t.TempDir(), WithQueueMaxAttempts(1), WithQueueBackoff(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	store := NewMemoryIdempotencyStore(100)
+	server := NewNotificationServer(0, WithQueue(queue), WithDeduplication(store, time.Hour))
+
+	var mu sync.Mutex
+	calls := map[MessageType]int{}
+	On(server, func(ctx context.Context, notification *StateChanged) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[StateChangedType]++
+		return nil
+	})
+	On(server, func(ctx context.Context, notification *ChatClosed) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[ChatClosedType]++
+		return errors.New("always fails")
+	})
+
+	send := func(raw string) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(raw))
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, req)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("wrong status code: %d", rw.Code)
+		}
+	}
+	run := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			server.RunQueue(ctx)
+		}()
+		waitFor(t, func() bool { return server.QueueDepth() == 0 })
+		cancel()
+		<-done
+	}
+
+	// Repeated delivery is queued before the first one is processed
+	send(stateChangedTest(t).raw)
+	send(stateChangedTest(t).raw)
+	send(chatClosedTest(t).raw)
+	if ok, _ := store.Contains(idempotencyKey(StateChangedType, stateChangedTest(t).object, nil)); ok {
+		t.Errorf("key must not be stored before processing")
+	}
+	run()
+
+	// Dead letter is not stored, so it's processed again
+	send(stateChangedTest(t).raw)
+	send(chatClosedTest(t).raw)
+	run()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls[StateChangedType] != 1 {
+		t.Errorf("duplicates must be skipped: %d calls", calls[StateChangedType])
+	}
+	if calls[ChatClosedType] != 2 {
+		t.Errorf("failed notification must not be stored: %d calls", calls[ChatClosedType])
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	stocks := stocksChangedTest(t)
+	key := idempotencyKey(StocksChangedType, stocks.object, []byte(stocks.raw))
+	if key != idempotencyKey(StocksChangedType, stocks.object, []byte(stocks.raw)) || !strings.HasPrefix(key, "TYPE_STOCKS_CHANGED:") {
+		t.Errorf("wrong payload key: %s", key)
+	}
+
+	message := newMessageTest(t).object.(*NewMessage)
+	update := &UpdateMessage{NewMessage: *message}
+	if idempotencyKey(NewMessageType, message, nil) == idempotencyKey(UpdateMessageType, update, nil) {
+		t.Errorf("keys of different types must differ")
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryIdempotencyStore(2)
+	store.now = func() time.Time { return now }
+
+	store.Add("a", now.Add(time.Minute))
+	store.Add("b", now.Add(time.Hour))
+	if ok, _ := store.Contains("a"); !ok {
+		t.Errorf("key must be stored")
+	}
+
+	// Oldest key is removed over the limit
+	store.Add("c", now.Add(time.Hour))
+	if ok, _ := store.Contains("a"); ok || store.Len() != 2 {
+		t.Errorf("oldest key must be removed: %d keys", store.Len())
+	}
+
+	now = now.Add(2 * time.Hour)
+	if ok, _ := store.Contains("b"); ok {
+		t.Errorf("expired key must not be found")
+	}
+	store.Add("d", now.Add(time.Hour))
+	if store.Len() != 1 {
+		t.Errorf("expired keys must be removed: %d keys", store.Len())
+	}
+}
+
+func TestFileIdempotencyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	store, err := OpenFileIdempotencyStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("a", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("b", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = OpenFileIdempotencyStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if ok, _ := store.Contains("a"); !ok {
+		t.Errorf("key must be loaded from the file")
+	}
+	if ok, _ := store.Contains("b"); ok || store.Len() != 1 {
+		t.Errorf("expired key must not be loaded")
+	}
+}
+
+func TestFileIdempotencyStoreCompactFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	store, err := OpenFileIdempotencyStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("a", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Temporary file can't be created
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.compact(); err == nil {
+		t.Fatal("expected compaction error")
+	}
+	if err := store.Add("b", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("keys must be added after failed compaction: %s", err)
+	}
+	os.Remove(path + ".tmp")
+	if err := store.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("c", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = OpenFileIdempotencyStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		if ok, _ := store.Contains(key); !ok {
+			t.Errorf("key %s must be loaded from the file", key)
+		}
+	}
+}
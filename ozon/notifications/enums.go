@@ -9,11 +9,18 @@ const (
 	StateChangedType        MessageType = "TYPE_STATE_CHANGED"
 	CutoffDateChangedType   MessageType = "TYPE_CUTOFF_DATE_CHANGED"
 	DeliveryDateChangedType MessageType = "TYPE_DELIVERY_DATE_CHANGED"
+	MarkStatusChangedType   MessageType = "TYPE_MARK_STATUS_CHANGED"
+	NewReturnType           MessageType = "TYPE_NEW_RETURN"
+	ReturnStatusChangedType MessageType = "TYPE_RETURN_STATUS_CHANGED"
 	CreateOrUpdateType      MessageType = "TYPE_CREATE_OR_UPDATE_ITEM"
+	CreateItemType          MessageType = "TYPE_CREATE_ITEM"
+	UpdateItemType          MessageType = "TYPE_UPDATE_ITEM"
 	PriceIndexChangedType   MessageType = "TYPE_PRICE_INDEX_CHANGED"
+	ColorIndexChangedType   MessageType = "TYPE_COLOR_INDEX_CHANGED"
 	StocksChangedType       MessageType = "TYPE_STOCKS_CHANGED"
 	NewMessageType          MessageType = "TYPE_NEW_MESSAGE"
 	UpdateMessageType       MessageType = "TYPE_UPDATE_MESSAGE"
 	MessageReadType         MessageType = "TYPE_MESSAGE_READ"
+	NewChatType             MessageType = "TYPE_NEW_CHAT"
 	ChatClosedType          MessageType = "TYPE_CHAT_CLOSED"
 )
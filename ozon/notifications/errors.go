@@ -0,0 +1,46 @@
+package notifications
+
+import "errors"
+
+// Handler error with retry classification
+type handlerError struct {
+	err       error
+	permanent bool
+}
+
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+func (e *handlerError) Unwrap() error {
+	return e.err
+}
+
+// Marks the error as permanent. Notifications failed with permanent errors
+// are acknowledged, because redelivery won't help, e.g. for invalid data
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &handlerError{err: err, permanent: true}
+}
+
+// Marks the error as retryable. Ozon gets an error response and retries
+// the notification. Errors are retryable by default, it's only needed
+// to override classification of a wrapped permanent error
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &handlerError{err: err}
+}
+
+// Checks if the error is marked as permanent.
+// The outermost classification wins
+func IsPermanent(err error) bool {
+	var classified *handlerError
+	if errors.As(err, &classified) {
+		return classified.permanent
+	}
+	return false
+}
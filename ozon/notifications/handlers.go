@@ -0,0 +1,91 @@
+package notifications
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Notification sent by Ozon. Implemented by pointers to notification types,
+// so the message type of a handler is always defined by its argument type
+type Notification interface {
+	NotificationType() MessageType
+}
+
+// Subscribes a type-safe handler. The message type is defined by the type parameter:
+//
+//	notifications.On(server, func(ctx context.Context, posting *notifications.NewPosting) error {
+//		...
+//	})
+//
+// Types which are not notifications don't compile. A message type can have
+// several subscribers, they're called in order of subscription or in parallel
+// with WithParallelSubscribers
+func On[T Notification](ns *NotificationServer, handler func(ctx context.Context, notification T) error) {
+	var zero T
+	mt := zero.NotificationType()
+	ns.handlers[mt] = append(ns.handlers[mt], func(ctx context.Context, req interface{}) error {
+		return handler(ctx, req.(T))
+	})
+}
+
+// Subscribes a handler to notifications of all types, including unknown ones,
+// e.g. for auditing. It's called after subscribers of the message type
+func OnAll(ns *NotificationServer, handler NotificationHandler) {
+	ns.wildcards = append(ns.wildcards, handler)
+}
+
+// Registers a handler for notifications of types unknown to the library,
+// so new Ozon events are not lost. Replaces the previous one. Without it such notifications
+// are acknowledged or rejected according to WithAckUnhandled
+func OnUnknown(ns *NotificationServer, handler func(ctx context.Context, notification *RawNotification) error) {
+	ns.fallback = func(ctx context.Context, req interface{}) error {
+		return handler(ctx, req.(*RawNotification))
+	}
+}
+
+// Information about the HTTP request a notification was received with
+type RequestMetadata struct {
+	// Notification type
+	MessageType MessageType
+
+	// Network address of the sender
+	RemoteAddr string
+
+	// Request headers
+	Header http.Header
+
+	// Time when the request was received
+	ReceivedAt time.Time
+
+	// Key that is the same for repeated deliveries of the notification
+	IdempotencyKey string
+}
+
+type metadataKey struct{}
+
+// Returns request metadata passed to handlers
+func MetadataFromContext(ctx context.Context) (*RequestMetadata, bool) {
+	metadata, ok := ctx.Value(metadataKey{}).(*RequestMetadata)
+	return metadata, ok
+}
+
+func (*NewPosting) NotificationType() MessageType          { return NewPostingType }
+func (*PostingCancelled) NotificationType() MessageType    { return PostingCancelledType }
+func (*StateChanged) NotificationType() MessageType        { return StateChangedType }
+func (*CutoffDateChanged) NotificationType() MessageType   { return CutoffDateChangedType }
+func (*DeliveryDateChanged) NotificationType() MessageType { return DeliveryDateChangedType }
+func (*MarkStatusChanged) NotificationType() MessageType   { return MarkStatusChangedType }
+func (*NewReturn) NotificationType() MessageType           { return NewReturnType }
+func (*ReturnStatusChanged) NotificationType() MessageType { return ReturnStatusChangedType }
+func (*CreateOrUpdateItem) NotificationType() MessageType  { return CreateOrUpdateType }
+func (*CreateItem) NotificationType() MessageType          { return CreateItemType }
+func (*UpdateItem) NotificationType() MessageType          { return UpdateItemType }
+func (*PriceIndexChanged) NotificationType() MessageType   { return PriceIndexChangedType }
+func (*ColorIndexChanged) NotificationType() MessageType   { return ColorIndexChangedType }
+func (*StocksChanged) NotificationType() MessageType       { return StocksChangedType }
+func (*NewMessage) NotificationType() MessageType          { return NewMessageType }
+func (*UpdateMessage) NotificationType() MessageType       { return UpdateMessageType }
+func (*MessageRead) NotificationType() MessageType         { return MessageReadType }
+func (*NewChat) NotificationType() MessageType             { return NewChatType }
+func (*ChatClosed) NotificationType() MessageType          { return ChatClosedType }
@@ -0,0 +1,104 @@
+package notifications
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOn(t *testing.T) {
+	server := NewNotificationServer(0)
+
+	var (
+		posting  *NewPosting
+		metadata *RequestMetadata
+		updated  *UpdateMessage
+	)
+	On(server, func(ctx context.Context, notification *NewPosting) error {
+		posting = notification
+		metadata, _ = MetadataFromContext(ctx)
+		return nil
+	})
+	On(server, func(ctx context.Context, notification *NewMessage) error {
+		t.Errorf("new message handler must not be called for updated message")
+		return nil
+	})
+	On(server, func(ctx context.Context, notification *UpdateMessage) error {
+		updated = notification
+		return nil
+	})
+
+	send := func(raw string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(raw))
+		req.Header.Set("X-Request-Id", "42")
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, req)
+		return rw
+	}
+
+	if rw := send(newPostingTest(t).raw); rw.Code != http.StatusOK {
+		t.Fatalf("wrong status code: %d", rw.Code)
+	}
+	if !reflect.DeepEqual(posting, newPostingTest(t).object) {
+		t.Errorf("wrong notification: got: %#v, expected: %#v", posting, newPostingTest(t).object)
+	}
+	if metadata == nil || metadata.MessageType != NewPostingType || metadata.Header.Get("X-Request-Id") != "42" ||
+		metadata.RemoteAddr == "" || metadata.ReceivedAt.IsZero() {
+		t.Errorf("wrong metadata: %+v", metadata)
+	}
+
+	if rw := send(updateMessageTest(t).raw); rw.Code != http.StatusOK {
+		t.Fatalf("wrong status code: %d", rw.Code)
+	}
+	if !reflect.DeepEqual(updated, updateMessageTest(t).object) {
+		t.Errorf("wrong notification: got: %#v, expected: %#v", updated, updateMessageTest(t).object)
+	}
+
+	if _, ok := MetadataFromContext(context.Background()); ok {
+		t.Errorf("metadata must be absent outside of handlers")
+	}
+}
+
+func TestOnUnknown(t *testing.T) {
+	server := NewNotificationServer(0, WithAckUnhandled(false))
+
+	send := func(raw string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(raw))
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, req)
+		return rw
+	}
+
+	raw := `{"message_type": "TYPE_NEW_EVENT", "posting_number": "1-2-3"}`
+	if rw := send(raw); rw.Code != http.StatusNotImplemented {
+		t.Errorf("unknown type without fallback must not be acknowledged: %d", rw.Code)
+	}
+
+	var unknown *RawNotification
+	OnUnknown(server, func(ctx context.Context, notification *RawNotification) error {
+		unknown = notification
+		return nil
+	})
+	On(server, func(ctx context.Context, notification *CreateItem) error {
+		return nil
+	})
+
+	if rw := send(raw); rw.Code != http.StatusOK {
+		t.Fatalf("wrong status code: %d", rw.Code)
+	}
+	if unknown == nil || unknown.MessageType != "TYPE_NEW_EVENT" || string(unknown.Payload) != raw {
+		t.Errorf("wrong raw notification: %+v", unknown)
+	}
+
+	// Known types are not passed to the fallback
+	unknown = nil
+	if rw := send(createItemTest(t).raw); rw.Code != http.StatusOK {
+		t.Fatalf("wrong status code: %d", rw.Code)
+	}
+	if unknown != nil {
+		t.Errorf("known type must not be passed to the fallback")
+	}
+}
@@ -0,0 +1,94 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Handler of a notification of any type. The notification is a pointer
+// to a notification type or *RawNotification for unknown types
+type NotificationHandler func(ctx context.Context, mt MessageType, notification interface{}) error
+
+// Wraps notification handling, e.g. for logging, metrics or tracing.
+// Middleware is called once per notification around all its subscribers
+type Middleware func(next NotificationHandler) NotificationHandler
+
+// Logs every notification with its processing time and error
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next NotificationHandler) NotificationHandler {
+		return func(ctx context.Context, mt MessageType, notification interface{}) error {
+			start := time.Now()
+			err := next(ctx, mt, notification)
+			if err != nil {
+				logger.Printf("notification %s failed in %s: %s", mt, time.Since(start), err)
+			} else {
+				logger.Printf("notification %s processed in %s", mt, time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// Reports processing time and result of every notification
+func MetricsMiddleware(observe func(mt MessageType, duration time.Duration, err error)) Middleware {
+	return func(next NotificationHandler) NotificationHandler {
+		return func(ctx context.Context, mt MessageType, notification interface{}) error {
+			start := time.Now()
+			err := next(ctx, mt, notification)
+			observe(mt, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// Converts panics of handlers into errors, so Ozon retries the notification
+func RecoverMiddleware() Middleware {
+	return func(next NotificationHandler) NotificationHandler {
+		return func(ctx context.Context, mt MessageType, notification interface{}) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("handler for %s panicked: %v", mt, r)
+				}
+			}()
+			return next(ctx, mt, notification)
+		}
+	}
+}
+
+// Calls all subscribers concurrently and joins their errors
+func callParallel(ctx context.Context, subscribers []contextHandler, req interface{}) error {
+	errs := make([]error, len(subscribers))
+	wg := sync.WaitGroup{}
+	for i, subscriber := range subscribers {
+		wg.Add(1)
+		go func(i int, subscriber contextHandler) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("subscriber panicked: %v", r)
+				}
+			}()
+			errs[i] = subscriber(ctx, req)
+		}(i, subscriber)
+	}
+	wg.Wait()
+
+	joined := errors.Join(errs...)
+	if joined == nil {
+		return nil
+	}
+	// Redelivery is needed if any subscriber failed with a retryable error
+	for _, err := range errs {
+		if err != nil && !IsPermanent(err) {
+			return Retryable(joined)
+		}
+	}
+	return Permanent(joined)
+}
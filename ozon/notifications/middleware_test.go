@@ -0,0 +1,151 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	calls := []string{}
+	trace := func(name string) Middleware {
+		return func(next NotificationHandler) NotificationHandler {
+			return func(ctx context.Context, mt MessageType, notification interface{}) error {
+				calls = append(calls, name+" before "+string(mt))
+				err := next(ctx, mt, notification)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+
+	logs := &bytes.Buffer{}
+	observed := map[MessageType]error{}
+	server := NewNotificationServer(0, WithMiddleware(
+		trace("outer"),
+		trace("inner"),
+		LoggingMiddleware(log.New(logs, "", 0)),
+		MetricsMiddleware(func(mt MessageType, duration time.Duration, err error) {
+			observed[mt] = err
+		}),
+		RecoverMiddleware(),
+	))
+
+	On(server, func(ctx context.Context, notification *NewPosting) error {
+		calls = append(calls, "first")
+		return nil
+	})
+	On(server, func(ctx context.Context, notification *NewPosting) error {
+		calls = append(calls, "second")
+		return nil
+	})
+	On(server, func(ctx context.Context, notification *ChatClosed) error {
+		panic("oops")
+	})
+	audited := []MessageType{}
+	OnAll(server, func(ctx context.Context, mt MessageType, notification interface{}) error {
+		audited = append(audited, mt)
+		return nil
+	})
+
+	send := func(raw string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(raw))
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	if code := send(newPostingTest(t).raw); code != http.StatusOK {
+		t.Errorf("wrong status code: %d", code)
+	}
+	expected := []string{"outer before TYPE_NEW_POSTING", "inner before TYPE_NEW_POSTING", "first", "second", "inner after", "outer after"}
+	if strings.Join(calls, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("wrong calls: %v", calls)
+	}
+
+	if code := send(chatClosedTest(t).raw); code != http.StatusInternalServerError {
+		t.Errorf("panic must be converted into error: %d", code)
+	}
+	if err := observed[ChatClosedType]; err == nil || !strings.Contains(err.Error(), "panicked: oops") {
+		t.Errorf("wrong observed error: %v", err)
+	}
+	if observed[NewPostingType] != nil || !strings.Contains(logs.String(), "notification TYPE_NEW_POSTING processed") {
+		t.Errorf("wrong logs: %s", logs)
+	}
+
+	// Wildcard subscriber gets all types, including types without subscribers and unknown ones
+	if code := send(stocksChangedTest(t).raw); code != http.StatusOK {
+		t.Errorf("wrong status code: %d", code)
+	}
+	if code := send(`{"message_type": "TYPE_NEW_EVENT"}`); code != http.StatusOK {
+		t.Errorf("wrong status code: %d", code)
+	}
+	expectedTypes := []MessageType{NewPostingType, StocksChangedType, "TYPE_NEW_EVENT"}
+	if len(audited) != 3 || audited[0] != expectedTypes[0] || audited[1] != expectedTypes[1] || audited[2] != expectedTypes[2] {
+		t.Errorf("wrong audited types: %v", audited)
+	}
+}
+
+func TestSubscribersOrder(t *testing.T) {
+	server := NewNotificationServer(0)
+
+	calls := 0
+	On(server, func(ctx context.Context, notification *NewPosting) error {
+		calls++
+		return errors.New("first failed")
+	})
+	On(server, func(ctx context.Context, notification *NewPosting) error {
+		calls++
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(newPostingTest(t).raw))
+	rw := httptest.NewRecorder()
+	server.ServeHTTP(rw, req)
+	if rw.Code != http.StatusInternalServerError || calls != 1 {
+		t.Errorf("ordered subscribers must stop at the first error: %d, %d calls", rw.Code, calls)
+	}
+}
+
+func TestParallelSubscribers(t *testing.T) {
+	server := NewNotificationServer(0, WithParallelSubscribers(true))
+
+	// Both subscribers must be running at the same time
+	started := sync.WaitGroup{}
+	started.Add(2)
+	subscriber := func(err error) func(ctx context.Context, notification *NewPosting) error {
+		return func(ctx context.Context, notification *NewPosting) error {
+			started.Done()
+			started.Wait()
+			return err
+		}
+	}
+	On(server, subscriber(Permanent(errors.New("invalid posting"))))
+	On(server, subscriber(nil))
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(newPostingTest(t).raw))
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	if code := send(); code != http.StatusOK {
+		t.Errorf("permanent errors must be acknowledged: %d", code)
+	}
+
+	err := callParallel(context.Background(), []contextHandler{
+		func(ctx context.Context, req interface{}) error { return Permanent(errors.New("permanent")) },
+		func(ctx context.Context, req interface{}) error { return errors.New("temporary") },
+		func(ctx context.Context, req interface{}) error { panic("oops") },
+	}, nil)
+	if err == nil || IsPermanent(err) || !strings.Contains(err.Error(), "temporary") || !strings.Contains(err.Error(), "panicked: oops") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
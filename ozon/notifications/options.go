@@ -0,0 +1,148 @@
+package notifications
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+type ServerOption func(ns *NotificationServer)
+
+// Address to listen on in Run. Default is 0.0.0.0 with the server port
+func WithAddr(addr string) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.addr = addr
+	}
+}
+
+// Maximum duration for reading the entire request. Not limited by default
+func WithReadTimeout(timeout time.Duration) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.readTimeout = timeout
+	}
+}
+
+// Maximum duration before timing out writes of the response. Not limited by default
+func WithWriteTimeout(timeout time.Duration) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.writeTimeout = timeout
+	}
+}
+
+// Maximum duration to wait for in-flight handlers on shutdown. Default is 30 seconds
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.shutdownTimeout = timeout
+	}
+}
+
+// Maximum request body size in bytes. Larger requests are rejected
+// with 413 status code. Not limited by default
+func WithMaxBodySize(size int64) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.maxBodySize = size
+	}
+}
+
+// Serve HTTPS in Run. The config must contain certificates
+func WithTLSConfig(config *tls.Config) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.tlsConfig = config
+	}
+}
+
+// Timeout of handlers. The handler context is canceled after the timeout
+// and Ozon gets an error to retry the notification. Not limited by default
+func WithHandlerTimeout(timeout time.Duration) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.handlerTimeout = timeout
+	}
+}
+
+// Timeout of the handler of the message type. Overrides WithHandlerTimeout
+func WithTypeTimeout(mt MessageType, timeout time.Duration) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.typeTimeouts[mt] = timeout
+	}
+}
+
+// Acknowledge notifications even if handlers fail, so Ozon doesn't retry them.
+// By default only permanent errors are acknowledged
+func WithAckHandlerErrors(ack bool) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.ackErrors = ack
+	}
+}
+
+// Acknowledge notifications without registered handlers.
+// Default is true. Otherwise Ozon gets an error and retries them
+func WithAckUnhandled(ack bool) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.ackUnhandled = ack
+	}
+}
+
+// Called for every handler error, e.g. to report permanent errors
+// which are acknowledged and not retried
+func WithErrorHandler(handler func(ctx context.Context, mt MessageType, err error)) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.onError = handler
+	}
+}
+
+// Write notifications to the durable queue and acknowledge them before
+// processing. Handlers are called by queue workers with retries,
+// so Ozon doesn't wait for them. Request headers are not stored
+func WithQueue(queue *DurableQueue) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.queue = queue
+	}
+}
+
+// Skip handlers for notifications which were already processed within the TTL.
+// Duplicates are acknowledged. Keys are stored only after successful processing,
+// so failed notifications are still retried. With a queue, keys are stored when
+// the queued notification is processed, dead letters are not stored and
+// duplicates queued before that are skipped. Default TTL is 24 hours
+func WithDeduplication(store IdempotencyStore, ttl time.Duration) ServerOption {
+	return func(ns *NotificationServer) {
+		if ttl <= 0 {
+			ttl = 24 * time.Hour
+		}
+		ns.dedupStore = store
+		ns.dedupTTL = ttl
+	}
+}
+
+// Check requests before reading the body, e.g. with IPAllowlist,
+// SharedSecret or BasicAuth. All authenticators must pass
+func WithAuthenticators(authenticators ...Authenticator) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.authenticators = append(ns.authenticators, authenticators...)
+	}
+}
+
+// Called for rejected requests. By default rejections are logged
+func WithRejectHandler(handler func(r *http.Request, err error)) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.onReject = handler
+	}
+}
+
+// Wrap handling of every notification with the middleware.
+// The first middleware is the outermost one
+func WithMiddleware(middleware ...Middleware) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.middleware = append(ns.middleware, middleware...)
+	}
+}
+
+// Call subscribers of a notification concurrently. All subscribers
+// are called even if some fail. By default subscribers are called
+// in order of subscription until the first error
+func WithParallelSubscribers(parallel bool) ServerOption {
+	return func(ns *NotificationServer) {
+		ns.parallelSubscribers = parallel
+	}
+}
@@ -0,0 +1,428 @@
+package notifications
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queueLogFile        = "queue.log"
+	queueDoneFile       = "done.log"
+	queueDeadLetterFile = "dead.log"
+)
+
+// Notification stored in the queue
+type QueueEntry struct {
+	// Sequence number in the queue
+	Id uint64 `json:"id"`
+
+	// Notification type
+	MessageType MessageType `json:"message_type"`
+
+	// Notification as it was received
+	Payload json.RawMessage `json:"payload"`
+
+	// Network address of the sender
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// Time when the notification was received
+	ReceivedAt time.Time `json:"received_at"`
+
+	// Number of processing attempts. Set in dead letters
+	Attempts int `json:"attempts,omitempty"`
+
+	// Error of the last attempt. Set in dead letters
+	Error string `json:"error,omitempty"`
+}
+
+type QueueOption func(q *DurableQueue)
+
+// Sync files to disk after each write. Default is true
+func WithQueueSync(sync bool) QueueOption {
+	return func(q *DurableQueue) {
+		q.sync = sync
+	}
+}
+
+// Number of workers processing notifications. Default is 4
+func WithQueueWorkers(workers int) QueueOption {
+	return func(q *DurableQueue) {
+		q.workers = workers
+	}
+}
+
+// Maximum number of processing attempts before the notification
+// is moved to dead letters. Default is 5
+func WithQueueMaxAttempts(attempts int) QueueOption {
+	return func(q *DurableQueue) {
+		q.maxAttempts = attempts
+	}
+}
+
+// Delay before the first retry. It's doubled after each attempt
+// up to the maximum. Default is 1 second and 1 minute
+func WithQueueBackoff(initial, max time.Duration) QueueOption {
+	return func(q *DurableQueue) {
+		q.backoff = initial
+		q.maxBackoff = max
+	}
+}
+
+// File-based write-ahead log of notifications.
+//
+// Notifications are appended to the log before they're acknowledged
+// and processed by a pool of workers with retries. Identifiers of processed
+// notifications are appended to a separate file, so unprocessed notifications
+// are replayed after restart. Notifications which fail all attempts or
+// with permanent errors are moved to the dead letter file
+type DurableQueue struct {
+	dir         string
+	sync        bool
+	workers     int
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+
+	mu       sync.Mutex
+	log      *os.File
+	done     *os.File
+	dead     *os.File
+	nextId   uint64
+	pending  []*QueueEntry
+	inFlight int
+	notify   chan struct{}
+}
+
+// Opens the queue in the directory and loads unprocessed notifications
+func OpenDurableQueue(dir string, opts ...QueueOption) (*DurableQueue, error) {
+	q := &DurableQueue{
+		dir:         dir,
+		sync:        true,
+		workers:     4,
+		maxAttempts: 5,
+		backoff:     time.Second,
+		maxBackoff:  time.Minute,
+		nextId:      1,
+		notify:      make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if q.log, err = q.openAppend(queueLogFile); err != nil {
+		return nil, err
+	}
+	if q.done, err = q.openAppend(queueDoneFile); err != nil {
+		q.log.Close()
+		return nil, err
+	}
+	if q.dead, err = q.openAppend(queueDeadLetterFile); err != nil {
+		q.log.Close()
+		q.done.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func (q *DurableQueue) openAppend(name string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(q.dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+}
+
+// Loads unprocessed notifications and compacts the log
+func (q *DurableQueue) replay() error {
+	done := map[uint64]bool{}
+	err := readLines(filepath.Join(q.dir, queueDoneFile), func(line string) error {
+		id, err := strconv.ParseUint(line, 10, 64)
+		if err != nil {
+			return err
+		}
+		done[id] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read processed notifications: %w", err)
+	}
+
+	err = readLines(filepath.Join(q.dir, queueLogFile), func(line string) error {
+		entry := &QueueEntry{}
+		if err := json.Unmarshal([]byte(line), entry); err != nil {
+			// The last entry may be written partially on crash,
+			// it wasn't acknowledged, so Ozon will retry it
+			log.Printf("skip invalid queue entry: %s", err)
+			return nil
+		}
+		if entry.Id >= q.nextId {
+			q.nextId = entry.Id + 1
+		}
+		if !done[entry.Id] {
+			q.pending = append(q.pending, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read queue: %w", err)
+	}
+
+	// Rewrite the log with unprocessed notifications only
+	tmp := filepath.Join(q.dir, queueLogFile+".tmp")
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, entry := range q.pending {
+		content, err := json.Marshal(entry)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		writer.Write(append(content, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, queueLogFile)); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(q.dir, queueDoneFile), nil, 0644)
+}
+
+func readLines(path string, f func(line string) error) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := f(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Writes the notification to the log. The notification
+// can be acknowledged after this method returns
+func (q *DurableQueue) Append(entry *QueueEntry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry.Id = q.nextId
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := q.write(q.log, append(content, '\n')); err != nil {
+		return err
+	}
+	q.nextId++
+
+	q.pending = append(q.pending, entry)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *DurableQueue) write(file *os.File, content []byte) error {
+	if _, err := file.Write(content); err != nil {
+		return err
+	}
+	if q.sync {
+		return file.Sync()
+	}
+	return nil
+}
+
+// Number of notifications which are not processed yet, including in-flight ones
+func (q *DurableQueue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending) + q.inFlight
+}
+
+// Returns notifications moved to the dead letter file
+func (q *DurableQueue) DeadLetters() ([]QueueEntry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := []QueueEntry{}
+	err := readLines(filepath.Join(q.dir, queueDeadLetterFile), func(line string) error {
+		entry := QueueEntry{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// Processes notifications with the worker pool until the context is canceled.
+// Notifications being processed at that moment are replayed after restart
+func (q *DurableQueue) Run(ctx context.Context, process func(ctx context.Context, entry *QueueEntry) error) error {
+	wg := sync.WaitGroup{}
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, process)
+		}()
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+func (q *DurableQueue) work(ctx context.Context, process func(ctx context.Context, entry *QueueEntry) error) {
+	for {
+		entry := q.next()
+		if entry == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.notify:
+				continue
+			}
+		}
+
+		err := q.processWithRetries(ctx, entry, process)
+		if err != nil && ctx.Err() != nil {
+			// Interrupted by shutdown, the entry stays in the log
+			q.mu.Lock()
+			q.inFlight--
+			q.pending = append([]*QueueEntry{entry}, q.pending...)
+			q.mu.Unlock()
+			return
+		}
+		if err := q.finish(entry, err); err != nil {
+			log.Printf("finish queue entry %d: %s", entry.Id, err)
+		}
+	}
+}
+
+func (q *DurableQueue) next() *QueueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return nil
+	}
+	entry := q.pending[0]
+	q.pending = q.pending[1:]
+	q.inFlight++
+
+	// Wake up another worker if there are more entries
+	if len(q.pending) > 0 {
+		select {
+		case q.notify <- struct{}{}:
+		default:
+		}
+	}
+	return entry
+}
+
+func (q *DurableQueue) processWithRetries(ctx context.Context, entry *QueueEntry, process func(ctx context.Context, entry *QueueEntry) error) error {
+	backoff := q.backoff
+	for {
+		entry.Attempts++
+		err := process(ctx, entry)
+		if err == nil || IsPermanent(err) || entry.Attempts >= q.maxAttempts || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("process notification %d, attempt %d: %s", entry.Id, entry.Attempts, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > q.maxBackoff {
+			backoff = q.maxBackoff
+		}
+	}
+}
+
+// Marks the entry as processed and moves it to dead letters if it failed
+func (q *DurableQueue) finish(entry *QueueEntry, processErr error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.inFlight--
+
+	if processErr != nil {
+		entry.Error = processErr.Error()
+		content, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := q.write(q.dead, append(content, '\n')); err != nil {
+			return err
+		}
+	}
+	if err := q.write(q.done, []byte(strconv.FormatUint(entry.Id, 10)+"\n")); err != nil {
+		return err
+	}
+
+	// Everything is processed, so files can be truncated
+	if len(q.pending) == 0 && q.inFlight == 0 {
+		if err := q.log.Truncate(0); err != nil {
+			return err
+		}
+		return q.done.Truncate(0)
+	}
+	return nil
+}
+
+// Closes the queue files
+func (q *DurableQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var result error
+	for _, file := range []*os.File{q.log, q.done, q.dead} {
+		if err := file.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDurableQueue(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDurableQueue(dir, WithQueueWorkers(2), WithQueueMaxAttempts(3), WithQueueBackoff(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	server := NewNotificationServer(0, WithQueue(queue))
+
+	var (
+		mu       sync.Mutex
+		postings []*NewPosting
+		attempts int
+		metadata *RequestMetadata
+	)
+	On(server, func(ctx context.Context, notification *NewPosting) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			return errors.New("temporary error")
+		}
+		postings = append(postings, notification)
+		metadata, _ = MetadataFromContext(ctx)
+		return nil
+	})
+	On(server, func(ctx context.Context, notification *ChatClosed) error {
+		return Permanent(errors.New("chat is unknown"))
+	})
+	On(server, func(ctx context.Context, notification *NewMessage) error {
+		return errors.New("always fails")
+	})
+
+	send := func(raw string) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(raw))
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, req)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("wrong status code: %d", rw.Code)
+		}
+	}
+
+	// Notifications are acknowledged before processing
+	send(newPostingTest(t).raw)
+	send(chatClosedTest(t).raw)
+	send(newMessageTest(t).raw)
+	if depth := server.QueueDepth(); depth != 3 {
+		t.Errorf("wrong queue depth: %d", depth)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.RunQueue(ctx)
+	}()
+	waitFor(t, func() bool { return server.QueueDepth() == 0 })
+	cancel()
+	<-done
+
+	mu.Lock()
+	if len(postings) != 1 || attempts != 2 || postings[0].PostingNumber != newPostingTest(t).object.(*NewPosting).PostingNumber {
+		t.Errorf("wrong processed postings: %d attempts, %+v", attempts, postings)
+	}
+	if metadata == nil || metadata.MessageType != NewPostingType || metadata.RemoteAddr == "" || metadata.ReceivedAt.IsZero() {
+		t.Errorf("wrong metadata: %+v", metadata)
+	}
+	mu.Unlock()
+
+	deadLetters, err := queue.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 2 {
+		t.Fatalf("wrong number of dead letters: %d", len(deadLetters))
+	}
+	for _, entry := range deadLetters {
+		switch entry.MessageType {
+		case ChatClosedType:
+			if entry.Attempts != 1 || !strings.Contains(entry.Error, "chat is unknown") {
+				t.Errorf("permanent error must not be retried: %+v", entry)
+			}
+		case NewMessageType:
+			if entry.Attempts != 3 || entry.Error != "always fails" {
+				t.Errorf("wrong dead letter: %+v", entry)
+			}
+		default:
+			t.Errorf("unexpected dead letter: %+v", entry)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, queueLogFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) != 0 {
+		t.Errorf("log must be truncated after processing: %s", content)
+	}
+}
+
+func TestDurableQueueReplay(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDurableQueue(dir, WithQueueSync(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mt := range []MessageType{NewPostingType, ChatClosedType, NewMessageType} {
+		if err := queue.Append(&QueueEntry{MessageType: mt, Payload: []byte(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// First notification is processed before crash
+	if err := queue.finish(queue.next(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Partially written entry
+	file, err := os.OpenFile(filepath.Join(dir, queueLogFile), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"id": 4, "message_`)
+	file.Close()
+
+	queue, err = OpenDurableQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	if depth := queue.Depth(); depth != 2 {
+		t.Fatalf("wrong queue depth: %d", depth)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	processed := make(chan *QueueEntry, 2)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		queue.Run(ctx, func(ctx context.Context, entry *QueueEntry) error {
+			processed <- entry
+			return nil
+		})
+	}()
+	first, second := <-processed, <-processed
+	cancel()
+	<-done
+
+	types := map[MessageType]bool{first.MessageType: true, second.MessageType: true}
+	if !types[ChatClosedType] || !types[NewMessageType] {
+		t.Errorf("wrong replayed notifications: %+v, %+v", first, second)
+	}
+
+	if err := queue.Append(&QueueEntry{MessageType: PingType}); err != nil {
+		t.Fatal(err)
+	}
+	if entry := queue.next(); entry == nil || entry.Id != 4 {
+		t.Errorf("identifiers must continue after replay: %+v", entry)
+	}
+}
@@ -1,44 +1,236 @@
 package notifications
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 )
 
 type Handler func(req interface{}) error
 
+// Handler with context, registered with On or Register
+type contextHandler func(ctx context.Context, req interface{}) error
+
+// Receives notifications from Ozon. The server implements http.Handler,
+// so it can be mounted on any router and path, or started with Run
 type NotificationServer struct {
-	port     int
-	handlers map[MessageType]Handler
+	port      int
+	handlers  map[MessageType][]contextHandler
+	fallback  contextHandler
+	wildcards []NotificationHandler
+
+	addr            string
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	shutdownTimeout time.Duration
+	maxBodySize     int64
+	tlsConfig       *tls.Config
+
+	handlerTimeout time.Duration
+	typeTimeouts   map[MessageType]time.Duration
+	ackErrors      bool
+	ackUnhandled   bool
+	onError        func(ctx context.Context, mt MessageType, err error)
+
+	queue *DurableQueue
+
+	dedupStore IdempotencyStore
+	dedupTTL   time.Duration
+
+	authenticators []Authenticator
+	onReject       func(r *http.Request, err error)
+
+	middleware          []Middleware
+	parallelSubscribers bool
+
+	// Handlers called with a timeout, they keep running after the timeout
+	running sync.WaitGroup
+}
+
+func NewNotificationServer(port int, opts ...ServerOption) *NotificationServer {
+	ns := &NotificationServer{
+		port:            port,
+		handlers:        map[MessageType][]contextHandler{},
+		addr:            fmt.Sprintf("0.0.0.0:%d", port),
+		shutdownTimeout: 30 * time.Second,
+		typeTimeouts:    map[MessageType]time.Duration{},
+		ackUnhandled:    true,
+		onError:         func(ctx context.Context, mt MessageType, err error) {},
+		onReject: func(r *http.Request, err error) {
+			log.Printf("reject notification request from %s: %s", r.RemoteAddr, err)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(ns)
+	}
+
+	return ns
+}
+
+// Listens on the server address and handles notifications until the context
+// is canceled. Then the server stops accepting new requests and waits for
+// in-flight handlers, including timed out ones, to finish within the shutdown timeout
+func (ns *NotificationServer) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", ns.addr)
+	if err != nil {
+		return err
+	}
+	return ns.Serve(ctx, listener)
+}
+
+// Same as Run, but accepts connections on the listener
+func (ns *NotificationServer) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:      ns,
+		ReadTimeout:  ns.readTimeout,
+		WriteTimeout: ns.writeTimeout,
+		TLSConfig:    ns.tlsConfig,
+	}
+
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	defer stopQueue()
+	queueDone := make(chan struct{})
+	go func() {
+		defer close(queueDone)
+		if ns.queue != nil {
+			ns.RunQueue(queueCtx)
+		}
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		if ns.tlsConfig != nil {
+			// Certificates are taken from TLS config
+			errs <- server.ServeTLS(listener, "", "")
+		} else {
+			errs <- server.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ns.shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// Queued notifications are processed after restart
+	stopQueue()
+	<-queueDone
+	return ns.Drain(shutdownCtx)
+}
+
+// Waits for handlers which exceeded their timeout to return.
+// Called by Run and Serve, use it if the server is mounted on another router
+func (ns *NotificationServer) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ns.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("handlers are still running: %w", ctx.Err())
+	}
+}
+
+// Processes notifications from the queue until the context is canceled.
+// Called by Run and Serve, use it if the server is mounted on another router
+func (ns *NotificationServer) RunQueue(ctx context.Context) error {
+	if ns.queue == nil {
+		return fmt.Errorf("queue is not configured")
+	}
+	return ns.queue.Run(ctx, ns.process)
 }
 
-func NewNotificationServer(port int) *NotificationServer {
-	return &NotificationServer{
-		port:     port,
-		handlers: map[MessageType]Handler{},
+// Number of notifications in the queue which are not processed yet
+func (ns *NotificationServer) QueueDepth() int {
+	if ns.queue == nil {
+		return 0
 	}
+	return ns.queue.Depth()
 }
 
-func (ns *NotificationServer) Run() error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", ns.handler)
-	server := http.Server{
-		Addr:    fmt.Sprintf("0.0.0.0:%d", ns.port),
-		Handler: mux,
+// Processes a notification from the queue. Repeated deliveries can be queued
+// before the first one is processed, so duplicates are checked again here
+func (ns *NotificationServer) process(ctx context.Context, entry *QueueEntry) error {
+	req, err := ns.unmarshal(entry.MessageType, entry.Payload)
+	if err != nil {
+		return Permanent(err)
+	}
+	h, ok := ns.handler(entry.MessageType, req)
+	if !ok {
+		log.Printf("handler for %s is not registered", entry.MessageType)
+		return nil
+	}
+	key := idempotencyKey(entry.MessageType, req, entry.Payload)
+	if ns.isDuplicate(key) {
+		return nil
+	}
+
+	ctx = context.WithValue(ctx, metadataKey{}, &RequestMetadata{
+		MessageType:    entry.MessageType,
+		RemoteAddr:     entry.RemoteAddr,
+		ReceivedAt:     entry.ReceivedAt,
+		IdempotencyKey: key,
+	})
+	if err := ns.call(ctx, entry.MessageType, h, req); err != nil {
+		ns.onError(ctx, entry.MessageType, err)
+		if ns.ackErrors {
+			return Permanent(err)
+		}
+		return err
 	}
-	return server.ListenAndServe()
+
+	ns.markProcessed(key)
+	return nil
 }
 
-func (ns *NotificationServer) handler(rw http.ResponseWriter, httpReq *http.Request) {
+func (ns *NotificationServer) ServeHTTP(rw http.ResponseWriter, httpReq *http.Request) {
+	receivedAt := time.Now()
+	if err := ns.authenticate(httpReq); err != nil {
+		ns.onReject(httpReq, err)
+		if errors.Is(err, ErrSourceNotAllowed) {
+			ns.error(rw, http.StatusForbidden, ErrSourceNotAllowed)
+		} else {
+			ns.error(rw, http.StatusUnauthorized, ErrUnauthorized)
+		}
+		return
+	}
+
 	mt := &Common{}
-	content, err := ioutil.ReadAll(httpReq.Body)
+	body := httpReq.Body
+	if ns.maxBodySize > 0 {
+		body = http.MaxBytesReader(rw, body, ns.maxBodySize)
+	}
+	content, err := ioutil.ReadAll(body)
 	if err != nil {
 		log.Print(err)
-		ns.error(rw, http.StatusBadRequest, err)
+		statusCode := http.StatusBadRequest
+		if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+		ns.error(rw, statusCode, err)
 		return
 	}
 	if err := json.Unmarshal(content, mt); err != nil {
@@ -66,23 +258,166 @@ func (ns *NotificationServer) handler(rw http.ResponseWriter, httpReq *http.Requ
 		ns.error(rw, http.StatusInternalServerError, err)
 		return
 	}
-	h, ok := ns.handlers[mt.MessageType]
+	h, ok := ns.handler(mt.MessageType, req)
 	if !ok {
-		ns.result(rw, true)
 		log.Printf("handler for %s is not registered", mt.MessageType)
+		if ns.ackUnhandled {
+			ns.result(rw, true)
+		} else {
+			ns.error(rw, http.StatusNotImplemented, fmt.Errorf("handler for %s is not registered", mt.MessageType))
+		}
 		return
 	}
-	if err := h(req); err != nil {
-		log.Print(err)
+	key := idempotencyKey(mt.MessageType, req, content)
+	if ns.isDuplicate(key) {
 		ns.result(rw, true)
 		return
 	}
+	if ns.queue != nil {
+		err := ns.queue.Append(&QueueEntry{
+			MessageType: mt.MessageType,
+			Payload:     content,
+			RemoteAddr:  httpReq.RemoteAddr,
+			ReceivedAt:  receivedAt,
+		})
+		if err != nil {
+			log.Print(err)
+			ns.error(rw, http.StatusInternalServerError, err)
+			return
+		}
+		ns.result(rw, true)
+		return
+	}
+	ctx := context.WithValue(httpReq.Context(), metadataKey{}, &RequestMetadata{
+		MessageType:    mt.MessageType,
+		RemoteAddr:     httpReq.RemoteAddr,
+		Header:         httpReq.Header.Clone(),
+		ReceivedAt:     receivedAt,
+		IdempotencyKey: key,
+	})
+	if err := ns.call(ctx, mt.MessageType, h, req); err != nil {
+		log.Print(err)
+		ns.onError(ctx, mt.MessageType, err)
+
+		switch {
+		case ns.ackErrors || IsPermanent(err):
+			// Redelivery won't help
+			ns.result(rw, true)
+		case errors.Is(err, context.DeadlineExceeded):
+			ns.error(rw, http.StatusGatewayTimeout, err)
+		default:
+			ns.error(rw, http.StatusInternalServerError, err)
+		}
+		return
+	}
 
+	ns.markProcessed(key)
 	ns.result(rw, true)
 }
 
+// true, if the notification with the key is already processed
+func (ns *NotificationServer) isDuplicate(key string) bool {
+	if ns.dedupStore == nil {
+		return false
+	}
+	duplicate, err := ns.dedupStore.Contains(key)
+	if err != nil {
+		// Better to process the notification twice than to lose it
+		log.Printf("check idempotency key %s: %s", key, err)
+	}
+	if duplicate {
+		log.Printf("skip duplicate notification %s", key)
+	}
+	return duplicate
+}
+
+// Stores the idempotency key, so repeated deliveries are skipped
+func (ns *NotificationServer) markProcessed(key string) {
+	if ns.dedupStore == nil {
+		return
+	}
+	if err := ns.dedupStore.Add(key, time.Now().Add(ns.dedupTTL)); err != nil {
+		log.Printf("store idempotency key %s: %s", key, err)
+	}
+}
+
+// Calls the handler with the timeout of the message type.
+// If the handler doesn't return in time, its context is canceled
+// and the timeout error is returned without waiting for the handler
+func (ns *NotificationServer) call(ctx context.Context, mt MessageType, h contextHandler, req interface{}) error {
+	timeout, ok := ns.typeTimeouts[mt]
+	if !ok {
+		timeout = ns.handlerTimeout
+	}
+	if timeout <= 0 {
+		return h(ctx, req)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	ns.running.Add(1)
+	go func() {
+		defer ns.running.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("handler for %s panicked: %v", mt, r)
+			}
+		}()
+		done <- h(ctx, req)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("handler for %s: %w", mt, ctx.Err())
+	}
+}
+
+// Returns the handler calling subscribers of the notification with middleware
+func (ns *NotificationServer) handler(mt MessageType, req interface{}) (contextHandler, bool) {
+	subscribers := ns.handlers[mt]
+	if _, ok := req.(*RawNotification); ok && ns.fallback != nil && len(subscribers) == 0 {
+		subscribers = []contextHandler{ns.fallback}
+	}
+	for _, wildcard := range ns.wildcards {
+		wildcard := wildcard
+		subscribers = append(subscribers[:len(subscribers):len(subscribers)], func(ctx context.Context, req interface{}) error {
+			return wildcard(ctx, mt, req)
+		})
+	}
+	if len(subscribers) == 0 {
+		return nil, false
+	}
+
+	dispatch := func(ctx context.Context, mt MessageType, req interface{}) error {
+		if ns.parallelSubscribers {
+			return callParallel(ctx, subscribers, req)
+		}
+		// Subscribers are called in order of registration until the first error
+		for _, subscriber := range subscribers {
+			if err := subscriber(ctx, req); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := len(ns.middleware) - 1; i >= 0; i-- {
+		dispatch = ns.middleware[i](dispatch)
+	}
+
+	return func(ctx context.Context, req interface{}) error {
+		return dispatch(ctx, mt, req)
+	}, true
+}
+
+// Subscribes a handler to the message type. Prefer On for type-safe handlers
 func (ns *NotificationServer) Register(mt MessageType, handler func(req interface{}) error) {
-	ns.handlers[mt] = handler
+	ns.handlers[mt] = append(ns.handlers[mt], func(ctx context.Context, req interface{}) error {
+		return handler(req)
+	})
 }
 
 func (ns *NotificationServer) unmarshal(messageType MessageType, content []byte) (interface{}, error) {
@@ -107,14 +442,38 @@ func (ns *NotificationServer) unmarshal(messageType MessageType, content []byte)
 		v := &DeliveryDateChanged{}
 		err := json.Unmarshal(content, v)
 		return v, err
+	case MarkStatusChangedType:
+		v := &MarkStatusChanged{}
+		err := json.Unmarshal(content, v)
+		return v, err
+	case NewReturnType:
+		v := &NewReturn{}
+		err := json.Unmarshal(content, v)
+		return v, err
+	case ReturnStatusChangedType:
+		v := &ReturnStatusChanged{}
+		err := json.Unmarshal(content, v)
+		return v, err
 	case CreateOrUpdateType:
 		v := &CreateOrUpdateItem{}
 		err := json.Unmarshal(content, v)
 		return v, err
+	case CreateItemType:
+		v := &CreateItem{}
+		err := json.Unmarshal(content, v)
+		return v, err
+	case UpdateItemType:
+		v := &UpdateItem{}
+		err := json.Unmarshal(content, v)
+		return v, err
 	case PriceIndexChangedType:
 		v := &PriceIndexChanged{}
 		err := json.Unmarshal(content, v)
 		return v, err
+	case ColorIndexChangedType:
+		v := &ColorIndexChanged{}
+		err := json.Unmarshal(content, v)
+		return v, err
 	case StocksChangedType:
 		v := &StocksChanged{}
 		err := json.Unmarshal(content, v)
@@ -131,12 +490,19 @@ func (ns *NotificationServer) unmarshal(messageType MessageType, content []byte)
 		v := &MessageRead{}
 		err := json.Unmarshal(content, v)
 		return v, err
+	case NewChatType:
+		v := &NewChat{}
+		err := json.Unmarshal(content, v)
+		return v, err
 	case ChatClosedType:
 		v := &ChatClosed{}
 		err := json.Unmarshal(content, v)
 		return v, err
 	default:
-		return nil, fmt.Errorf("unsupported type: %s", messageType)
+		return &RawNotification{
+			Common:  Common{MessageType: messageType},
+			Payload: json.RawMessage(content),
+		}, nil
 	}
 }
 
@@ -1,11 +1,14 @@
 package notifications
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
@@ -299,6 +302,48 @@ func createUpdateItemTest(t *testing.T) testData {
 	}
 }
 
+func createItemTest(t *testing.T) testData {
+	return testData{
+		object: &CreateItem{
+			Common:    Common{MessageType: "TYPE_CREATE_ITEM"},
+			OfferId:   "1234",
+			ProductId: 5678,
+			IsError:   true,
+			ChangedAt: core.TimeFromString(t, "2006-01-02T15:04:05Z", "2022-09-01T14:15:22Z"),
+			SellerId:  15,
+		},
+		raw: `{
+			"message_type": "TYPE_CREATE_ITEM",
+			"seller_id": 15,
+			"offer_id": "1234",
+			"product_id": 5678,
+			"is_error": true,
+			"changed_at": "2022-09-01T14:15:22Z"
+		}`,
+	}
+}
+
+func updateItemTest(t *testing.T) testData {
+	return testData{
+		object: &UpdateItem{
+			Common:    Common{MessageType: "TYPE_UPDATE_ITEM"},
+			OfferId:   "1234",
+			ProductId: 5678,
+			IsError:   false,
+			ChangedAt: core.TimeFromString(t, "2006-01-02T15:04:05Z", "2022-09-01T14:15:22Z"),
+			SellerId:  15,
+		},
+		raw: `{
+			"message_type": "TYPE_UPDATE_ITEM",
+			"seller_id": 15,
+			"offer_id": "1234",
+			"product_id": 5678,
+			"is_error": false,
+			"changed_at": "2022-09-01T14:15:22Z"
+		}`,
+	}
+}
+
 func stateChangedTest(t *testing.T) testData {
 	return testData{
 		object: &StateChanged{
@@ -375,6 +420,140 @@ func chatClosedTest(t *testing.T) testData {
 	}
 }
 
+func markStatusChangedTest(t *testing.T) testData {
+	return testData{
+		object: &MarkStatusChanged{
+			Common:        Common{MessageType: MarkStatusChangedType},
+			PostingNumber: "24219509-0020-1",
+			ProductId:     1234567,
+			ExemplarId:    987,
+			Mark:          "010460704301003721Bt6T1n",
+			MarkType:      "mandatory_mark",
+			CheckStatus:   "failed",
+			ErrorCodes:    []string{"MARK_NOT_FOUND"},
+			ChangedAt:     core.TimeFromString(t, "2006-01-02T15:04:05Z", "2021-01-26T06:56:36Z"),
+			SellerId:      15,
+		},
+		raw: `{
+			"message_type": "TYPE_MARK_STATUS_CHANGED",
+			"posting_number": "24219509-0020-1",
+			"product_id": 1234567,
+			"exemplar_id": 987,
+			"mark": "010460704301003721Bt6T1n",
+			"mark_type": "mandatory_mark",
+			"check_status": "failed",
+			"error_codes": ["MARK_NOT_FOUND"],
+			"changed_at": "2021-01-26T06:56:36Z",
+			"seller_id": 15
+		}`,
+	}
+}
+
+func newReturnTest(t *testing.T) testData {
+	return testData{
+		object: &NewReturn{
+			Common:        Common{MessageType: NewReturnType},
+			ReturnId:      1234,
+			PostingNumber: "24219509-0020-1",
+			ReturnSchema:  "FBS",
+			Products: []Product{
+				{
+					SKU:      147451959,
+					Quantity: 1,
+				},
+			},
+			CreatedAt:   core.TimeFromString(t, "2006-01-02T15:04:05Z", "2021-01-26T06:56:36Z"),
+			WarehouseId: 18850503335000,
+			SellerId:    15,
+		},
+		raw: `{
+			"message_type": "TYPE_NEW_RETURN",
+			"return_id": 1234,
+			"posting_number": "24219509-0020-1",
+			"return_schema": "FBS",
+			"products": [
+				{
+					"sku": 147451959,
+					"quantity": 1
+				}
+			],
+			"created_at": "2021-01-26T06:56:36Z",
+			"warehouse_id": 18850503335000,
+			"seller_id": 15
+		}`,
+	}
+}
+
+func returnStatusChangedTest(t *testing.T) testData {
+	return testData{
+		object: &ReturnStatusChanged{
+			Common:        Common{MessageType: ReturnStatusChangedType},
+			ReturnId:      1234,
+			PostingNumber: "24219509-0020-1",
+			ReturnSchema:  "FBS",
+			OldStatus:     "waiting_for_seller",
+			NewStatus:     "returned_to_seller",
+			ChangedAt:     core.TimeFromString(t, "2006-01-02T15:04:05Z", "2021-01-26T06:56:36Z"),
+			SellerId:      15,
+		},
+		raw: `{
+			"message_type": "TYPE_RETURN_STATUS_CHANGED",
+			"return_id": 1234,
+			"posting_number": "24219509-0020-1",
+			"return_schema": "FBS",
+			"old_status": "waiting_for_seller",
+			"new_status": "returned_to_seller",
+			"changed_at": "2021-01-26T06:56:36Z",
+			"seller_id": 15
+		}`,
+	}
+}
+
+func colorIndexChangedTest(t *testing.T) testData {
+	return testData{
+		object: &ColorIndexChanged{
+			Common:     Common{MessageType: ColorIndexChangedType},
+			UpdatedAt:  core.TimeFromString(t, "2006-01-02T15:04:05Z", "2022-06-21T05:52:46.648Z"),
+			SKU:        147451959,
+			ProductId:  1234567,
+			ColorIndex: "GREEN",
+			SellerId:   15,
+		},
+		raw: `{
+			"message_type": "TYPE_COLOR_INDEX_CHANGED",
+			"updated_at": "2022-06-21T05:52:46.648Z",
+			"sku": 147451959,
+			"product_id": 1234567,
+			"color_index": "GREEN",
+			"seller_id": 15
+		}`,
+	}
+}
+
+func newChatTest(t *testing.T) testData {
+	return testData{
+		object: &NewChat{
+			Common:    Common{MessageType: NewChatType},
+			ChatId:    "b646d975-0c9c-4872-9f41-8b1e57181063",
+			ChatType:  "Buyer_Seller",
+			CreatedAt: core.TimeFromString(t, "2006-01-02T15:04:05Z", "2022-07-18T20:58:04.528Z"),
+			User:      User{Id: "115568", Type: "Customer"},
+			SellerId:  7,
+		},
+		raw: `{
+			"message_type": "TYPE_NEW_CHAT",
+			"chat_id": "b646d975-0c9c-4872-9f41-8b1e57181063",
+			"chat_type": "Buyer_Seller",
+			"created_at": "2022-07-18T20:58:04.528Z",
+			"user": {
+				"id": "115568",
+				"type": "Customer"
+			},
+			"seller_id": 7
+		}`,
+	}
+}
+
 func TestNotificationServer(t *testing.T) {
 	testCases := []struct {
 		request  testData
@@ -423,6 +602,18 @@ func TestNotificationServer(t *testing.T) {
 				"result": true
 			}`,
 		},
+		{
+			createItemTest(t),
+			`{
+				"result": true
+			}`,
+		},
+		{
+			updateItemTest(t),
+			`{
+				"result": true
+			}`,
+		},
 		{
 			priceIndexChangedTest(t),
 			`{
@@ -459,6 +650,36 @@ func TestNotificationServer(t *testing.T) {
 				"result": true
 			}`,
 		},
+		{
+			markStatusChangedTest(t),
+			`{
+				"result": true
+			}`,
+		},
+		{
+			newReturnTest(t),
+			`{
+				"result": true
+			}`,
+		},
+		{
+			returnStatusChangedTest(t),
+			`{
+				"result": true
+			}`,
+		},
+		{
+			colorIndexChangedTest(t),
+			`{
+				"result": true
+			}`,
+		},
+		{
+			newChatTest(t),
+			`{
+				"result": true
+			}`,
+		},
 	}
 
 	port := getFreePort()
@@ -471,14 +692,23 @@ func TestNotificationServer(t *testing.T) {
 	server.Register(CutoffDateChangedType, comparatorWith(cutoffDateChangedTest(t).object))
 	server.Register(DeliveryDateChangedType, comparatorWith(deliveryDateChangedTest(t).object))
 	server.Register(CreateOrUpdateType, comparatorWith(createUpdateItemTest(t).object))
+	server.Register(CreateItemType, comparatorWith(createItemTest(t).object))
+	server.Register(UpdateItemType, comparatorWith(updateItemTest(t).object))
 	server.Register(PriceIndexChangedType, comparatorWith(priceIndexChangedTest(t).object))
 	server.Register(StocksChangedType, comparatorWith(stocksChangedTest(t).object))
 	server.Register(NewMessageType, comparatorWith(newMessageTest(t).object))
 	server.Register(UpdateMessageType, comparatorWith(updateMessageTest(t).object))
 	server.Register(MessageReadType, comparatorWith(messageReadTest(t).object))
 	server.Register(ChatClosedType, comparatorWith(chatClosedTest(t).object))
+	server.Register(MarkStatusChangedType, comparatorWith(markStatusChangedTest(t).object))
+	server.Register(NewReturnType, comparatorWith(newReturnTest(t).object))
+	server.Register(ReturnStatusChangedType, comparatorWith(returnStatusChangedTest(t).object))
+	server.Register(ColorIndexChangedType, comparatorWith(colorIndexChangedTest(t).object))
+	server.Register(NewChatType, comparatorWith(newChatTest(t).object))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func() {
-		if err := server.Run(); err != nil {
+		if err := server.Run(ctx); err != nil {
 			t.Fatalf("notification server is down: %s", err)
 		}
 	}()
@@ -531,13 +761,8 @@ func TestNotificationServerErrors(t *testing.T) {
 					"message_type": "string"
 				}`,
 			},
-			`
-			{
-				"error": {
-					"code": "500",
-					"message": "unsupported type: string",
-					"details": ""
-				}
+			`{
+				"result": true
 			}`,
 		},
 		{
@@ -574,7 +799,11 @@ func TestNotificationServerErrors(t *testing.T) {
 				}`,
 			},
 			`{
-				"result": true
+				"error": {
+					"code": "500",
+					"message": "just error",
+					"details": ""
+				}
 			}`,
 		},
 		{
@@ -611,8 +840,10 @@ func TestNotificationServerErrors(t *testing.T) {
 	server.Register(NewPostingType, func(req interface{}) error {
 		return fmt.Errorf("just error")
 	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func() {
-		if err := server.Run(); err != nil {
+		if err := server.Run(ctx); err != nil {
 			t.Fatalf("notification server is down: %s", err)
 		}
 	}()
@@ -685,3 +916,244 @@ func comparatorWith(v1 interface{}) func(v2 interface{}) error {
 		return nil
 	}
 }
+
+func TestNotificationServerHandler(t *testing.T) {
+	server := NewNotificationServer(0, WithMaxBodySize(1024))
+	On(server, func(ctx context.Context, notification *ChatClosed) error {
+		return nil
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/ozon/notifications", server)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	httpResp, err := http.Post(httpServer.URL+"/ozon/notifications", "application/json", strings.NewReader(chatClosedTest(t).raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		t.Errorf("wrong status code: %d", httpResp.StatusCode)
+	}
+
+	large := `{"message_type": "TYPE_CHAT_CLOSED", "chat_id": "` + strings.Repeat("a", 1024) + `"}`
+	httpResp, err = http.Post(httpServer.URL+"/ozon/notifications", "application/json", strings.NewReader(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("wrong status code: %d", httpResp.StatusCode)
+	}
+}
+
+func TestNotificationServerShutdown(t *testing.T) {
+	// Certificate of the test server is used for TLS
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	tlsConfig, client := tlsServer.TLS, tlsServer.Client()
+	tlsServer.Close()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	finished := false
+	server := NewNotificationServer(0, WithTLSConfig(tlsConfig), WithReadTimeout(time.Second))
+	On(server, func(ctx context.Context, notification *ChatClosed) error {
+		close(started)
+		<-release
+		finished = true
+		return nil
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Serve(ctx, listener)
+	}()
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		httpResp, err := client.Post("https://"+listener.Addr().String(), "application/json", strings.NewReader(chatClosedTest(t).raw))
+		if err != nil {
+			t.Error(err)
+			close(responses)
+			return
+		}
+		responses <- httpResp
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-stopped:
+		t.Fatalf("server must wait for in-flight handlers, stopped with: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Errorf("graceful shutdown must not return error, got: %s", err)
+	}
+	if !finished {
+		t.Errorf("handler must finish before shutdown")
+	}
+	if httpResp := <-responses; httpResp == nil || httpResp.StatusCode != http.StatusOK {
+		t.Errorf("in-flight request must be answered, got: %+v", httpResp)
+	}
+}
+
+func TestNotificationServerDrain(t *testing.T) {
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	server := NewNotificationServer(0, WithHandlerTimeout(10*time.Millisecond))
+	On(server, func(ctx context.Context, notification *ChatClosed) error {
+		// Handler ignores the context
+		<-release
+		close(finished)
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(chatClosedTest(t).raw))
+	rw := httptest.NewRecorder()
+	server.ServeHTTP(rw, req)
+	if rw.Code != http.StatusGatewayTimeout {
+		t.Errorf("timed out handler must fail the request, got: %d", rw.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Drain(ctx); err == nil {
+		t.Errorf("drain must wait for the running handler")
+	}
+
+	close(release)
+	if err := server.Drain(context.Background()); err != nil {
+		t.Errorf("drain must return after the handler, got: %s", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Errorf("handler must finish before drain returns")
+	}
+}
+
+func TestNotificationServerFailures(t *testing.T) {
+	tests := []struct {
+		handler    func(ctx context.Context, notification *NewPosting) error
+		opts       []ServerOption
+		statusCode int
+		response   string
+	}{
+		// Retryable error
+		{
+			func(ctx context.Context, notification *NewPosting) error {
+				return fmt.Errorf("database is down")
+			},
+			nil,
+			http.StatusInternalServerError,
+			`{"error": {"code": "500", "message": "database is down", "details": ""}}`,
+		},
+		// Permanent error
+		{
+			func(ctx context.Context, notification *NewPosting) error {
+				return fmt.Errorf("wrap: %w", Permanent(fmt.Errorf("unknown warehouse")))
+			},
+			nil,
+			http.StatusOK,
+			`{"result": true}`,
+		},
+		// Errors are acknowledged
+		{
+			func(ctx context.Context, notification *NewPosting) error {
+				return fmt.Errorf("database is down")
+			},
+			[]ServerOption{WithAckHandlerErrors(true)},
+			http.StatusOK,
+			`{"result": true}`,
+		},
+		// Slow handler
+		{
+			func(ctx context.Context, notification *NewPosting) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			[]ServerOption{WithHandlerTimeout(time.Hour), WithTypeTimeout(NewPostingType, 10*time.Millisecond)},
+			http.StatusGatewayTimeout,
+			`{"error": {"code": "504", "message": "handler for TYPE_NEW_POSTING: context deadline exceeded", "details": ""}}`,
+		},
+		// Panic in handler with timeout
+		{
+			func(ctx context.Context, notification *NewPosting) error {
+				panic("oops")
+			},
+			[]ServerOption{WithHandlerTimeout(time.Second)},
+			http.StatusInternalServerError,
+			`{"error": {"code": "500", "message": "handler for TYPE_NEW_POSTING panicked: oops", "details": ""}}`,
+		},
+		// No handler
+		{
+			nil,
+			[]ServerOption{WithAckUnhandled(false)},
+			http.StatusNotImplemented,
+			`{"error": {"code": "501", "message": "handler for TYPE_NEW_POSTING is not registered", "details": ""}}`,
+		},
+	}
+
+	for _, test := range tests {
+		reported := []error{}
+		opts := append(test.opts, WithErrorHandler(func(ctx context.Context, mt MessageType, err error) {
+			reported = append(reported, err)
+		}))
+		server := NewNotificationServer(0, opts...)
+		if test.handler != nil {
+			On(server, test.handler)
+		}
+
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(newPostingTest(t).raw)))
+
+		if rw.Code != test.statusCode {
+			t.Errorf("wrong status code: got: %d, expected: %d", rw.Code, test.statusCode)
+		}
+		expected, got := map[string]interface{}{}, map[string]interface{}{}
+		if err := json.Unmarshal([]byte(test.response), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+			t.Errorf("invalid response: %s", rw.Body.String())
+			continue
+		}
+		if err := compare(expected, got); err != nil {
+			t.Error(err)
+		}
+		if test.handler != nil && len(reported) != 1 {
+			t.Errorf("handler errors must be reported, got: %v", reported)
+		}
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	err := fmt.Errorf("invalid data")
+
+	if IsPermanent(err) || IsPermanent(Retryable(err)) || IsPermanent(nil) {
+		t.Errorf("errors must be retryable by default")
+	}
+	if !IsPermanent(Permanent(err)) || !IsPermanent(fmt.Errorf("wrap: %w", Permanent(err))) {
+		t.Errorf("error must be permanent")
+	}
+	if IsPermanent(Retryable(Permanent(err))) {
+		t.Errorf("outermost classification must win")
+	}
+	if !errors.Is(Permanent(err), err) {
+		t.Errorf("classified error must wrap the original")
+	}
+	if Permanent(nil) != nil || Retryable(nil) != nil {
+		t.Errorf("nil must stay nil")
+	}
+}
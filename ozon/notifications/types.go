@@ -1,6 +1,9 @@
 package notifications
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Checking if the service is ready at initial connection and periodically after it
 type pingRequest struct {
@@ -156,6 +159,90 @@ type DeliveryDateChanged struct {
 	SellerId int64 `json:"seller_id"`
 }
 
+// Labeling code check status change
+type MarkStatusChanged struct {
+	Common
+
+	// Shipment number
+	PostingNumber string `json:"posting_number"`
+
+	// Product identifier
+	ProductId int64 `json:"product_id"`
+
+	// Product item identifier
+	ExemplarId int64 `json:"exemplar_id"`
+
+	// Labeling code meaning
+	Mark string `json:"mark"`
+
+	// Labeling code type
+	MarkType string `json:"mark_type"`
+
+	// Check status
+	CheckStatus string `json:"check_status"`
+
+	// Errors that appeared during the check
+	ErrorCodes []string `json:"error_codes"`
+
+	// Date and time when the check status was changed in UTC format
+	ChangedAt time.Time `json:"changed_at"`
+
+	// Seller identifier
+	SellerId int64 `json:"seller_id"`
+}
+
+// New return
+type NewReturn struct {
+	Common
+
+	// Return identifier
+	ReturnId int64 `json:"return_id"`
+
+	// Shipment number
+	PostingNumber string `json:"posting_number"`
+
+	// Return scheme: FBO, FBS or RFBS
+	ReturnSchema string `json:"return_schema"`
+
+	// Products information
+	Products []Product `json:"products"`
+
+	// Date and time when the return was created in UTC format
+	CreatedAt time.Time `json:"created_at"`
+
+	// Warehouse identifier where the products are returned
+	WarehouseId int64 `json:"warehouse_id"`
+
+	// Seller identifier
+	SellerId int64 `json:"seller_id"`
+}
+
+// Return status change
+type ReturnStatusChanged struct {
+	Common
+
+	// Return identifier
+	ReturnId int64 `json:"return_id"`
+
+	// Shipment number
+	PostingNumber string `json:"posting_number"`
+
+	// Return scheme: FBO, FBS or RFBS
+	ReturnSchema string `json:"return_schema"`
+
+	// Previous return status
+	OldStatus string `json:"old_status"`
+
+	// New return status
+	NewStatus string `json:"new_status"`
+
+	// Date and time when the return status was changed in UTC format
+	ChangedAt time.Time `json:"changed_at"`
+
+	// Seller identifier
+	SellerId int64 `json:"seller_id"`
+}
+
 // Product creation and update or processing error
 type CreateOrUpdateItem struct {
 	Common
@@ -176,6 +263,46 @@ type CreateOrUpdateItem struct {
 	SellerId int64 `json:"seller_id"`
 }
 
+// Product creation or processing error
+type CreateItem struct {
+	Common
+
+	// Product identifier in the seller's system
+	OfferId string `json:"offer_id"`
+
+	// Product identifier
+	ProductId int64 `json:"product_id"`
+
+	// An indication that errors occurred during the product creation
+	IsError bool `json:"is_error"`
+
+	// Update date and time
+	ChangedAt time.Time `json:"changed_at"`
+
+	// Seller identifier
+	SellerId int64 `json:"seller_id"`
+}
+
+// Product update or processing error
+type UpdateItem struct {
+	Common
+
+	// Product identifier in the seller's system
+	OfferId string `json:"offer_id"`
+
+	// Product identifier
+	ProductId int64 `json:"product_id"`
+
+	// An indication that errors occurred during the product update
+	IsError bool `json:"is_error"`
+
+	// Update date and time
+	ChangedAt time.Time `json:"changed_at"`
+
+	// Seller identifier
+	SellerId int64 `json:"seller_id"`
+}
+
 // Product price index change
 type PriceIndexChanged struct {
 	Common
@@ -196,6 +323,26 @@ type PriceIndexChanged struct {
 	SellerId int64 `json:"seller_id"`
 }
 
+// Product price index change for sellers working with the color index
+type ColorIndexChanged struct {
+	Common
+
+	// Date and time of price index change
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Product SKU
+	SKU int64 `json:"sku"`
+
+	// Product identifier
+	ProductId int64 `json:"product_id"`
+
+	// Color index: GREEN, YELLOW, RED or WITHOUT_INDEX
+	ColorIndex string `json:"color_index"`
+
+	// Seller identifier
+	SellerId int64 `json:"seller_id"`
+}
+
 // Stock change at the seller's warehouse
 type StocksChanged struct {
 	Common
@@ -282,6 +429,26 @@ type MessageRead struct {
 	LastReadMessageId string `json:"last_read_message_id"`
 }
 
+// New chat
+type NewChat struct {
+	Common
+
+	// Chat identifier
+	ChatId string `json:"chat_id"`
+
+	// Chat type
+	ChatType string `json:"chat_type"`
+
+	// Chat creation date
+	CreatedAt time.Time `json:"created_at"`
+
+	// Information about the user who started the chat
+	User User `json:"user"`
+
+	// Seller identifier
+	SellerId int64 `json:"seller_id"`
+}
+
 // Chat is closed
 type ChatClosed struct {
 	Common
@@ -299,6 +466,14 @@ type ChatClosed struct {
 	SellerId int64 `json:"seller_id"`
 }
 
+// Notification of a type unknown to the library
+type RawNotification struct {
+	Common
+
+	// Notification as it was received
+	Payload json.RawMessage
+}
+
 type Response struct {
 	// Notification is received
 	Result bool `json:"result"`
@@ -2,6 +2,7 @@ package ozon
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -25,3 +26,19 @@ func TestNewClient(t *testing.T) {
 		t.Errorf("expected client id: %s, but got: %s", clientId, client.client.Options["Client-Id"])
 	}
 }
+
+// Returns a handler that responds with a json depending on the request path.
+// Responds with 404 if path is not registered
+func newMockRouter(routes map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response, ok := routes["/"+strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code": 5, "message": "not found"}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(response))
+	}
+}
@@ -0,0 +1,545 @@
+package ozon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/diphantxm/ozon-api-client/ozon/notifications"
+)
+
+// Maximum number of shipments in `GetFBSShipmentsList` response
+const reconcilePageSize = 50
+
+// Processing dates are required by the shipments list, so shipments
+// processed within this period are listed if their status changed in the window
+const reconcileProcessingPeriod = 180 * 24 * time.Hour
+
+// Handlers of FBS posting events. Nil handlers are skipped
+type PostingEventHandlers struct {
+	NewPosting       func(ctx context.Context, notification *notifications.NewPosting) error
+	StateChanged     func(ctx context.Context, notification *notifications.StateChanged) error
+	PostingCancelled func(ctx context.Context, notification *notifications.PostingCancelled) error
+}
+
+type reconciledKey struct{}
+
+// true, if the event was synthesized by PostingReconciler
+// from the shipments list instead of a push notification
+func IsReconciledEvent(ctx context.Context) bool {
+	reconciled, _ := ctx.Value(reconciledKey{}).(bool)
+	return reconciled
+}
+
+type PostingReconcilerOption func(r *PostingReconciler)
+
+// Shipments with status changed within the window are reconciled. Default is 24 hours
+func WithReconcileWindow(window time.Duration) PostingReconcilerOption {
+	return func(r *PostingReconciler) {
+		r.window = window
+	}
+}
+
+// Interval between reconciliations in Run. Default is 10 minutes
+func WithReconcileInterval(interval time.Duration) PostingReconcilerOption {
+	return func(r *PostingReconciler) {
+		r.interval = interval
+	}
+}
+
+// Synthesize events on the first reconciliation. By default the first
+// reconciliation only loads the current states, so a restart doesn't
+// repeat events for every shipment in the window
+func WithReconcileInitialEvents(emit bool) PostingReconcilerOption {
+	return func(r *PostingReconciler) {
+		r.initialized = emit
+	}
+}
+
+// Seller identifier set in synthesized events, so they match push notifications.
+// The shipments list doesn't contain it
+func WithReconcileSellerId(sellerId int64) PostingReconcilerOption {
+	return func(r *PostingReconciler) {
+		r.sellerId = sellerId
+	}
+}
+
+// Called for errors in Run. Default handler logs errors
+func WithReconcileErrorHandler(handler func(err error)) PostingReconcilerOption {
+	return func(r *PostingReconciler) {
+		r.onError = handler
+	}
+}
+
+type postingView struct {
+	// Shipment substatus, which is the state in notifications. Empty if unknown
+	state string
+
+	// Time of the last state change
+	changedAt time.Time
+
+	// Time when the shipment was last seen in a notification or the list
+	seenAt time.Time
+
+	// Sequence number of the last state change
+	seq uint64
+}
+
+// Keeps a view of FBS shipment states fed by notifications and reconciles it
+// against the shipments list. Events missed by push notifications are
+// synthesized into the same handlers, so handlers get a single event stream.
+// Push notifications already received from the list are skipped.
+//
+// Events of a posting are delivered one at a time, handlers of other postings
+// are not blocked. The view is updated only after a handler succeeds,
+// so failed events are delivered again
+type PostingReconciler struct {
+	fbs      *FBS
+	handlers PostingEventHandlers
+
+	window   time.Duration
+	interval time.Duration
+	sellerId int64
+	onError  func(err error)
+	now      func() time.Time
+
+	mu          sync.Mutex
+	initialized bool
+	postings    map[string]*postingView
+
+	// Incremented on every change of the view
+	seq uint64
+
+	// Postings with events being delivered. Channels are closed after delivery
+	busy map[string]chan struct{}
+}
+
+func NewPostingReconciler(fbs *FBS, handlers PostingEventHandlers, opts ...PostingReconcilerOption) *PostingReconciler {
+	r := &PostingReconciler{
+		fbs:      fbs,
+		handlers: handlers,
+		window:   24 * time.Hour,
+		interval: 10 * time.Minute,
+		onError: func(err error) {
+			log.Print(err)
+		},
+		now:      time.Now,
+		postings: map[string]*postingView{},
+		busy:     map[string]chan struct{}{},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Registers the reconciler as the handler of posting notifications
+func (r *PostingReconciler) Register(ns *notifications.NotificationServer) {
+	notifications.On(ns, r.HandleNewPosting)
+	notifications.On(ns, r.HandleStateChanged)
+	notifications.On(ns, r.HandlePostingCancelled)
+}
+
+func (r *PostingReconciler) HandleNewPosting(ctx context.Context, notification *notifications.NewPosting) error {
+	release, err := r.acquire(ctx, notification.PostingNumber)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	r.mu.Lock()
+	_, ok := r.postings[notification.PostingNumber]
+	r.mu.Unlock()
+	if ok {
+		return nil
+	}
+	if err := r.deliver(ctx, notification); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(notification.PostingNumber, "", notification.InProccessAt)
+	return nil
+}
+
+func (r *PostingReconciler) HandleStateChanged(ctx context.Context, notification *notifications.StateChanged) error {
+	return r.handleChange(ctx, notification, notification.PostingNumber, notification.NewState, notification.ChangedStateDate)
+}
+
+func (r *PostingReconciler) HandlePostingCancelled(ctx context.Context, notification *notifications.PostingCancelled) error {
+	return r.handleChange(ctx, notification, notification.PostingNumber, notification.NewState, notification.ChangedStateDate)
+}
+
+func (r *PostingReconciler) handleChange(ctx context.Context, notification notifications.Notification, postingNumber, state string, changedAt time.Time) error {
+	release, err := r.acquire(ctx, postingNumber)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	r.mu.Lock()
+	known := r.isKnown(postingNumber, state, changedAt)
+	r.mu.Unlock()
+	if known {
+		return nil
+	}
+	if err := r.deliver(ctx, notification); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(postingNumber, state, changedAt)
+	return nil
+}
+
+// Waits until events of the posting are not delivered by another caller
+// and marks the posting busy. Returns the function releasing the posting
+func (r *PostingReconciler) acquire(ctx context.Context, postingNumber string) (func(), error) {
+	for {
+		r.mu.Lock()
+		busy, ok := r.busy[postingNumber]
+		if !ok {
+			done := make(chan struct{})
+			r.busy[postingNumber] = done
+			r.mu.Unlock()
+
+			return func() {
+				r.mu.Lock()
+				delete(r.busy, postingNumber)
+				r.mu.Unlock()
+				close(done)
+			}, nil
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-busy:
+		}
+	}
+}
+
+// true, if the state is already known or the change is older than the known one
+func (r *PostingReconciler) isKnown(postingNumber, state string, changedAt time.Time) bool {
+	view, ok := r.postings[postingNumber]
+	if !ok {
+		return false
+	}
+	return view.state == state || changedAt.Before(view.changedAt)
+}
+
+func (r *PostingReconciler) record(postingNumber, state string, changedAt time.Time) {
+	r.seq++
+	r.postings[postingNumber] = &postingView{state: state, changedAt: changedAt, seenAt: r.now(), seq: r.seq}
+}
+
+func (r *PostingReconciler) deliver(ctx context.Context, notification notifications.Notification) error {
+	switch n := notification.(type) {
+	case *notifications.NewPosting:
+		if r.handlers.NewPosting != nil {
+			return r.handlers.NewPosting(ctx, n)
+		}
+	case *notifications.StateChanged:
+		if r.handlers.StateChanged != nil {
+			return r.handlers.StateChanged(ctx, n)
+		}
+	case *notifications.PostingCancelled:
+		if r.handlers.PostingCancelled != nil {
+			return r.handlers.PostingCancelled(ctx, n)
+		}
+	}
+	return nil
+}
+
+// Reconciles the view on schedule until the context is canceled
+func (r *PostingReconciler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reconcile(ctx); err != nil && ctx.Err() == nil {
+			r.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Loads shipments with status changed within the window and synthesizes events
+// for changes missed by notifications. Returns delivered events
+func (r *PostingReconciler) Reconcile(ctx context.Context) ([]notifications.Notification, error) {
+	// Postings changed after this point are newer in the view than in the list
+	r.mu.Lock()
+	listedAt := r.seq
+	r.mu.Unlock()
+
+	postings, err := r.listPostings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := r.now()
+	ctx = context.WithValue(ctx, reconciledKey{}, true)
+	delivered := []notifications.Notification{}
+	var errs []error
+
+	r.mu.Lock()
+	initialized := r.initialized
+	if !initialized {
+		for i := range postings {
+			posting := &postings[i]
+			if view, ok := r.postings[posting.PostingNumber]; !ok || view.seq <= listedAt {
+				r.record(posting.PostingNumber, postingState(posting), now)
+			}
+		}
+		r.initialized = true
+	}
+	r.mu.Unlock()
+
+	if initialized {
+		for i := range postings {
+			events, err := r.reconcilePosting(ctx, &postings[i], listedAt, now)
+			delivered = append(delivered, events...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	// Postings out of the window are not listed anymore
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for postingNumber, view := range r.postings {
+		if view.seenAt.Before(now.Add(-2 * r.window)) {
+			delete(r.postings, postingNumber)
+		}
+	}
+
+	return delivered, errors.Join(errs...)
+}
+
+// Synthesizes events of the listed posting and delivers them in order until
+// a failure. Returns delivered events
+func (r *PostingReconciler) reconcilePosting(ctx context.Context, posting *FBSPosting, listedAt uint64, now time.Time) ([]notifications.Notification, error) {
+	release, err := r.acquire(ctx, posting.PostingNumber)
+	if err != nil {
+		return nil, fmt.Errorf("reconcile %s: %w", posting.PostingNumber, err)
+	}
+	defer release()
+
+	state := postingState(posting)
+
+	r.mu.Lock()
+	view, ok := r.postings[posting.PostingNumber]
+	oldState := ""
+	if ok {
+		oldState = view.state
+		// The list is outdated if the view was changed after it was requested
+		// or the listed state is an earlier step of the lifecycle
+		if view.seq > listedAt || oldState == state || isEarlierPostingState(state, oldState) {
+			view.seenAt = now
+			r.mu.Unlock()
+			return nil, nil
+		}
+	}
+	r.mu.Unlock()
+
+	events := []notifications.Notification{}
+	switch {
+	case !ok && posting.InProccessAt.Before(now.Add(-r.window)):
+		// Old posting is not new, it's unknown since it wasn't changed for long
+		if isPostingCancelled(posting) {
+			events = append(events, r.postingCancelledEvent(posting, "", now))
+		} else {
+			events = append(events, r.stateChangedEvent(posting, now))
+		}
+	case !ok:
+		events = append(events, r.newPostingEvent(posting))
+		if isPostingCancelled(posting) {
+			events = append(events, r.postingCancelledEvent(posting, "", now))
+		}
+	case isPostingCancelled(posting):
+		events = append(events, r.postingCancelledEvent(posting, oldState, now))
+	case oldState == "":
+		// State after a new posting notification is not known,
+		// so the first seen state is not a change
+	default:
+		events = append(events, r.stateChangedEvent(posting, now))
+	}
+
+	sent := 0
+	for _, event := range events {
+		if err = r.deliver(ctx, event); err != nil {
+			err = fmt.Errorf("deliver %s for %s: %w", event.NotificationType(), posting.PostingNumber, err)
+			break
+		}
+		sent++
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case sent == len(events):
+		r.record(posting.PostingNumber, state, now)
+	case !ok && sent > 0:
+		// New posting is delivered, the rest is retried as a change
+		r.record(posting.PostingNumber, "", posting.InProccessAt)
+	}
+	return events[:sent], err
+}
+
+func (r *PostingReconciler) listPostings(ctx context.Context) ([]FBSPosting, error) {
+	to := r.now()
+	since := to.Add(-r.window)
+
+	postings := []FBSPosting{}
+	params := &GetFBSShipmentsListParams{
+		Direction: Ascending,
+		Filter: GetFBSShipmentsListFilter{
+			Since: to.Add(-reconcileProcessingPeriod),
+			To:    to,
+			LastChangedStatusDate: GetFBSShipmentsListFilterLastChangeDate{
+				From: since,
+				To:   to,
+			},
+		},
+		Limit: reconcilePageSize,
+	}
+	for {
+		resp, err := r.fbs.GetFBSShipmentsList(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("list FBS shipments: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		postings = append(postings, resp.Result.Postings...)
+		if !resp.Result.HasNext || len(resp.Result.Postings) == 0 {
+			return postings, nil
+		}
+		params.Offset += int64(len(resp.Result.Postings))
+	}
+}
+
+// Notifications contain substatuses as states
+func postingState(posting *FBSPosting) string {
+	if posting.Substatus != "" {
+		return posting.Substatus
+	}
+	return posting.Status
+}
+
+// Steps of the posting lifecycle. A posting doesn't return to an earlier step,
+// so a listed state of an earlier step than the known one is outdated.
+// Cancellation, arbitration and returns can happen at any step and are not ranked
+var postingLifecycle = map[string]int{
+	string(AwaitingApprove):             1,
+	string(AwaitingPackaging):           1,
+	string(PostingCreated):              1,
+	string(PostingAwaitingPassportData): 1,
+	string(PostingSplitPending):         1,
+
+	string(AwaitingDeliver):             2,
+	string(PostingAwaitingRegistration): 2,
+	string(PostingRegistrationError):    2,
+	string(PostingRegistered):           2,
+
+	string(PostingTransferringToDelivery): 3,
+
+	string(AcceptanceInProgress):        4,
+	string(PostingAcceptanceInProgress): 4,
+
+	string(DriverPickup):         5,
+	string(PostingDriverPickup):  5,
+	string(PostingInCarriage):    5,
+	string(PostingNotInCarriage): 5,
+	string(SentBySeller):         5,
+
+	string(Delivering):                         6,
+	string(PostingTransferredToCourierService): 6,
+	string(PostingInCourierService):            6,
+	string(PostingOnWayToCity):                 6,
+	string(PostingOnWayToPickupPoint):          6,
+	string(PostingInPickupPoint):               6,
+
+	string(Delivered):                     7,
+	string(PostingConditionallyDelivered): 7,
+	string(PostingDelivered):              7,
+	string(PostingReceived):               7,
+}
+
+// true, if both states are ranked and the state is an earlier step than the other one
+func isEarlierPostingState(state, other string) bool {
+	step, ok := postingLifecycle[state]
+	otherStep, otherOk := postingLifecycle[other]
+	return ok && otherOk && step < otherStep
+}
+
+func isPostingCancelled(posting *FBSPosting) bool {
+	return posting.Status == string(CancelledSubstatus) || posting.Substatus == string(PostingCancelled)
+}
+
+func postingProducts(posting *FBSPosting) []notifications.Product {
+	products := make([]notifications.Product, 0, len(posting.Products))
+	for _, product := range posting.Products {
+		products = append(products, notifications.Product{
+			SKU:      product.SKU,
+			Quantity: int64(product.Quantity),
+		})
+	}
+	return products
+}
+
+func (r *PostingReconciler) newPostingEvent(posting *FBSPosting) *notifications.NewPosting {
+	return &notifications.NewPosting{
+		Common:        notifications.Common{MessageType: notifications.NewPostingType},
+		PostingNumber: posting.PostingNumber,
+		Products:      postingProducts(posting),
+		InProccessAt:  posting.InProccessAt,
+		WarehouseId:   posting.DeliveryMethod.WarehouseId,
+		SellerId:      r.sellerId,
+	}
+}
+
+// The exact change time is not known, so the reconciliation time is used
+func (r *PostingReconciler) stateChangedEvent(posting *FBSPosting, changedAt time.Time) *notifications.StateChanged {
+	return &notifications.StateChanged{
+		Common:           notifications.Common{MessageType: notifications.StateChangedType},
+		PostingNumber:    posting.PostingNumber,
+		NewState:         postingState(posting),
+		ChangedStateDate: changedAt,
+		WarehouseId:      posting.DeliveryMethod.WarehouseId,
+		SellerId:         r.sellerId,
+	}
+}
+
+func (r *PostingReconciler) postingCancelledEvent(posting *FBSPosting, oldState string, changedAt time.Time) *notifications.PostingCancelled {
+	return &notifications.PostingCancelled{
+		Common:           notifications.Common{MessageType: notifications.PostingCancelledType},
+		PostingNumber:    posting.PostingNumber,
+		Products:         postingProducts(posting),
+		OldState:         oldState,
+		NewState:         postingState(posting),
+		ChangedStateDate: changedAt,
+		Reason: notifications.Reason{
+			Id:      posting.Cancellation.CancelReasonId,
+			Message: posting.Cancellation.CancelReason,
+		},
+		WarehouseId: posting.DeliveryMethod.WarehouseId,
+		SellerId:    r.sellerId,
+	}
+}
@@ -0,0 +1,343 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diphantxm/ozon-api-client/ozon/notifications"
+)
+
+type fbsListMock struct {
+	mu       sync.Mutex
+	postings []string
+	offsets  []int64
+	filter   GetFBSShipmentsListFilter
+
+	// Called when the list is requested
+	onList func()
+}
+
+func (m *fbsListMock) handler(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if "/"+strings.TrimPrefix(r.URL.Path, "/") != "/v3/posting/fbs/list" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	params := GetFBSShipmentsListParams{}
+	json.NewDecoder(r.Body).Decode(&params)
+	m.offsets = append(m.offsets, params.Offset)
+	m.filter = params.Filter
+	if m.onList != nil {
+		m.onList()
+	}
+
+	// Two postings per page
+	end := int(params.Offset) + 2
+	if end > len(m.postings) {
+		end = len(m.postings)
+	}
+	page := m.postings[params.Offset:end]
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"result": {"has_next": %t, "postings": [%s]}}`, end < len(m.postings), strings.Join(page, ","))
+}
+
+func (m *fbsListMock) set(postings ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.postings = postings
+}
+
+func reconcilerPosting(number, status, substatus string) string {
+	return fmt.Sprintf(`{
+		"posting_number": %q,
+		"status": %q,
+		"substatus": %q,
+		"in_process_at": "2024-05-01T10:00:00Z",
+		"delivery_method": {"warehouse_id": 7},
+		"products": [{"sku": 100, "quantity": 2}],
+		"cancellation": {"cancel_reason_id": 352, "cancel_reason": "Покупатель отменил заказ"}
+	}`, number, status, substatus)
+}
+
+type postingEventsRecorder struct {
+	events     []string
+	reconciled []bool
+	sellers    []int64
+	fail       string
+}
+
+func (rec *postingEventsRecorder) handlers() PostingEventHandlers {
+	handle := func(ctx context.Context, event string, sellerId int64) error {
+		if event == rec.fail {
+			return errors.New("handler failed")
+		}
+		rec.events = append(rec.events, event)
+		rec.reconciled = append(rec.reconciled, IsReconciledEvent(ctx))
+		rec.sellers = append(rec.sellers, sellerId)
+		return nil
+	}
+
+	return PostingEventHandlers{
+		NewPosting: func(ctx context.Context, n *notifications.NewPosting) error {
+			return handle(ctx, "new "+n.PostingNumber, n.SellerId)
+		},
+		StateChanged: func(ctx context.Context, n *notifications.StateChanged) error {
+			return handle(ctx, n.NewState+" "+n.PostingNumber, n.SellerId)
+		},
+		PostingCancelled: func(ctx context.Context, n *notifications.PostingCancelled) error {
+			return handle(ctx, fmt.Sprintf("cancelled %s from %s: %s", n.PostingNumber, n.OldState, n.Reason.Message), n.SellerId)
+		},
+	}
+}
+
+func TestPostingReconciler(t *testing.T) {
+	t.Parallel()
+
+	mock := &fbsListMock{}
+	c := NewMockClient(mock.handler)
+	recorder := &postingEventsRecorder{}
+	reconciler := NewPostingReconciler(c.FBS(), recorder.handlers(), WithReconcileSellerId(15))
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	reconciler.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// First reconciliation loads states only
+	mock.set(
+		reconcilerPosting("1-1", "awaiting_packaging", "posting_created"),
+		reconcilerPosting("2-1", "awaiting_deliver", "posting_awaiting_registration"),
+		reconcilerPosting("3-1", "delivering", "posting_in_carriage"),
+	)
+	if delivered, err := reconciler.Reconcile(ctx); err != nil || len(delivered) != 0 {
+		t.Fatalf("first reconciliation must not deliver events: %v, %v", delivered, err)
+	}
+	mock.mu.Lock()
+	if len(mock.offsets) != 2 || mock.offsets[1] != 2 {
+		t.Errorf("wrong pages: %v", mock.offsets)
+	}
+	// Shipments are listed by the status change date, not by the processing date
+	if filter := mock.filter.LastChangedStatusDate; !filter.From.Equal(now.Add(-24*time.Hour)) || !filter.To.Equal(now) || !mock.filter.Since.Before(filter.From) {
+		t.Errorf("wrong filter: %+v", mock.filter)
+	}
+	mock.mu.Unlock()
+
+	// Push notifications
+	push := func(notification notifications.Notification) {
+		var err error
+		switch n := notification.(type) {
+		case *notifications.NewPosting:
+			err = reconciler.HandleNewPosting(ctx, n)
+		case *notifications.StateChanged:
+			err = reconciler.HandleStateChanged(ctx, n)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	push(&notifications.NewPosting{PostingNumber: "4-1", InProccessAt: now})
+	push(&notifications.StateChanged{PostingNumber: "1-1", NewState: "posting_awaiting_registration", ChangedStateDate: now.Add(time.Minute)})
+	// Repeated and outdated notifications are skipped
+	push(&notifications.StateChanged{PostingNumber: "1-1", NewState: "posting_awaiting_registration", ChangedStateDate: now.Add(time.Minute)})
+	push(&notifications.StateChanged{PostingNumber: "1-1", NewState: "posting_created", ChangedStateDate: now.Add(-time.Minute)})
+	push(&notifications.NewPosting{PostingNumber: "4-1", InProccessAt: now})
+
+	// Missed: state change of 2-1, cancellation of 3-1, new posting 5-1
+	// and state change of 6-1 processed long ago
+	now = now.Add(10 * time.Minute)
+	mock.set(
+		reconcilerPosting("1-1", "awaiting_deliver", "posting_awaiting_registration"),
+		reconcilerPosting("2-1", "delivering", "posting_transferring_to_delivery"),
+		reconcilerPosting("3-1", "cancelled", "posting_canceled"),
+		reconcilerPosting("4-1", "awaiting_packaging", "posting_created"),
+		reconcilerPosting("5-1", "awaiting_packaging", "posting_created"),
+		strings.Replace(reconcilerPosting("6-1", "delivering", "posting_in_carriage"), "2024-05-01", "2024-03-01", 1),
+	)
+	delivered, err := reconciler.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 4 {
+		t.Errorf("wrong number of delivered events: %d", len(delivered))
+	}
+
+	expected := []string{
+		"new 4-1",
+		"posting_awaiting_registration 1-1",
+		"posting_transferring_to_delivery 2-1",
+		"cancelled 3-1 from posting_in_carriage: Покупатель отменил заказ",
+		"new 5-1",
+		"posting_in_carriage 6-1",
+	}
+	if strings.Join(recorder.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events:\n%s", strings.Join(recorder.events, "\n"))
+	}
+	if recorder.reconciled[1] || !recorder.reconciled[2] {
+		t.Errorf("wrong event sources: %v", recorder.reconciled)
+	}
+	for i := 2; i < len(recorder.sellers); i++ {
+		if recorder.sellers[i] != 15 {
+			t.Errorf("synthesized events must have seller identifier: %v", recorder.sellers)
+		}
+	}
+
+	// Late push notification of a reconciled change is skipped
+	push(&notifications.StateChanged{PostingNumber: "2-1", NewState: "posting_transferring_to_delivery", ChangedStateDate: now.Add(-time.Minute)})
+	if len(recorder.events) != 6 {
+		t.Errorf("late notification must be skipped: %v", recorder.events)
+	}
+}
+
+func TestPostingReconcilerFailures(t *testing.T) {
+	t.Parallel()
+
+	mock := &fbsListMock{}
+	c := NewMockClient(mock.handler)
+	recorder := &postingEventsRecorder{fail: "cancelled 1-1 from : Покупатель отменил заказ"}
+	reconciler := NewPostingReconciler(c.FBS(), recorder.handlers(), WithReconcileInitialEvents(true))
+	reconciler.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	mock.set(reconcilerPosting("1-1", "cancelled", "posting_canceled"))
+	if _, err := reconciler.Reconcile(ctx); err == nil {
+		t.Fatal("expected handler error")
+	}
+	if len(recorder.events) != 1 || recorder.events[0] != "new 1-1" {
+		t.Errorf("wrong events: %v", recorder.events)
+	}
+
+	// New posting is not repeated, cancellation is retried
+	recorder.fail = ""
+	if _, err := reconciler.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.events) != 2 || recorder.events[1] != "cancelled 1-1 from : Покупатель отменил заказ" {
+		t.Errorf("wrong events: %v", recorder.events)
+	}
+	if _, err := reconciler.Reconcile(ctx); err != nil || len(recorder.events) != 2 {
+		t.Errorf("events must not be repeated: %v, %v", recorder.events, err)
+	}
+}
+
+func TestPostingReconcilerOutdatedList(t *testing.T) {
+	t.Parallel()
+
+	mock := &fbsListMock{}
+	c := NewMockClient(mock.handler)
+	recorder := &postingEventsRecorder{}
+	reconciler := NewPostingReconciler(c.FBS(), recorder.handlers())
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	reconciler.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	mock.set(
+		reconcilerPosting("1-1", "awaiting_packaging", "posting_created"),
+		reconcilerPosting("2-1", "awaiting_deliver", "posting_awaiting_registration"),
+	)
+	if _, err := reconciler.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2-1 is moved to carriage before the list, but the list is not updated yet
+	err := reconciler.HandleStateChanged(ctx, &notifications.StateChanged{PostingNumber: "2-1", NewState: "posting_in_carriage", ChangedStateDate: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.set(
+		reconcilerPosting("1-1", "awaiting_packaging", "posting_created"),
+		reconcilerPosting("2-1", "delivering", "posting_transferring_to_delivery"),
+	)
+	// 1-1 is changed while the list is requested
+	mock.onList = func() {
+		mock.onList = nil
+		err := reconciler.HandleStateChanged(ctx, &notifications.StateChanged{PostingNumber: "1-1", NewState: "posting_awaiting_registration", ChangedStateDate: now})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	now = now.Add(10 * time.Minute)
+	delivered, err := reconciler.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 0 {
+		t.Errorf("outdated states must not be synthesized: %v", delivered)
+	}
+	expected := []string{
+		"posting_in_carriage 2-1",
+		"posting_awaiting_registration 1-1",
+	}
+	if strings.Join(recorder.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events:\n%s", strings.Join(recorder.events, "\n"))
+	}
+}
+
+func TestPostingReconcilerConcurrentDelivery(t *testing.T) {
+	t.Parallel()
+
+	mock := &fbsListMock{}
+	c := NewMockClient(mock.handler)
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	reconciler := NewPostingReconciler(c.FBS(), PostingEventHandlers{
+		StateChanged: func(ctx context.Context, n *notifications.StateChanged) error {
+			if IsReconciledEvent(ctx) {
+				close(started)
+				<-unblock
+			}
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	mock.set(reconcilerPosting("1-1", "awaiting_packaging", "posting_created"))
+	if _, err := reconciler.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.set(reconcilerPosting("1-1", "awaiting_deliver", "posting_awaiting_registration"))
+	errs := make(chan error, 1)
+	go func() {
+		_, err := reconciler.Reconcile(ctx)
+		errs <- err
+	}()
+	<-started
+
+	// Events of other postings are not blocked by the delivery
+	pushCtx, pushCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer pushCancel()
+	err := reconciler.HandleStateChanged(pushCtx, &notifications.StateChanged{PostingNumber: "2-1", NewState: "posting_created", ChangedStateDate: time.Now()})
+	if err != nil {
+		t.Errorf("notification of another posting must be handled: %v", err)
+	}
+
+	// Events of the same posting wait until the context is done
+	err = reconciler.HandleStateChanged(pushCtx, &notifications.StateChanged{PostingNumber: "1-1", NewState: "posting_transferring_to_delivery", ChangedStateDate: time.Now()})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got: %v", err)
+	}
+
+	close(unblock)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,661 @@
+package ozon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	ratingDirectionHigherIsBetter = "HIGHER_IS_BETTER"
+	ratingDirectionLowerIsBetter  = "LOWER_IS_BETTER"
+
+	ratingStatusWarning  = "WARNING"
+	ratingStatusCritical = "CRITICAL"
+)
+
+// Value of a seller rating at the snapshot time
+type RatingValue struct {
+	// Ratings group name
+	Group string `json:"group"`
+
+	// System rating name
+	Rating string `json:"rating"`
+
+	// Rating name
+	Name string `json:"name"`
+
+	// Current rating value
+	Value float64 `json:"value"`
+
+	// Previous rating value
+	PastValue float64 `json:"past_value"`
+
+	// What should be the rating value to be considered good
+	Direction string `json:"direction"`
+
+	// Rating status
+	Status string `json:"status"`
+
+	// Value type
+	ValueType string `json:"value_type"`
+
+	// Rating threshold, after which a warning about possible blocking appears.
+	// Zero if history of the rating is unavailable
+	WarningThreshold float64 `json:"warning_threshold"`
+
+	// Rating threshold, after which sales will be blocked.
+	// Zero if history of the rating is unavailable
+	DangerThreshold float64 `json:"danger_threshold"`
+
+	// Trend of the rating for the monitor trend period
+	Trend *RatingTrend `json:"trend,omitempty"`
+}
+
+// Whether the value is worse than the threshold
+// according to the rating direction
+func (v RatingValue) isWorse(value, threshold float64) bool {
+	if v.lowerIsBetter() {
+		return value > threshold
+	}
+	return value < threshold
+}
+
+func (v RatingValue) lowerIsBetter() bool {
+	switch v.Direction {
+	case ratingDirectionLowerIsBetter:
+		return true
+	case ratingDirectionHigherIsBetter:
+		return false
+	}
+	// Direction is unknown, so it's defined by Ozon thresholds
+	return v.DangerThreshold > v.WarningThreshold
+}
+
+// Change of a rating value over time
+type RatingTrend struct {
+	// Change of the value per day
+	SlopePerDay float64 `json:"slope_per_day"`
+
+	// Number of values the trend is computed by
+	Points int `json:"points"`
+
+	// true, if the value changes towards the danger threshold
+	Worsening bool `json:"worsening"`
+
+	// Estimated number of days until the danger threshold is crossed.
+	// Zero if the value isn't worsening or the threshold is unknown
+	DaysToDanger float64 `json:"days_to_danger,omitempty"`
+}
+
+// Seller ratings at some moment
+type RatingSnapshot struct {
+	// Snapshot time
+	Time time.Time `json:"time"`
+
+	// Ratings values
+	Ratings []RatingValue `json:"ratings"`
+
+	// An indication that the penalty points balance is exceeded
+	PenaltyScoreExceeded bool `json:"penalty_score_exceeded"`
+
+	// An indication that you participate in the Premium program
+	Premium bool `json:"premium"`
+}
+
+// Storage of rating snapshots
+type RatingStore interface {
+	Save(snapshot *RatingSnapshot) error
+
+	// Returns snapshots taken since the time in chronological order
+	Snapshots(since time.Time) ([]RatingSnapshot, error)
+}
+
+// Keeps snapshots in memory
+type MemoryRatingStore struct {
+	mu        sync.Mutex
+	snapshots []RatingSnapshot
+}
+
+func (s *MemoryRatingStore) Save(snapshot *RatingSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshots = append(s.snapshots, *snapshot)
+	return nil
+}
+
+func (s *MemoryRatingStore) Snapshots(since time.Time) ([]RatingSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots := []RatingSnapshot{}
+	for _, snapshot := range s.snapshots {
+		if !snapshot.Time.Before(since) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// Appends snapshots to a file as JSON lines
+type FileRatingStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (s *FileRatingStore) Save(snapshot *RatingSnapshot) error {
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *FileRatingStore) Snapshots(since time.Time) ([]RatingSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots := []RatingSnapshot{}
+
+	file, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return snapshots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		snapshot := RatingSnapshot{}
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+			return nil, fmt.Errorf("read rating snapshot: %w", err)
+		}
+		if !snapshot.Time.Before(since) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, scanner.Err()
+}
+
+// What caused the alert
+type RatingAlertKind string
+
+const (
+	// Rating crossed a threshold set in the monitor
+	RatingAlertThreshold RatingAlertKind = "threshold"
+
+	// Ozon marked the rating as requiring attention or critical
+	RatingAlertDangerZone RatingAlertKind = "danger_zone"
+
+	// Rating is expected to cross the danger threshold soon
+	RatingAlertTrend RatingAlertKind = "trend"
+
+	// Penalty points balance is exceeded
+	RatingAlertPenalty RatingAlertKind = "penalty"
+)
+
+type RatingAlertLevel string
+
+const (
+	RatingAlertWarning  RatingAlertLevel = "warning"
+	RatingAlertCritical RatingAlertLevel = "critical"
+)
+
+// Alert about a rating that may get the account restricted
+type RatingAlert struct {
+	// Alert time
+	Time time.Time `json:"time"`
+
+	Kind RatingAlertKind `json:"kind"`
+
+	Level RatingAlertLevel `json:"level"`
+
+	// System rating name. Empty for penalty alerts
+	Rating string `json:"rating,omitempty"`
+
+	// Rating name
+	Name string `json:"name,omitempty"`
+
+	// Current rating value
+	Value float64 `json:"value"`
+
+	// Crossed or approached threshold
+	Threshold float64 `json:"threshold"`
+
+	// Trend of the rating
+	Trend *RatingTrend `json:"trend,omitempty"`
+
+	// Human readable description
+	Message string `json:"message"`
+}
+
+// Receiver of rating alerts
+type RatingAlerter interface {
+	Alert(ctx context.Context, alert RatingAlert) error
+}
+
+// Writes alerts to a logger
+type LogRatingAlerter struct {
+	// Default is the standard logger
+	Logger *log.Logger
+}
+
+func (a LogRatingAlerter) Alert(ctx context.Context, alert RatingAlert) error {
+	logger := a.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	logger.Printf("rating alert [%s] %s: %s", alert.Level, alert.Kind, alert.Message)
+	return nil
+}
+
+// Sends alerts to a URL as JSON
+type WebhookRatingAlerter struct {
+	URL string
+
+	// Default is http.DefaultClient
+	Client *http.Client
+}
+
+func (a WebhookRatingAlerter) Alert(ctx context.Context, alert RatingAlert) error {
+	content, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("send rating alert: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sends alerts to a channel
+type ChanRatingAlerter chan RatingAlert
+
+func (a ChanRatingAlerter) Alert(ctx context.Context, alert RatingAlert) error {
+	select {
+	case a <- alert:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Monitor thresholds of a rating in the rating units.
+// Zero threshold is not checked
+type RatingThreshold struct {
+	Warning float64
+
+	Critical float64
+}
+
+type RatingMonitorOption func(m *RatingMonitor)
+
+// Storage of snapshots. Default is MemoryRatingStore
+func WithRatingStore(store RatingStore) RatingMonitorOption {
+	return func(m *RatingMonitor) {
+		m.store = store
+	}
+}
+
+// Thresholds by system rating name
+func WithRatingThresholds(thresholds map[string]RatingThreshold) RatingMonitorOption {
+	return func(m *RatingMonitor) {
+		m.thresholds = thresholds
+	}
+}
+
+// Period of rating history used to compute trends. Default is 30 days
+func WithRatingTrendPeriod(period time.Duration) RatingMonitorOption {
+	return func(m *RatingMonitor) {
+		m.trendPeriod = period
+	}
+}
+
+// Trend alert is sent if the rating is expected
+// to cross the danger threshold within the horizon.
+// Default is 14 days
+func WithRatingTrendHorizon(horizon time.Duration) RatingMonitorOption {
+	return func(m *RatingMonitor) {
+		m.trendHorizon = horizon
+	}
+}
+
+// Interval between checks in Run. Default is 1 hour
+func WithRatingPollInterval(interval time.Duration) RatingMonitorOption {
+	return func(m *RatingMonitor) {
+		m.pollInterval = interval
+	}
+}
+
+// Called for errors in Run. Default handler logs errors
+func WithRatingErrorHandler(handler func(err error)) RatingMonitorOption {
+	return func(m *RatingMonitor) {
+		m.onError = handler
+	}
+}
+
+// Snapshots seller ratings and alerts when a rating crosses
+// a threshold, gets into Ozon danger zone or trends towards it.
+//
+// An alert is sent once until its level changes
+// or the rating gets back to normal
+type RatingMonitor struct {
+	rating  *Rating
+	alerter RatingAlerter
+
+	store        RatingStore
+	thresholds   map[string]RatingThreshold
+	trendPeriod  time.Duration
+	trendHorizon time.Duration
+	pollInterval time.Duration
+	onError      func(err error)
+	now          func() time.Time
+
+	mu     sync.Mutex
+	active map[string]RatingAlertLevel
+}
+
+func NewRatingMonitor(rating *Rating, alerter RatingAlerter, opts ...RatingMonitorOption) *RatingMonitor {
+	m := &RatingMonitor{
+		rating:       rating,
+		alerter:      alerter,
+		store:        &MemoryRatingStore{},
+		thresholds:   map[string]RatingThreshold{},
+		trendPeriod:  30 * 24 * time.Hour,
+		trendHorizon: 14 * 24 * time.Hour,
+		pollInterval: time.Hour,
+		onError: func(err error) {
+			log.Print(err)
+		},
+		now:    time.Now,
+		active: map[string]RatingAlertLevel{},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Checks ratings until the context is canceled
+func (m *RatingMonitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, _, err := m.Check(ctx); err != nil && ctx.Err() == nil {
+			m.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Takes a snapshot of ratings, saves it to the store
+// and sends new alerts. Returns the snapshot and sent alerts
+func (m *RatingMonitor) Check(ctx context.Context) (*RatingSnapshot, []RatingAlert, error) {
+	snapshot, err := m.Snapshot(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := m.store.Save(snapshot); err != nil {
+		return snapshot, nil, err
+	}
+
+	alerts := m.newAlerts(m.alerts(snapshot))
+	for i, alert := range alerts {
+		if err := m.alerter.Alert(ctx, alert); err != nil {
+			// Unsent alerts are sent on the next check
+			m.forget(alerts[i:])
+			return snapshot, alerts[:i], err
+		}
+	}
+	return snapshot, alerts, nil
+}
+
+// Returns snapshots saved since the time
+func (m *RatingMonitor) History(since time.Time) ([]RatingSnapshot, error) {
+	return m.store.Snapshots(since)
+}
+
+// Takes a snapshot of current ratings with Ozon thresholds
+// and trends computed from the rating history
+func (m *RatingMonitor) Snapshot(ctx context.Context) (*RatingSnapshot, error) {
+	current, err := m.rating.GetCurrentSellerRatingInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get current rating: %d %s", current.StatusCode, current.Message)
+	}
+
+	now := m.now()
+	snapshot := &RatingSnapshot{
+		Time:                 now,
+		PenaltyScoreExceeded: current.PenaltyScoreExceeded,
+		Premium:              current.Premium,
+	}
+	ratings := []string{}
+	for _, group := range current.Groups {
+		for _, item := range group.Items {
+			snapshot.Ratings = append(snapshot.Ratings, RatingValue{
+				Group:     group.GroupName,
+				Rating:    item.Rating,
+				Name:      item.Name,
+				Value:     item.CurrentValue,
+				PastValue: item.PastValue,
+				Direction: item.RatingDirection,
+				Status:    item.Status,
+				ValueType: item.ValueType,
+			})
+			ratings = append(ratings, item.Rating)
+		}
+	}
+	if len(ratings) == 0 {
+		return snapshot, nil
+	}
+
+	history, err := m.rating.GetSellerRatingInfoForPeriod(ctx, &GetSellerRatingInfoForPeriodParams{
+		DateFrom: now.Add(-m.trendPeriod),
+		DateTo:   now,
+		Ratings:  ratings,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if history.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get rating history: %d %s", history.StatusCode, history.Message)
+	}
+
+	byRating := map[string]GetSellerRatingInfoPeriodRating{}
+	for _, rating := range history.Ratings {
+		byRating[rating.Rating] = rating
+	}
+	for i := range snapshot.Ratings {
+		value := &snapshot.Ratings[i]
+		rating, ok := byRating[value.Rating]
+		if !ok {
+			continue
+		}
+
+		value.WarningThreshold = rating.WarningThreshold
+		value.DangerThreshold = rating.DangerThreshold
+		value.Trend = computeRatingTrend(*value, rating.Values)
+	}
+
+	return snapshot, nil
+}
+
+// Computes the trend by linear regression of history values.
+// Returns nil if there are less than 2 values
+func computeRatingTrend(value RatingValue, history []GetSellerRatingInfoPeriodRatingValue) *RatingTrend {
+	if len(history) < 2 {
+		return nil
+	}
+
+	start := history[0].DateTo
+	var sumX, sumY, sumXY, sumXX float64
+	for _, point := range history {
+		x := point.DateTo.Sub(start).Hours() / 24
+		sumX += x
+		sumY += point.Value
+		sumXY += x * point.Value
+		sumXX += x * x
+	}
+	n := float64(len(history))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return nil
+	}
+
+	trend := &RatingTrend{
+		SlopePerDay: (n*sumXY - sumX*sumY) / denominator,
+		Points:      len(history),
+	}
+	if value.lowerIsBetter() {
+		trend.Worsening = trend.SlopePerDay > 0
+	} else {
+		trend.Worsening = trend.SlopePerDay < 0
+	}
+
+	if trend.Worsening && value.DangerThreshold != 0 && !value.isWorse(value.Value, value.DangerThreshold) {
+		trend.DaysToDanger = math.Abs((value.DangerThreshold - value.Value) / trend.SlopePerDay)
+	}
+	return trend
+}
+
+func (m *RatingMonitor) alerts(snapshot *RatingSnapshot) []RatingAlert {
+	alerts := []RatingAlert{}
+	alert := func(kind RatingAlertKind, level RatingAlertLevel, value *RatingValue, threshold float64, message string) {
+		a := RatingAlert{
+			Time:      snapshot.Time,
+			Kind:      kind,
+			Level:     level,
+			Threshold: threshold,
+			Message:   message,
+		}
+		if value != nil {
+			a.Rating = value.Rating
+			a.Name = value.Name
+			a.Value = value.Value
+			a.Trend = value.Trend
+		}
+		alerts = append(alerts, a)
+	}
+
+	if snapshot.PenaltyScoreExceeded {
+		alert(RatingAlertPenalty, RatingAlertCritical, nil, 0, "penalty points balance is exceeded")
+	}
+
+	for i := range snapshot.Ratings {
+		value := &snapshot.Ratings[i]
+
+		threshold := m.thresholds[value.Rating]
+		if threshold.Critical != 0 && value.isWorse(value.Value, threshold.Critical) {
+			alert(RatingAlertThreshold, RatingAlertCritical, value, threshold.Critical,
+				fmt.Sprintf("%s is %v, critical threshold is %v", value.Name, value.Value, threshold.Critical))
+		} else if threshold.Warning != 0 && value.isWorse(value.Value, threshold.Warning) {
+			alert(RatingAlertThreshold, RatingAlertWarning, value, threshold.Warning,
+				fmt.Sprintf("%s is %v, warning threshold is %v", value.Name, value.Value, threshold.Warning))
+		}
+
+		switch value.Status {
+		case ratingStatusCritical:
+			alert(RatingAlertDangerZone, RatingAlertCritical, value, value.DangerThreshold,
+				fmt.Sprintf("%s is %v, Ozon marked it as critical", value.Name, value.Value))
+		case ratingStatusWarning:
+			alert(RatingAlertDangerZone, RatingAlertWarning, value, value.WarningThreshold,
+				fmt.Sprintf("%s is %v, Ozon marked it as requiring attention", value.Name, value.Value))
+		}
+
+		horizon := m.trendHorizon.Hours() / 24
+		if value.Trend != nil && value.Trend.DaysToDanger > 0 && value.Trend.DaysToDanger <= horizon {
+			alert(RatingAlertTrend, RatingAlertWarning, value, value.DangerThreshold,
+				fmt.Sprintf("%s is %v and may cross danger threshold %v in %.0f days",
+					value.Name, value.Value, value.DangerThreshold, math.Ceil(value.Trend.DaysToDanger)))
+		}
+	}
+
+	return alerts
+}
+
+// Returns alerts that weren't sent before with the same level
+// and forgets alerts that are resolved
+func (m *RatingMonitor) newAlerts(alerts []RatingAlert) []RatingAlert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	active := map[string]RatingAlertLevel{}
+	result := []RatingAlert{}
+	for _, alert := range alerts {
+		key := string(alert.Kind) + "/" + alert.Rating
+		active[key] = alert.Level
+		if m.active[key] != alert.Level {
+			result = append(result, alert)
+		}
+	}
+	m.active = active
+
+	return result
+}
+
+func (m *RatingMonitor) forget(alerts []RatingAlert) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, alert := range alerts {
+		delete(m.active, string(alert.Kind)+"/"+alert.Rating)
+	}
+}
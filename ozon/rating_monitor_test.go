@@ -0,0 +1,200 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type ratingMonitorMock struct {
+	mu        sync.Mutex
+	histories []GetSellerRatingInfoForPeriodParams
+	penalty   bool
+}
+
+func (m *ratingMonitorMock) handler(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var response string
+	switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+	case "/v1/rating/summary":
+		response = fmt.Sprintf(`{
+			"groups": [{
+				"group_name": "Orders",
+				"items": [
+					{"current_value": 1.8, "name": "Cancellations", "rating": "rating_order_cancellation", "rating_direction": "LOWER_IS_BETTER", "status": "OK"},
+					{"current_value": 4.5, "name": "Reviews", "rating": "rating_review_avg_score_total", "rating_direction": "HIGHER_IS_BETTER", "status": "WARNING"}
+				]
+			}],
+			"penalty_score_exceeded": %v
+		}`, m.penalty)
+	case "/v1/rating/history":
+		params := GetSellerRatingInfoForPeriodParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+		m.histories = append(m.histories, params)
+
+		response = `{"ratings": [
+			{
+				"rating": "rating_order_cancellation",
+				"warning_threshold": 2,
+				"danger_threshold": 3,
+				"values": [
+					{"date_to": "2024-01-01T00:00:00Z", "value": 0.8},
+					{"date_to": "2024-01-06T00:00:00Z", "value": 1.3},
+					{"date_to": "2024-01-11T00:00:00Z", "value": 1.8}
+				]
+			},
+			{
+				"rating": "rating_review_avg_score_total",
+				"warning_threshold": 4.6,
+				"danger_threshold": 4,
+				"values": [
+					{"date_to": "2024-01-01T00:00:00Z", "value": 4.5},
+					{"date_to": "2024-01-11T00:00:00Z", "value": 4.5}
+				]
+			}
+		]}`
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(response))
+}
+
+func TestRatingMonitor(t *testing.T) {
+	t.Parallel()
+
+	mock := &ratingMonitorMock{penalty: true}
+	c := NewMockClient(mock.handler)
+
+	alerts := make(ChanRatingAlerter, 10)
+	store := &FileRatingStore{Path: filepath.Join(t.TempDir(), "ratings.jsonl")}
+	monitor := NewRatingMonitor(c.Rating(), alerts,
+		WithRatingStore(store),
+		WithRatingThresholds(map[string]RatingThreshold{
+			"rating_order_cancellation": {Warning: 1.5, Critical: 2.5},
+		}),
+	)
+	now := time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)
+	monitor.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	snapshot, sent, err := monitor.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancellations := snapshot.Ratings[0]
+	if cancellations.DangerThreshold != 3 || cancellations.Trend == nil || !cancellations.Trend.Worsening ||
+		!almostEqual(cancellations.Trend.SlopePerDay, 0.1) || !almostEqual(cancellations.Trend.DaysToDanger, 12) {
+		t.Errorf("wrong cancellations rating: %+v %+v", cancellations, cancellations.Trend)
+	}
+	if reviews := snapshot.Ratings[1]; reviews.Trend == nil || reviews.Trend.Worsening || reviews.Trend.DaysToDanger != 0 {
+		t.Errorf("wrong reviews rating: %+v", reviews)
+	}
+
+	expected := []struct {
+		kind   RatingAlertKind
+		level  RatingAlertLevel
+		rating string
+	}{
+		{RatingAlertPenalty, RatingAlertCritical, ""},
+		{RatingAlertThreshold, RatingAlertWarning, "rating_order_cancellation"},
+		{RatingAlertTrend, RatingAlertWarning, "rating_order_cancellation"},
+		{RatingAlertDangerZone, RatingAlertWarning, "rating_review_avg_score_total"},
+	}
+	if len(sent) != len(expected) || len(alerts) != len(expected) {
+		t.Fatalf("wrong alerts: %+v", sent)
+	}
+	for i, e := range expected {
+		alert := <-alerts
+		if alert.Kind != e.kind || alert.Level != e.level || alert.Rating != e.rating {
+			t.Errorf("wrong alert: %+v", alert)
+		}
+		if alert != sent[i] {
+			t.Errorf("sent alerts differ: %+v %+v", alert, sent[i])
+		}
+	}
+
+	mock.mu.Lock()
+	if len(mock.histories) != 1 || len(mock.histories[0].Ratings) != 2 || !mock.histories[0].DateFrom.Equal(now.Add(-30*24*time.Hour)) {
+		t.Errorf("wrong history params: %+v", mock.histories)
+	}
+	mock.penalty = false
+	mock.mu.Unlock()
+
+	// Alerts are sent once
+	now = now.Add(time.Hour)
+	_, sent, err = monitor.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 0 {
+		t.Errorf("alerts must not be sent again, got: %+v", sent)
+	}
+
+	mock.mu.Lock()
+	mock.penalty = true
+	mock.mu.Unlock()
+
+	// Resolved alerts are sent again
+	now = now.Add(time.Hour)
+	_, sent, err = monitor.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || sent[0].Kind != RatingAlertPenalty {
+		t.Errorf("wrong alerts: %+v", sent)
+	}
+
+	history, err := monitor.History(now.Add(-90 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].PenaltyScoreExceeded || !history[1].PenaltyScoreExceeded {
+		t.Errorf("wrong history: %+v", history)
+	}
+}
+
+func TestWebhookRatingAlerter(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan RatingAlert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alert := RatingAlert{}
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- alert
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	alerter := WebhookRatingAlerter{URL: server.URL}
+	if err := alerter.Alert(ctx, RatingAlert{Kind: RatingAlertPenalty, Level: RatingAlertCritical}); err != nil {
+		t.Fatal(err)
+	}
+	if alert := <-received; alert.Kind != RatingAlertPenalty || alert.Level != RatingAlertCritical {
+		t.Errorf("wrong alert: %+v", alert)
+	}
+
+	alerter.URL = server.URL + "/%"
+	if err := alerter.Alert(ctx, RatingAlert{}); err == nil {
+		t.Errorf("expected error for invalid URL")
+	}
+}
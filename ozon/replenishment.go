@@ -0,0 +1,461 @@
+package ozon
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	core "github.com/diphantxm/ozon-api-client"
+)
+
+// Forecasts average daily demand from daily sales history
+type DemandModel interface {
+	// History is ordered from the oldest day to the latest one
+	Forecast(history []float64) float64
+}
+
+// Average of the last days of history
+type MovingAverage struct {
+	// Number of days to average. The whole history is used if 0
+	Window int
+}
+
+func (m MovingAverage) Forecast(history []float64) float64 {
+	if len(history) == 0 {
+		return 0
+	}
+
+	window := m.Window
+	if window <= 0 || window > len(history) {
+		window = len(history)
+	}
+
+	var sum float64
+	for _, value := range history[len(history)-window:] {
+		sum += value
+	}
+	return sum / float64(window)
+}
+
+// Simple exponential smoothing, recent days have larger weights
+type ExponentialSmoothing struct {
+	// Smoothing factor from 0 to 1
+	Alpha float64
+}
+
+func (m ExponentialSmoothing) Forecast(history []float64) float64 {
+	if len(history) == 0 {
+		return 0
+	}
+
+	level := history[0]
+	for _, value := range history[1:] {
+		level = m.Alpha*value + (1-m.Alpha)*level
+	}
+	return level
+}
+
+// Product stock in a cluster
+type ClusterStock struct {
+	// Cluster identifier
+	ClusterId int64 `json:"cluster_id"`
+
+	// Product identifier in the Ozon system, SKU
+	SKU int64 `json:"sku"`
+
+	// Product amount available for sale
+	Available int64 `json:"available"`
+
+	// Product amount in confirmed future supplies
+	InTransit int64 `json:"in_transit"`
+}
+
+type ReplenishmentInput struct {
+	// Clusters to plan supplies to
+	Clusters []Cluster
+
+	// Daily ordered units by SKU, from the oldest day to the latest one
+	Sales map[int64][]float64
+
+	// Average daily sales by SKU. Used if there is no sales history for SKU
+	AverageDailySales map[int64]float64
+
+	// Product stocks in clusters
+	Stocks []ClusterStock
+}
+
+type ReplenishmentPlanner struct {
+	// Demand forecasting model.
+	//
+	// Default is 28 days moving average
+	Model DemandModel
+
+	// Days from creating a supply until products are available for sale
+	LeadTimeDays float64
+
+	// Days the stock must last after a supply arrives
+	CoverageDays float64
+
+	// Extra days of stock kept in case of demand spikes
+	SafetyDays float64
+
+	// Share of SKU demand by cluster identifier.
+	// Demand is split evenly between clusters if empty
+	ClusterShares map[int64]float64
+}
+
+type ReplenishmentPlan struct {
+	// Products stock and suggested supplies for each cluster
+	Items []ReplenishmentItem `json:"items"`
+}
+
+type ReplenishmentItem struct {
+	// Cluster identifier
+	ClusterId int64 `json:"cluster_id"`
+
+	// Cluster name
+	ClusterName string `json:"cluster_name"`
+
+	// Product identifier in the Ozon system, SKU
+	SKU int64 `json:"sku"`
+
+	// Product amount available for sale and in confirmed supplies
+	Stock int64 `json:"stock"`
+
+	// Forecasted daily demand in the cluster
+	DailyDemand float64 `json:"daily_demand"`
+
+	// Number of days the stock will last.
+	//
+	// Nullable if there is no demand
+	DaysOfStock *float64 `json:"days_of_stock"`
+
+	// Suggested supply quantity
+	SupplyQuantity int32 `json:"supply_quantity"`
+}
+
+// Estimates days of stock and suggests supply quantities
+// for each SKU and cluster
+func (p *ReplenishmentPlanner) Plan(input *ReplenishmentInput) *ReplenishmentPlan {
+	model := p.Model
+	if model == nil {
+		model = MovingAverage{Window: 28}
+	}
+
+	type key struct {
+		clusterId int64
+		sku       int64
+	}
+	stocks := map[key]int64{}
+	skus := map[int64]struct{}{}
+	for _, stock := range input.Stocks {
+		stocks[key{stock.ClusterId, stock.SKU}] += stock.Available + stock.InTransit
+		skus[stock.SKU] = struct{}{}
+	}
+	for sku := range input.Sales {
+		skus[sku] = struct{}{}
+	}
+	for sku := range input.AverageDailySales {
+		skus[sku] = struct{}{}
+	}
+
+	sortedSKUs := make([]int64, 0, len(skus))
+	for sku := range skus {
+		sortedSKUs = append(sortedSKUs, sku)
+	}
+	sort.Slice(sortedSKUs, func(i, j int) bool { return sortedSKUs[i] < sortedSKUs[j] })
+
+	plan := &ReplenishmentPlan{}
+	for _, cluster := range input.Clusters {
+		share := p.clusterShare(cluster.Id, len(input.Clusters))
+
+		for _, sku := range sortedSKUs {
+			var demand float64
+			if history, ok := input.Sales[sku]; ok && len(history) > 0 {
+				demand = model.Forecast(history)
+			} else {
+				demand = input.AverageDailySales[sku]
+			}
+			demand *= share
+
+			item := ReplenishmentItem{
+				ClusterId:   cluster.Id,
+				ClusterName: cluster.Name,
+				SKU:         sku,
+				Stock:       stocks[key{cluster.Id, sku}],
+				DailyDemand: demand,
+			}
+			if demand > 0 {
+				days := float64(item.Stock) / demand
+				item.DaysOfStock = &days
+			}
+
+			need := demand*(p.LeadTimeDays+p.CoverageDays+p.SafetyDays) - float64(item.Stock)
+			if need > 0 {
+				item.SupplyQuantity = int32(math.Ceil(need))
+			}
+
+			plan.Items = append(plan.Items, item)
+		}
+	}
+
+	return plan
+}
+
+func (p *ReplenishmentPlanner) clusterShare(clusterId int64, clusters int) float64 {
+	if len(p.ClusterShares) == 0 {
+		return 1 / float64(clusters)
+	}
+	return p.ClusterShares[clusterId]
+}
+
+// Builds supply draft parameters for each cluster with suggested supplies
+func (p *ReplenishmentPlan) SupplyDraftParams(supplyType string) []*CreateSupplyDraftParams {
+	params := []*CreateSupplyDraftParams{}
+	byCluster := map[int64]*CreateSupplyDraftParams{}
+
+	for _, item := range p.Items {
+		if item.SupplyQuantity <= 0 {
+			continue
+		}
+
+		draft, ok := byCluster[item.ClusterId]
+		if !ok {
+			draft = &CreateSupplyDraftParams{
+				ClusterIds: []string{strconv.FormatInt(item.ClusterId, 10)},
+				Type:       supplyType,
+			}
+			byCluster[item.ClusterId] = draft
+			params = append(params, draft)
+		}
+
+		draft.Items = append(draft.Items, CreateSupplyDraftItem{
+			Quantity: item.SupplyQuantity,
+			SKU:      item.SKU,
+		})
+	}
+
+	return params
+}
+
+// Maximum number of rows in one page of stocks and turnover
+const replenishmentPageSize = 1000
+
+type GetReplenishmentInputParams struct {
+	// Product identifiers in the Ozon system, SKU.
+	//
+	// All products are collected if empty
+	SKUs []int64
+
+	// Cluster type
+	ClusterType string
+
+	// Number of days of sales history
+	//
+	// Default is 60
+	HistoryDays int
+
+	// Date of the latest day of sales history.
+	//
+	// Default is yesterday
+	Date time.Time
+}
+
+// Collects clusters, stocks and sales history needed to plan supplies.
+//
+// Warehouses are matched with clusters by name
+func GetReplenishmentInput(ctx context.Context, c *Client, params *GetReplenishmentInputParams) (*ReplenishmentInput, error) {
+	clusters, err := c.Clusters().List(ctx, &ListClustersParams{ClusterType: params.ClusterType})
+	if err != nil {
+		return nil, err
+	}
+	if clusters.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list clusters: %d %s", clusters.StatusCode, clusters.Message)
+	}
+
+	input := &ReplenishmentInput{
+		Clusters:          clusters.Clusters,
+		Sales:             map[int64][]float64{},
+		AverageDailySales: map[int64]float64{},
+	}
+
+	warehouseClusters := map[string]int64{}
+	for _, cluster := range clusters.Clusters {
+		for _, logisticCluster := range cluster.LogisticClusters {
+			for _, warehouse := range logisticCluster.Warehouses {
+				warehouseClusters[warehouse.Name] = cluster.Id
+			}
+		}
+	}
+
+	skus := make([]string, 0, len(params.SKUs))
+	wanted := make(map[int64]struct{}, len(params.SKUs))
+	for _, sku := range params.SKUs {
+		skus = append(skus, strconv.FormatInt(sku, 10))
+		wanted[sku] = struct{}{}
+	}
+	isWanted := func(sku int64) bool {
+		if len(wanted) == 0 {
+			return true
+		}
+		_, ok := wanted[sku]
+		return ok
+	}
+
+	stocks := &GetStockManagementParams{
+		Filter: GetStockManagementFilter{SKUs: skus},
+		Limit:  replenishmentPageSize,
+	}
+	for {
+		resp, err := c.Analytics().Stock(ctx, stocks)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("get stocks: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		for _, item := range resp.Items {
+			clusterId, ok := warehouseClusters[item.WarehouseName]
+			if !ok || !isWanted(item.SKU) {
+				continue
+			}
+			input.Stocks = append(input.Stocks, ClusterStock{
+				ClusterId: clusterId,
+				SKU:       item.SKU,
+				Available: item.ValidCount,
+			})
+		}
+
+		if len(resp.Items) < int(stocks.Limit) {
+			break
+		}
+		stocks.Offset += stocks.Limit
+	}
+
+	warehouseStocks := &GetStocksOnWarehousesParams{Limit: replenishmentPageSize}
+	for {
+		resp, err := c.Analytics().GetStocksOnWarehouses(ctx, warehouseStocks)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("get stocks on warehouses: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		for _, row := range resp.Result.Rows {
+			clusterId, ok := warehouseClusters[row.WarehouseName]
+			if !ok || !isWanted(row.SKU) || row.PromisedAmount == 0 {
+				continue
+			}
+			input.Stocks = append(input.Stocks, ClusterStock{
+				ClusterId: clusterId,
+				SKU:       row.SKU,
+				InTransit: row.PromisedAmount,
+			})
+		}
+
+		if int64(len(resp.Result.Rows)) < warehouseStocks.Limit {
+			break
+		}
+		warehouseStocks.Offset += warehouseStocks.Limit
+	}
+
+	turnover := &GetProductTurnoverParams{SKU: skus, Limit: replenishmentPageSize}
+	for {
+		resp, err := c.Analytics().GetProductTurnover(ctx, turnover)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("get product turnover: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		for _, item := range resp.Items {
+			if isWanted(item.SKU) {
+				input.AverageDailySales[item.SKU] = item.Ads
+			}
+		}
+
+		if int64(len(resp.Items)) < turnover.Limit {
+			break
+		}
+		turnover.Offset += int32(turnover.Limit)
+	}
+
+	historyDays := params.HistoryDays
+	if historyDays <= 0 {
+		historyDays = 60
+	}
+	dateTo := params.Date
+	if dateTo.IsZero() {
+		dateTo = time.Now().AddDate(0, 0, -1)
+	}
+	dateTo = time.Date(dateTo.Year(), dateTo.Month(), dateTo.Day(), 0, 0, 0, 0, time.UTC)
+	dateFrom := dateTo.AddDate(0, 0, 1-historyDays)
+
+	// Analytics filters don't support a list of values,
+	// so sales are requested for each SKU separately
+	queries := []*AnalyticsSeriesQuery{}
+	newQuery := func(filters []GetAnalyticsDataFilter) *AnalyticsSeriesQuery {
+		return &AnalyticsSeriesQuery{
+			DateFrom:  dateFrom,
+			DateTo:    dateTo,
+			Dimension: []GetAnalyticsDataDimension{SKUDimension, DayDimension},
+			Metrics:   []GetAnalyticsDataFilterMetric{OrderedUnits},
+			Filters:   filters,
+		}
+	}
+	if len(skus) == 0 {
+		queries = append(queries, newQuery(nil))
+	}
+	for _, sku := range skus {
+		queries = append(queries, newQuery([]GetAnalyticsDataFilter{
+			{Key: string(SKUDimension), Operation: Equal, Value: sku},
+		}))
+	}
+
+	for _, query := range queries {
+		series, err := c.Analytics().Series(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		addSalesHistory(input.Sales, series, dateFrom, historyDays, isWanted)
+	}
+
+	return input, nil
+}
+
+// Adds ordered units of series rows to daily sales history
+func addSalesHistory(sales map[int64][]float64, series *AnalyticsSeries, dateFrom time.Time, historyDays int, isWanted func(sku int64) bool) {
+	for _, row := range series.Rows {
+		if len(row.Dimensions) < 2 || len(row.Metrics) == 0 {
+			continue
+		}
+
+		sku, err := strconv.ParseInt(row.Dimensions[0].Id, 10, 64)
+		if err != nil || !isWanted(sku) {
+			continue
+		}
+		day, err := time.Parse(core.ShortDateLayout, row.Dimensions[1].Id)
+		if err != nil {
+			continue
+		}
+
+		index := int(day.Sub(dateFrom).Hours() / 24)
+		if index < 0 || index >= historyDays {
+			continue
+		}
+
+		history, ok := sales[sku]
+		if !ok {
+			history = make([]float64, historyDays)
+			sales[sku] = history
+		}
+		history[index] += row.Metrics[0]
+	}
+}
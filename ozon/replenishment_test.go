@@ -0,0 +1,292 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDemandModels(t *testing.T) {
+	t.Parallel()
+
+	history := []float64{10, 0, 4, 8}
+
+	tests := []struct {
+		model    DemandModel
+		expected float64
+	}{
+		{MovingAverage{}, 5.5},
+		{MovingAverage{Window: 2}, 6},
+		{MovingAverage{Window: 10}, 5.5},
+		{ExponentialSmoothing{Alpha: 0.5}, 6.25},
+		{ExponentialSmoothing{Alpha: 1}, 8},
+	}
+
+	for _, test := range tests {
+		if got := test.model.Forecast(history); !almostEqual(got, test.expected) {
+			t.Errorf("wrong forecast for %#v: got: %f, expected: %f", test.model, got, test.expected)
+		}
+		if got := test.model.Forecast(nil); got != 0 {
+			t.Errorf("forecast of empty history must be 0, got: %f", got)
+		}
+	}
+}
+
+func TestReplenishmentPlan(t *testing.T) {
+	t.Parallel()
+
+	planner := &ReplenishmentPlanner{
+		Model:         MovingAverage{},
+		LeadTimeDays:  5,
+		CoverageDays:  20,
+		SafetyDays:    5,
+		ClusterShares: map[int64]float64{1: 0.75, 2: 0.25},
+	}
+	plan := planner.Plan(&ReplenishmentInput{
+		Clusters: []Cluster{{Id: 1, Name: "first"}, {Id: 2, Name: "second"}},
+		Sales: map[int64][]float64{
+			100: {4, 4, 4, 4},
+		},
+		AverageDailySales: map[int64]float64{
+			200: 1,
+		},
+		Stocks: []ClusterStock{
+			{ClusterId: 1, SKU: 100, Available: 50, InTransit: 10},
+			{ClusterId: 2, SKU: 100, Available: 40},
+			{ClusterId: 2, SKU: 200, Available: 3},
+		},
+	})
+
+	if len(plan.Items) != 4 {
+		t.Fatalf("expected 4 items, got: %d", len(plan.Items))
+	}
+
+	expected := []struct {
+		clusterId   int64
+		sku         int64
+		stock       int64
+		demand      float64
+		daysOfStock float64
+		quantity    int32
+	}{
+		{1, 100, 60, 3, 20, 30},
+		{1, 200, 0, 0.75, 0, 23},
+		{2, 100, 40, 1, 40, 0},
+		{2, 200, 3, 0.25, 12, 5},
+	}
+	for i, item := range plan.Items {
+		if item.ClusterId != expected[i].clusterId || item.SKU != expected[i].sku {
+			t.Errorf("wrong item %d: %+v", i, item)
+			continue
+		}
+		if item.Stock != expected[i].stock {
+			t.Errorf("wrong stock of item %d: got: %d, expected: %d", i, item.Stock, expected[i].stock)
+		}
+		if !almostEqual(item.DailyDemand, expected[i].demand) {
+			t.Errorf("wrong demand of item %d: got: %f, expected: %f", i, item.DailyDemand, expected[i].demand)
+		}
+		if item.DaysOfStock == nil || !almostEqual(*item.DaysOfStock, expected[i].daysOfStock) {
+			t.Errorf("wrong days of stock of item %d: got: %v, expected: %f", i, item.DaysOfStock, expected[i].daysOfStock)
+		}
+		if item.SupplyQuantity != expected[i].quantity {
+			t.Errorf("wrong supply quantity of item %d: got: %d, expected: %d", i, item.SupplyQuantity, expected[i].quantity)
+		}
+	}
+
+	drafts := plan.SupplyDraftParams("CREATE_TYPE_DIRECT")
+	if len(drafts) != 2 {
+		t.Fatalf("expected 2 drafts, got: %d", len(drafts))
+	}
+	if drafts[0].ClusterIds[0] != "1" || len(drafts[0].Items) != 2 || drafts[0].Type != "CREATE_TYPE_DIRECT" {
+		t.Errorf("wrong draft for the first cluster: %+v", drafts[0])
+	}
+	if drafts[1].ClusterIds[0] != "2" || len(drafts[1].Items) != 1 || drafts[1].Items[0].SKU != 200 {
+		t.Errorf("wrong draft for the second cluster: %+v", drafts[1])
+	}
+}
+
+func TestGetReplenishmentInput(t *testing.T) {
+	t.Parallel()
+
+	c := NewMockClient(newMockRouter(map[string]string{
+		"/v1/cluster/list": `{
+			"clusters": [
+				{
+					"id": 1,
+					"logistic_clusters": [
+						{
+							"warehouses": [
+								{"name": "warehouse", "type": "FULL_FILLMENT", "warehouse_id": 10}
+							]
+						}
+					],
+					"name": "cluster",
+					"type": "CLUSTER_TYPE_OZON"
+				}
+			]
+		}`,
+		"/v1/analytics/manage/stocks": `{
+			"items": [
+				{"sku": 100, "valid_stock_count": 7, "warehouse_name": "warehouse"},
+				{"sku": 100, "valid_stock_count": 5, "warehouse_name": "unknown"}
+			]
+		}`,
+		"/v2/analytics/stock_on_warehouses": `{
+			"result": {
+				"rows": [
+					{"sku": 100, "promised_amount": 3, "warehouse_name": "warehouse"},
+					{"sku": 300, "promised_amount": 3, "warehouse_name": "warehouse"}
+				]
+			}
+		}`,
+		"/v1/analytics/turnover/stocks": `{
+			"items": [
+				{"ads": 1.5, "sku": 100}
+			]
+		}`,
+		"/v1/analytics/data": `{
+			"result": {
+				"data": [
+					{"dimensions": [{"id": "100"}, {"id": "2023-01-09"}], "metrics": [2]},
+					{"dimensions": [{"id": "100"}, {"id": "2023-01-10"}], "metrics": [4]},
+					{"dimensions": [{"id": "300"}, {"id": "2023-01-10"}], "metrics": [4]}
+				]
+			}
+		}`,
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	input, err := GetReplenishmentInput(ctx, c, &GetReplenishmentInputParams{
+		SKUs:        []int64{100},
+		ClusterType: "CLUSTER_TYPE_OZON",
+		HistoryDays: 5,
+		Date:        time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(input.Clusters) != 1 {
+		t.Errorf("expected 1 cluster, got: %d", len(input.Clusters))
+	}
+	if len(input.Stocks) != 2 {
+		t.Fatalf("expected 2 stocks, got: %d", len(input.Stocks))
+	}
+	if input.Stocks[0].Available != 7 || input.Stocks[1].InTransit != 3 {
+		t.Errorf("wrong stocks: %+v", input.Stocks)
+	}
+	if input.AverageDailySales[100] != 1.5 {
+		t.Errorf("wrong average daily sales: %v", input.AverageDailySales)
+	}
+	history, ok := input.Sales[100]
+	if !ok || len(history) != 5 {
+		t.Fatalf("expected 5 days of history, got: %v", input.Sales)
+	}
+	if history[3] != 2 || history[4] != 4 || history[0] != 0 {
+		t.Errorf("wrong sales history: %v", history)
+	}
+	if _, ok := input.Sales[300]; ok {
+		t.Errorf("sales of not requested SKU must be skipped")
+	}
+}
+
+func TestGetReplenishmentInputPages(t *testing.T) {
+	t.Parallel()
+
+	mu := sync.Mutex{}
+	stockOffsets := []int64{}
+	turnoverOffsets := []int64{}
+	seriesFilters := []string{}
+
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body := struct {
+			Limit   int64                    `json:"limit"`
+			Offset  int64                    `json:"offset"`
+			Filters []GetAnalyticsDataFilter `json:"filters"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		// Full page is returned for the first request of stocks and turnover
+		page := func(offsets *[]int64, item string) string {
+			*offsets = append(*offsets, body.Offset)
+			if body.Offset > 0 {
+				return ""
+			}
+			items := make([]string, body.Limit)
+			for i := range items {
+				items[i] = item
+			}
+			return strings.Join(items, ",")
+		}
+
+		w.WriteHeader(http.StatusOK)
+		switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+		case "/v1/cluster/list":
+			w.Write([]byte(`{"clusters": [{"id": 1, "logistic_clusters": [{"warehouses": [{"name": "warehouse"}]}]}]}`))
+		case "/v1/analytics/manage/stocks":
+			w.Write([]byte(`{"items": [` + page(&stockOffsets, `{"sku": 100, "valid_stock_count": 1, "warehouse_name": "warehouse"}`) + `]}`))
+		case "/v2/analytics/stock_on_warehouses":
+			w.Write([]byte(`{"result": {"rows": []}}`))
+		case "/v1/analytics/turnover/stocks":
+			w.Write([]byte(`{"items": [` + page(&turnoverOffsets, `{"ads": 1, "sku": 100}`) + `]}`))
+		case "/v1/analytics/data":
+			for _, filter := range body.Filters {
+				seriesFilters = append(seriesFilters, fmt.Sprintf("%s %s %s", filter.Key, filter.Operation, filter.Value))
+			}
+			w.Write([]byte(`{"result": {"data": []}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	input, err := GetReplenishmentInput(ctx, c, &GetReplenishmentInputParams{
+		SKUs:        []int64{100, 200},
+		HistoryDays: 5,
+		Date:        time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stockOffsets) != 2 || stockOffsets[1] != replenishmentPageSize {
+		t.Errorf("stocks must be paged: %v", stockOffsets)
+	}
+	if len(input.Stocks) != replenishmentPageSize {
+		t.Errorf("expected %d stocks, got: %d", replenishmentPageSize, len(input.Stocks))
+	}
+	if len(turnoverOffsets) != 2 || turnoverOffsets[1] != replenishmentPageSize {
+		t.Errorf("turnover must be paged: %v", turnoverOffsets)
+	}
+	if len(seriesFilters) != 2 || seriesFilters[0] != "sku EQ 100" || seriesFilters[1] != "sku EQ 200" {
+		t.Errorf("sales must be filtered by SKU: %v", seriesFilters)
+	}
+
+	// Empty list means all products, so no filter is sent
+	seriesFilters = nil
+	input, err = GetReplenishmentInput(ctx, c, &GetReplenishmentInputParams{
+		HistoryDays: 5,
+		Date:        time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seriesFilters) != 0 {
+		t.Errorf("sales of all products must not be filtered: %v", seriesFilters)
+	}
+	if input.AverageDailySales[100] != 1 {
+		t.Errorf("turnover of all products must be collected: %v", input.AverageDailySales)
+	}
+}
@@ -0,0 +1,348 @@
+package ozon
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Product priced by a strategy
+type RepricingProduct struct {
+	// Product identifier
+	ProductId int64 `json:"product_id"`
+
+	// Seller product identifier
+	OfferId string `json:"offer_id"`
+
+	// Current product price. The strategy doesn't set a higher price
+	Price float64 `json:"price"`
+
+	// Minimum product price. The strategy doesn't set a lower price
+	MinPrice float64 `json:"min_price"`
+}
+
+// Converts product price information to products for simulation
+func RepricingProductsFromPriceInfo(items []GetProductPriceInfoResultItem) []RepricingProduct {
+	products := make([]RepricingProduct, 0, len(items))
+	for _, item := range items {
+		products = append(products, RepricingProduct{
+			ProductId: item.ProductId,
+			OfferId:   item.OfferId,
+			Price:     item.Price.Price,
+			MinPrice:  item.Price.MinPrice,
+		})
+	}
+	return products
+}
+
+// Price of a product at a competitor
+type CompetitorPrice struct {
+	// Product identifier
+	ProductId int64 `json:"product_id"`
+
+	// Competitor identifier
+	CompetitorId int64 `json:"competitor_id"`
+
+	// Competitor's product price
+	Price float64 `json:"price"`
+
+	// Link to a competitor's product
+	URL string `json:"url,omitempty"`
+}
+
+// Source of competitor prices for simulation
+type CompetitorPriceSource interface {
+	CompetitorPrices(ctx context.Context, productIds []int64) ([]CompetitorPrice, error)
+}
+
+// Recorded competitor prices
+type RecordedCompetitorPrices []CompetitorPrice
+
+func (p RecordedCompetitorPrices) CompetitorPrices(ctx context.Context, productIds []int64) ([]CompetitorPrice, error) {
+	ids := map[int64]bool{}
+	for _, id := range productIds {
+		ids[id] = true
+	}
+
+	prices := []CompetitorPrice{}
+	for _, price := range p {
+		if ids[price.ProductId] {
+			prices = append(prices, price)
+		}
+	}
+	return prices, nil
+}
+
+// Reads competitor prices from CSV with a header.
+// Columns are product_id, competitor_id, price and optional url
+func ReadCompetitorPricesCSV(r io.Reader) (RecordedCompetitorPrices, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	prices := RecordedCompetitorPrices{}
+	for i, record := range records {
+		if i == 0 {
+			continue
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected at least 3 columns, got %d", i+1, len(record))
+		}
+
+		price := CompetitorPrice{}
+		if price.ProductId, err = strconv.ParseInt(record[0], 10, 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid product id: %w", i+1, err)
+		}
+		if price.CompetitorId, err = strconv.ParseInt(record[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid competitor id: %w", i+1, err)
+		}
+		if price.Price, err = strconv.ParseFloat(record[2], 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid price: %w", i+1, err)
+		}
+		if len(record) > 3 {
+			price.URL = record[3]
+		}
+		prices = append(prices, price)
+	}
+	return prices, nil
+}
+
+// Gets competitor prices with `GetCompetitorPrice`.
+// Prices are available only for products already added to a strategy
+type LiveCompetitorPrices struct {
+	Strategies *Strategies
+}
+
+func (p LiveCompetitorPrices) CompetitorPrices(ctx context.Context, productIds []int64) ([]CompetitorPrice, error) {
+	prices := []CompetitorPrice{}
+	for _, productId := range productIds {
+		resp, err := p.Strategies.GetCompetitorPrice(ctx, &GetCompetitorPriceParams{ProductId: productId})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("get competitor price of %d: %d %s", productId, resp.StatusCode, resp.Message)
+		}
+		if resp.Result.StrategyCompetitorId == 0 {
+			continue
+		}
+
+		prices = append(prices, CompetitorPrice{
+			ProductId:    productId,
+			CompetitorId: resp.Result.StrategyCompetitorId,
+			Price:        float64(resp.Result.StrategyProductPrice),
+			URL:          resp.Result.StrategyCompetitorProductURL,
+		})
+	}
+	return prices, nil
+}
+
+// Simulated price of a product
+type RepricingResult struct {
+	// Product identifier
+	ProductId int64 `json:"product_id"`
+
+	// Seller product identifier
+	OfferId string `json:"offer_id"`
+
+	// Current product price
+	CurrentPrice float64 `json:"current_price"`
+
+	// Price set by the strategy
+	NewPrice float64 `json:"new_price"`
+
+	// Difference between new and current prices
+	Change float64 `json:"change"`
+
+	// Change in percent of the current price
+	ChangePercent float64 `json:"change_percent"`
+
+	// Competitor which price defines the new price.
+	// Zero if there are no prices of the strategy competitors
+	CompetitorId int64 `json:"competitor_id,omitempty"`
+
+	// Competitor's product price
+	CompetitorPrice float64 `json:"competitor_price,omitempty"`
+
+	// true, if the price is limited by the minimum price
+	HitFloor bool `json:"hit_floor"`
+}
+
+// Result of a strategy simulation
+type RepricingReport struct {
+	// Simulated prices by products in the order of products
+	Results []RepricingResult `json:"results"`
+
+	// Number of products which prices would change
+	Changed int `json:"changed"`
+
+	// Number of products without prices of the strategy competitors
+	WithoutCompetitorPrice int `json:"without_competitor_price"`
+
+	// Number of products limited by the minimum price
+	HitFloor int `json:"hit_floor"`
+
+	// Sum of changes of all products
+	TotalChange float64 `json:"total_change"`
+
+	// Average change in percent of changed products
+	AverageChangePercent float64 `json:"average_change_percent"`
+
+	// The largest price decrease in percent
+	MaxDecreasePercent float64 `json:"max_decrease_percent"`
+}
+
+// Returns changed products sorted by decrease in percent, the largest first
+func (r *RepricingReport) ChangedResults() []RepricingResult {
+	results := []RepricingResult{}
+	for _, result := range r.Results {
+		if result.Change != 0 {
+			results = append(results, result)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].ChangePercent < results[j].ChangePercent
+	})
+	return results
+}
+
+// Writes simulated prices as CSV with a header
+func (r *RepricingReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{
+		"product_id", "offer_id", "current_price", "new_price", "change", "change_percent",
+		"competitor_id", "competitor_price", "hit_floor",
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, result := range r.Results {
+		record := []string{
+			strconv.FormatInt(result.ProductId, 10),
+			result.OfferId,
+			strconv.FormatFloat(result.CurrentPrice, 'f', 2, 64),
+			strconv.FormatFloat(result.NewPrice, 'f', 2, 64),
+			strconv.FormatFloat(result.Change, 'f', 2, 64),
+			strconv.FormatFloat(result.ChangePercent, 'f', 2, 64),
+			strconv.FormatInt(result.CompetitorId, 10),
+			strconv.FormatFloat(result.CompetitorPrice, 'f', 2, 64),
+			strconv.FormatBool(result.HitFloor),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Simulates the strategy on products with competitor prices from the source.
+// If the source is nil, prices are got with `GetCompetitorPrice`
+func (c Strategies) Simulate(ctx context.Context, strategy *CreateStrategyParams, products []RepricingProduct, source CompetitorPriceSource) (*RepricingReport, error) {
+	if source == nil {
+		source = LiveCompetitorPrices{Strategies: &c}
+	}
+
+	productIds := make([]int64, 0, len(products))
+	for _, product := range products {
+		productIds = append(productIds, product.ProductId)
+	}
+
+	prices, err := source.CompetitorPrices(ctx, productIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return SimulateStrategy(strategy, products, prices), nil
+}
+
+// Computes prices the strategy would set without calling the API.
+//
+// Price of each strategy competitor is multiplied by its coefficient
+// and the lowest result becomes the new price. The new price is limited
+// by the current price from above and by the minimum price from below.
+// Prices of competitors not in the strategy are ignored
+func SimulateStrategy(strategy *CreateStrategyParams, products []RepricingProduct, prices []CompetitorPrice) *RepricingReport {
+	coefficients := map[int64]float64{}
+	for _, competitor := range strategy.Competitors {
+		coefficients[competitor.CompetitorId] = float64(competitor.Coefficient)
+	}
+
+	pricesByProduct := map[int64][]CompetitorPrice{}
+	for _, price := range prices {
+		pricesByProduct[price.ProductId] = append(pricesByProduct[price.ProductId], price)
+	}
+
+	report := &RepricingReport{Results: make([]RepricingResult, 0, len(products))}
+	var sumChangePercent float64
+	for _, product := range products {
+		result := RepricingResult{
+			ProductId:    product.ProductId,
+			OfferId:      product.OfferId,
+			CurrentPrice: product.Price,
+			NewPrice:     product.Price,
+		}
+
+		target := math.Inf(1)
+		for _, price := range pricesByProduct[product.ProductId] {
+			coefficient, ok := coefficients[price.CompetitorId]
+			if !ok || price.Price <= 0 {
+				continue
+			}
+			if candidate := price.Price * coefficient; candidate < target {
+				target = candidate
+				result.CompetitorId = price.CompetitorId
+				result.CompetitorPrice = price.Price
+			}
+		}
+
+		if math.IsInf(target, 1) {
+			report.WithoutCompetitorPrice++
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		target = math.Round(target*100) / 100
+		switch {
+		case target < product.MinPrice:
+			result.NewPrice = product.MinPrice
+			result.HitFloor = true
+			report.HitFloor++
+		case target < product.Price:
+			result.NewPrice = target
+		}
+
+		result.Change = math.Round((result.NewPrice-product.Price)*100) / 100
+		if product.Price != 0 {
+			result.ChangePercent = result.Change / product.Price * 100
+		}
+		if result.Change != 0 {
+			report.Changed++
+			report.TotalChange += result.Change
+			sumChangePercent += result.ChangePercent
+			if -result.ChangePercent > report.MaxDecreasePercent {
+				report.MaxDecreasePercent = -result.ChangePercent
+			}
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	if report.Changed > 0 {
+		report.AverageChangePercent = sumChangePercent / float64(report.Changed)
+	}
+	report.TotalChange = math.Round(report.TotalChange*100) / 100
+
+	return report
+}
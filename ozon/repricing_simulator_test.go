@@ -0,0 +1,130 @@
+package ozon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSimulateStrategy(t *testing.T) {
+	t.Parallel()
+
+	strategy := &CreateStrategyParams{
+		StrategyName: "test",
+		Competitors: []CreateStrategyCompetitor{
+			{CompetitorId: 1, Coefficient: 0.9},
+			{CompetitorId: 2, Coefficient: 1.1},
+		},
+	}
+	products := []RepricingProduct{
+		{ProductId: 10, OfferId: "a", Price: 1000, MinPrice: 500},
+		{ProductId: 20, OfferId: "b", Price: 1000, MinPrice: 950},
+		{ProductId: 30, OfferId: "c", Price: 1000, MinPrice: 500},
+		{ProductId: 40, OfferId: "d", Price: 1000, MinPrice: 500},
+	}
+	prices, err := ReadCompetitorPricesCSV(strings.NewReader(
+		"product_id,competitor_id,price,url\n" +
+			"10,1,1000,https://example.com/a\n" +
+			"10,2,700\n" +
+			"20,1,800\n" +
+			// Higher than the current price
+			"30,2,1200\n" +
+			// Competitor isn't in the strategy
+			"40,3,100\n",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	report, err := c.Strategies().Simulate(ctx, strategy, products, prices)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []RepricingResult{
+		{ProductId: 10, OfferId: "a", CurrentPrice: 1000, NewPrice: 770, Change: -230, ChangePercent: -23, CompetitorId: 2, CompetitorPrice: 700},
+		{ProductId: 20, OfferId: "b", CurrentPrice: 1000, NewPrice: 950, Change: -50, ChangePercent: -5, CompetitorId: 1, CompetitorPrice: 800, HitFloor: true},
+		{ProductId: 30, OfferId: "c", CurrentPrice: 1000, NewPrice: 1000, CompetitorId: 2, CompetitorPrice: 1200},
+		{ProductId: 40, OfferId: "d", CurrentPrice: 1000, NewPrice: 1000},
+	}
+	if len(report.Results) != len(expected) {
+		t.Fatalf("wrong results: %+v", report.Results)
+	}
+	for i := range expected {
+		got := report.Results[i]
+		if !almostEqual(got.NewPrice, expected[i].NewPrice) || !almostEqual(got.ChangePercent, expected[i].ChangePercent) {
+			t.Errorf("wrong result: got: %+v, expected: %+v", got, expected[i])
+			continue
+		}
+		got.ChangePercent = expected[i].ChangePercent
+		if got != expected[i] {
+			t.Errorf("wrong result: got: %+v, expected: %+v", got, expected[i])
+		}
+	}
+
+	if report.Changed != 2 || report.HitFloor != 1 || report.WithoutCompetitorPrice != 1 || report.TotalChange != -280 ||
+		!almostEqual(report.AverageChangePercent, -14) || !almostEqual(report.MaxDecreasePercent, 23) {
+		t.Errorf("wrong report: %+v", report)
+	}
+
+	changed := report.ChangedResults()
+	if len(changed) != 2 || changed[0].ProductId != 10 || changed[1].ProductId != 20 {
+		t.Errorf("wrong changed results: %+v", changed)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := report.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || lines[2] != "20,b,1000.00,950.00,-50.00,-5.00,1,800.00,true" {
+		t.Errorf("wrong CSV: %s", buf.String())
+	}
+
+	if _, err := ReadCompetitorPricesCSV(strings.NewReader("product_id,competitor_id,price\n1,x,100\n")); err == nil {
+		t.Errorf("expected error for invalid competitor id")
+	}
+}
+
+func TestSimulateStrategyLivePrices(t *testing.T) {
+	t.Parallel()
+
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		params := GetCompetitorPriceParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+
+		w.WriteHeader(http.StatusOK)
+		if params.ProductId == 10 {
+			w.Write([]byte(`{"result": {"strategy_competitor_id": 1, "strategy_product_price": 900}}`))
+			return
+		}
+		w.Write([]byte(`{"result": {}}`))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	strategy := &CreateStrategyParams{Competitors: []CreateStrategyCompetitor{{CompetitorId: 1, Coefficient: 1}}}
+	products := RepricingProductsFromPriceInfo([]GetProductPriceInfoResultItem{
+		{ProductId: 10, OfferId: "a", Price: GetProductPriceInfoResultItemPrice{Price: 1000, MinPrice: 800}},
+		{ProductId: 20, OfferId: "b", Price: GetProductPriceInfoResultItemPrice{Price: 1000, MinPrice: 800}},
+	})
+
+	report, err := c.Strategies().Simulate(ctx, strategy, products, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changed != 1 || report.WithoutCompetitorPrice != 1 || report.Results[0].NewPrice != 900 {
+		t.Errorf("wrong report: %+v", report)
+	}
+}
@@ -66,7 +66,7 @@ type GetRFBSReturnsResponse struct {
 	core.CommonResponse
 
 	// Information on return requests
-	Returns GetRFBSReturnsReturn `json:"returns"`
+	Returns []GetRFBSReturnsReturn `json:"returns"`
 }
 
 type GetRFBSReturnsReturn struct {
@@ -35,27 +35,29 @@ func TestGetRFBSReturns(t *testing.T) {
 				},
 			},
 			`{
-				"returns": {
-				  "client_name": "string",
-				  "created_at": "2019-08-24T14:15:22Z",
-				  "order_number": "string",
-				  "posting_number": "111",
-				  "product": {
-					"name": "string",
-					"offer_id": "123",
-					"currency_code": "string",
-					"price": "string",
-					"sku": 123
-				  },
-				  "return_id": 0,
-				  "return_number": "string",
-				  "state": {
-					"group_state": "All",
-					"money_return_state_name": "string",
-					"state": "string",
-					"state_name": "string"
+				"returns": [
+				  {
+				    "client_name": "string",
+				    "created_at": "2019-08-24T14:15:22Z",
+				    "order_number": "string",
+				    "posting_number": "111",
+				    "product": {
+					  "name": "string",
+					  "offer_id": "123",
+					  "currency_code": "string",
+					  "price": "string",
+					  "sku": 123
+				    },
+				    "return_id": 0,
+				    "return_number": "string",
+				    "state": {
+					  "group_state": "All",
+					  "money_return_state_name": "string",
+					  "state": "string",
+					  "state_name": "string"
+				    }
 				  }
-				}
+				]
 			}`,
 		},
 		// Test No Client-Id or Api-Key
@@ -87,14 +89,18 @@ func TestGetRFBSReturns(t *testing.T) {
 		}
 
 		if resp.StatusCode == http.StatusOK {
-			if resp.Returns.Product.OfferId != test.params.Filter.OfferId {
-				t.Errorf("expected offer ID %s, but got: %s", test.params.Filter.OfferId, resp.Returns.Product.OfferId)
+			if len(resp.Returns) != 1 {
+				t.Errorf("expected 1 return, but got: %d", len(resp.Returns))
+				continue
+			}
+			if resp.Returns[0].Product.OfferId != test.params.Filter.OfferId {
+				t.Errorf("expected offer ID %s, but got: %s", test.params.Filter.OfferId, resp.Returns[0].Product.OfferId)
 			}
-			if resp.Returns.PostingNumber != test.params.Filter.PostingNumber {
-				t.Errorf("expected posting number %s, but got: %s", test.params.Filter.PostingNumber, resp.Returns.PostingNumber)
+			if resp.Returns[0].PostingNumber != test.params.Filter.PostingNumber {
+				t.Errorf("expected posting number %s, but got: %s", test.params.Filter.PostingNumber, resp.Returns[0].PostingNumber)
 			}
-			if resp.Returns.State.GroupState != test.params.Filter.GroupState[0] {
-				t.Errorf("expected group state %s, but got: %s", test.params.Filter.GroupState[0], resp.Returns.State.GroupState)
+			if resp.Returns[0].State.GroupState != test.params.Filter.GroupState[0] {
+				t.Errorf("expected group state %s, but got: %s", test.params.Filter.GroupState[0], resp.Returns[0].State.GroupState)
 			}
 		}
 	}
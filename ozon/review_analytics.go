@@ -0,0 +1,605 @@
+package ozon
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Words skipped in keyword frequencies
+var russianStopWords = map[string]bool{}
+
+// Negation particles are joined to the next word, so "не работает" isn't counted as "работает"
+var russianNegations = map[string]bool{"не": true, "нет": true, "ни": true}
+
+func init() {
+	for _, word := range strings.Fields(`
+		а без более бы был была были было быть в вам вас весь во вот все всего всех вы где да даже
+		для до его ее ей ему если есть еще же за здесь и из или им их к как ко когда кто ли либо мне
+		может мы на над надо наш него нее них но ну о об однако он она они оно от очень по
+		под при с со так также такой там те тем то того тоже той только том ты у уже хотя чего чей
+		чем что чтобы чье чья эта эти это этот я мой моя мое мои свой своя свое свои который которая
+		которое которые будет вообще просто вроде раз два ещё всё её`) {
+		russianStopWords[word] = true
+	}
+}
+
+// Length of a period reviews are grouped by
+type ReviewPeriod string
+
+const (
+	ReviewPeriodDay   ReviewPeriod = "day"
+	ReviewPeriodWeek  ReviewPeriod = "week"
+	ReviewPeriodMonth ReviewPeriod = "month"
+)
+
+// Returns start of the period the time belongs to. Weeks start on Monday
+func (p ReviewPeriod) Start(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch p {
+	case ReviewPeriodDay:
+		return day
+	case ReviewPeriodWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+type GetReviewAnalyticsParams struct {
+	// Analyze reviews published not earlier than this date. Not limited if zero
+	Since time.Time
+
+	// Analyze reviews published not later than this date. Not limited if zero
+	Till time.Time
+
+	// Period reviews are grouped by. Default is month
+	Period ReviewPeriod
+
+	// Reviews with rating not greater than this one are negative. Default is 2
+	NegativeRating int32
+
+	// Maximum number of words in a phrase. Default is 2
+	NGrams int
+
+	// Number of the most frequent terms for each product and period. Default is 20
+	TopTerms int
+
+	// Load seller comments to find answered reviews and response time.
+	// Requires a request for each review with comments.
+	// If false, processed reviews are counted as answered
+	LoadComments bool
+}
+
+// Statistics of product reviews
+type ReviewSKUStats struct {
+	// Product identifier in the Ozon system, SKU
+	SKU int64
+
+	// Period start. Zero for statistics for all time
+	Period time.Time
+
+	// Number of reviews
+	Reviews int
+
+	// Number of reviews by rating from 1 to 5
+	Ratings [5]int
+
+	// Average rating
+	AverageRating float64
+
+	// Number of reviews answered by the seller
+	Answered int
+
+	// Number of reviews without answer
+	Unanswered int
+
+	// Answered to all reviews ratio
+	AnswerRatio float64
+
+	// Average time between review publication and the first seller comment.
+	// Calculated only if comments are loaded
+	AverageResponseTime time.Duration
+
+	// Median time between review publication and the first seller comment.
+	// Calculated only if comments are loaded
+	MedianResponseTime time.Duration
+
+	responseTimes []time.Duration
+	ratingsSum    int64
+}
+
+// Frequency of a word or a phrase in negative reviews
+type ReviewTerm struct {
+	// Product identifier in the Ozon system, SKU
+	SKU int64
+
+	// Period start
+	Period time.Time
+
+	// Stemmed words separated by space
+	Term string
+
+	// The most frequent form of the term in reviews
+	Example string
+
+	// Number of words in the term
+	Words int
+
+	// Number of occurrences
+	Count int
+}
+
+type ReviewAnalytics struct {
+	// Number of all reviews
+	Total int32
+
+	// Number of processed reviews
+	Processed int32
+
+	// Number of unprocessed reviews
+	Unprocessed int32
+
+	// Statistics for all time for each product
+	SKUs []ReviewSKUStats
+
+	// Statistics for each product and period
+	Periods []ReviewSKUStats
+
+	// The most frequent terms in negative reviews for each product and period
+	Terms []ReviewTerm
+}
+
+// Review with the time of the first seller answer
+type AnalyzedReview struct {
+	ReviewDetails
+
+	// Time of the first seller comment. Zero if the review isn't answered
+	AnsweredAt time.Time
+
+	// true, if the review is answered
+	Answered bool
+}
+
+// Loads all reviews and calculates rating distributions, answers and
+// the most frequent terms in negative reviews for each product
+func (c Reviews) GetAnalytics(ctx context.Context, params *GetReviewAnalyticsParams) (*ReviewAnalytics, error) {
+	count, err := c.Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if count.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("count reviews: %d %s", count.StatusCode, count.Message)
+	}
+
+	reviews := []AnalyzedReview{}
+	list := &ListReviewsParams{
+		Limit:   reviewsBatchSize,
+		SortDir: Ascending,
+		Status:  ReviewStatusAll,
+	}
+	for {
+		resp, err := c.List(ctx, list)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("list reviews: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		for _, review := range resp.Reviews {
+			if !params.Since.IsZero() && review.PublishedAt.Before(params.Since) {
+				continue
+			}
+			if !params.Till.IsZero() && review.PublishedAt.After(params.Till) {
+				continue
+			}
+
+			analyzed := AnalyzedReview{
+				ReviewDetails: review,
+				Answered:      review.Status == ReviewStatusProcessed,
+			}
+			if params.LoadComments {
+				analyzed.AnsweredAt, err = c.firstSellerComment(ctx, &review)
+				if err != nil {
+					return nil, err
+				}
+				analyzed.Answered = !analyzed.AnsweredAt.IsZero()
+			}
+			reviews = append(reviews, analyzed)
+		}
+
+		if !resp.HasNext || resp.LastId == "" {
+			break
+		}
+		list.LastId = resp.LastId
+	}
+
+	analytics := AnalyzeReviews(reviews, params)
+	analytics.Total = count.Total
+	analytics.Processed = count.Processed
+	analytics.Unprocessed = count.Unprocessed
+
+	return analytics, nil
+}
+
+func (c Reviews) firstSellerComment(ctx context.Context, review *ReviewDetails) (time.Time, error) {
+	if review.CommentsAmount == 0 {
+		return time.Time{}, nil
+	}
+
+	params := &ListCommentsParams{
+		Limit:    reviewsBatchSize,
+		ReviewId: review.Id,
+		SortDir:  Ascending,
+	}
+	for {
+		resp, err := c.ListComments(ctx, params)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return time.Time{}, fmt.Errorf("list comments of review %s: %d %s", review.Id, resp.StatusCode, resp.Message)
+		}
+
+		for _, comment := range resp.Comments {
+			if comment.IsOwner {
+				return comment.PublishedAt, nil
+			}
+		}
+
+		if len(resp.Comments) < int(params.Limit) {
+			return time.Time{}, nil
+		}
+		params.Offset += params.Limit
+	}
+}
+
+// Calculates analytics for already loaded reviews
+func AnalyzeReviews(reviews []AnalyzedReview, params *GetReviewAnalyticsParams) *ReviewAnalytics {
+	period := params.Period
+	if period == "" {
+		period = ReviewPeriodMonth
+	}
+	negativeRating := params.NegativeRating
+	if negativeRating == 0 {
+		negativeRating = 2
+	}
+	ngrams := params.NGrams
+	if ngrams == 0 {
+		ngrams = 2
+	}
+	topTerms := params.TopTerms
+	if topTerms == 0 {
+		topTerms = 20
+	}
+
+	type statsKey struct {
+		sku    int64
+		period time.Time
+	}
+	skus := map[int64]*ReviewSKUStats{}
+	periods := map[statsKey]*ReviewSKUStats{}
+	terms := map[statsKey]*reviewTermCounter{}
+
+	for _, review := range reviews {
+		key := statsKey{sku: review.SKU, period: period.Start(review.PublishedAt)}
+
+		if _, ok := skus[review.SKU]; !ok {
+			skus[review.SKU] = &ReviewSKUStats{SKU: review.SKU}
+		}
+		if _, ok := periods[key]; !ok {
+			periods[key] = &ReviewSKUStats{SKU: review.SKU, Period: key.period}
+		}
+		skus[review.SKU].add(&review)
+		periods[key].add(&review)
+
+		if review.Rating > 0 && review.Rating <= negativeRating {
+			if _, ok := terms[key]; !ok {
+				terms[key] = newReviewTermCounter()
+			}
+			terms[key].add(review.Text, ngrams)
+		}
+	}
+
+	analytics := &ReviewAnalytics{}
+	for _, stats := range skus {
+		stats.finish()
+		analytics.SKUs = append(analytics.SKUs, *stats)
+	}
+	for _, stats := range periods {
+		stats.finish()
+		analytics.Periods = append(analytics.Periods, *stats)
+	}
+	for key, counter := range terms {
+		for _, term := range counter.top(topTerms) {
+			term.SKU = key.sku
+			term.Period = key.period
+			analytics.Terms = append(analytics.Terms, term)
+		}
+	}
+
+	sort.Slice(analytics.SKUs, func(i, j int) bool {
+		return analytics.SKUs[i].SKU < analytics.SKUs[j].SKU
+	})
+	sort.Slice(analytics.Periods, func(i, j int) bool {
+		left, right := analytics.Periods[i], analytics.Periods[j]
+		if left.SKU != right.SKU {
+			return left.SKU < right.SKU
+		}
+		return left.Period.Before(right.Period)
+	})
+	sort.SliceStable(analytics.Terms, func(i, j int) bool {
+		left, right := analytics.Terms[i], analytics.Terms[j]
+		if left.SKU != right.SKU {
+			return left.SKU < right.SKU
+		}
+		if !left.Period.Equal(right.Period) {
+			return left.Period.Before(right.Period)
+		}
+		if left.Count != right.Count {
+			return left.Count > right.Count
+		}
+		return left.Term < right.Term
+	})
+
+	return analytics
+}
+
+func (s *ReviewSKUStats) add(review *AnalyzedReview) {
+	s.Reviews++
+	if review.Rating >= 1 && review.Rating <= 5 {
+		s.Ratings[review.Rating-1]++
+		s.ratingsSum += int64(review.Rating)
+	}
+
+	if !review.Answered {
+		s.Unanswered++
+		return
+	}
+	s.Answered++
+	if !review.AnsweredAt.IsZero() {
+		s.responseTimes = append(s.responseTimes, review.AnsweredAt.Sub(review.PublishedAt))
+	}
+}
+
+func (s *ReviewSKUStats) finish() {
+	rated := 0
+	for _, count := range s.Ratings {
+		rated += count
+	}
+	if rated > 0 {
+		s.AverageRating = float64(s.ratingsSum) / float64(rated)
+	}
+	if s.Reviews > 0 {
+		s.AnswerRatio = float64(s.Answered) / float64(s.Reviews)
+	}
+
+	if len(s.responseTimes) == 0 {
+		return
+	}
+	sort.Slice(s.responseTimes, func(i, j int) bool {
+		return s.responseTimes[i] < s.responseTimes[j]
+	})
+
+	var sum time.Duration
+	for _, responseTime := range s.responseTimes {
+		sum += responseTime
+	}
+	s.AverageResponseTime = sum / time.Duration(len(s.responseTimes))
+
+	middle := len(s.responseTimes) / 2
+	s.MedianResponseTime = s.responseTimes[middle]
+	if len(s.responseTimes)%2 == 0 {
+		s.MedianResponseTime = (s.responseTimes[middle-1] + s.responseTimes[middle]) / 2
+	}
+}
+
+type reviewTermCounter struct {
+	counts map[string]int
+	words  map[string]int
+
+	// Number of occurrences of each form of a term
+	forms map[string]map[string]int
+}
+
+func newReviewTermCounter() *reviewTermCounter {
+	return &reviewTermCounter{
+		counts: map[string]int{},
+		words:  map[string]int{},
+		forms:  map[string]map[string]int{},
+	}
+}
+
+// Counts terms of up to ngrams words in the text. Stop words
+// are skipped and split phrases, so they don't form n-grams
+func (c *reviewTermCounter) add(text string, ngrams int) {
+	for _, phrase := range splitReviewPhrases(text) {
+		stems := make([]string, len(phrase))
+		for i, word := range phrase {
+			if negation, negated, ok := strings.Cut(word, " "); ok {
+				stems[i] = negation + " " + stemRussian(negated)
+			} else {
+				stems[i] = stemRussian(word)
+			}
+		}
+
+		for n := 1; n <= ngrams; n++ {
+			for i := 0; i+n <= len(phrase); i++ {
+				term := strings.Join(stems[i:i+n], " ")
+				form := strings.Join(phrase[i:i+n], " ")
+
+				c.counts[term]++
+				c.words[term] = n
+				if c.forms[term] == nil {
+					c.forms[term] = map[string]int{}
+				}
+				c.forms[term][form]++
+			}
+		}
+	}
+}
+
+func (c *reviewTermCounter) top(limit int) []ReviewTerm {
+	terms := make([]ReviewTerm, 0, len(c.counts))
+	for term, count := range c.counts {
+		example, exampleCount := "", 0
+		for form, formCount := range c.forms[term] {
+			if formCount > exampleCount || (formCount == exampleCount && form < example) {
+				example, exampleCount = form, formCount
+			}
+		}
+
+		terms = append(terms, ReviewTerm{
+			Term:    term,
+			Example: example,
+			Words:   c.words[term],
+			Count:   count,
+		})
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > limit {
+		terms = terms[:limit]
+	}
+	return terms
+}
+
+// Splits text into phrases of lowercased words. Phrases are
+// separated by punctuation and stop words. Negations are joined
+// to the next word, e.g. "не работает" is a single word
+func splitReviewPhrases(text string) [][]string {
+	phrases := [][]string{}
+	phrase := []string{}
+	word := []rune{}
+	negation := ""
+
+	flushPhrase := func() {
+		negation = ""
+		if len(phrase) > 0 {
+			phrases = append(phrases, phrase)
+			phrase = []string{}
+		}
+	}
+	flushWord := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := strings.ToLower(string(word))
+		word = word[:0]
+		if russianNegations[w] {
+			negation = w
+			return
+		}
+		if russianStopWords[w] || len([]rune(w)) < 3 {
+			flushPhrase()
+			return
+		}
+		if negation != "" {
+			w = negation + " " + w
+			negation = ""
+		}
+		phrase = append(phrase, w)
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+		case unicode.IsSpace(r) || r == '-':
+			flushWord()
+		default:
+			flushWord()
+			flushPhrase()
+		}
+	}
+	flushWord()
+	flushPhrase()
+
+	return phrases
+}
+
+// Writes product statistics as CSV with a header.
+// Statistics for all time are written with an empty period
+func (a *ReviewAnalytics) WriteStatsCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{
+		"sku", "period", "reviews", "rating_1", "rating_2", "rating_3", "rating_4", "rating_5",
+		"average_rating", "answered", "unanswered", "answer_ratio", "average_response_hours", "median_response_hours",
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	write := func(stats []ReviewSKUStats) error {
+		for _, s := range stats {
+			period := ""
+			if !s.Period.IsZero() {
+				period = s.Period.Format("2006-01-02")
+			}
+
+			record := []string{strconv.FormatInt(s.SKU, 10), period, strconv.Itoa(s.Reviews)}
+			for _, count := range s.Ratings {
+				record = append(record, strconv.Itoa(count))
+			}
+			record = append(record,
+				strconv.FormatFloat(s.AverageRating, 'f', 2, 64),
+				strconv.Itoa(s.Answered),
+				strconv.Itoa(s.Unanswered),
+				strconv.FormatFloat(s.AnswerRatio, 'f', 2, 64),
+				strconv.FormatFloat(s.AverageResponseTime.Hours(), 'f', 1, 64),
+				strconv.FormatFloat(s.MedianResponseTime.Hours(), 'f', 1, 64),
+			)
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write(a.SKUs); err != nil {
+		return err
+	}
+	if err := write(a.Periods); err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Writes the most frequent terms in negative reviews as CSV with a header
+func (a *ReviewAnalytics) WriteTermsCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"sku", "period", "term", "example", "words", "count"}); err != nil {
+		return err
+	}
+	for _, term := range a.Terms {
+		record := []string{
+			strconv.FormatInt(term.SKU, 10),
+			term.Period.Format("2006-01-02"),
+			term.Term,
+			term.Example,
+			strconv.Itoa(term.Words),
+			strconv.Itoa(term.Count),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
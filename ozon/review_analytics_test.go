@@ -0,0 +1,181 @@
+package ozon
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetReviewAnalytics(t *testing.T) {
+	t.Parallel()
+
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		var response string
+		switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+		case "/v1/review/count":
+			response = `{"processed": 3, "total": 5, "unprocessed": 2}`
+		case "/v1/review/list":
+			params := ListReviewsParams{}
+			json.NewDecoder(r.Body).Decode(&params)
+
+			response = `{
+				"has_next": true,
+				"last_id": "3",
+				"reviews": [
+					{"id": "1", "rating": 5, "sku": 100, "published_at": "2023-01-05T10:00:00Z", "comments_amount": 2, "status": "PROCESSED", "text": "Отличный чайник"},
+					{"id": "2", "rating": 1, "sku": 100, "published_at": "2023-01-10T10:00:00Z", "comments_amount": 1, "status": "PROCESSED", "text": "Чайник пришел сломанный. Сломанная ручка!"},
+					{"id": "3", "rating": 2, "sku": 100, "published_at": "2023-02-01T10:00:00Z", "status": "UNPROCESSED", "text": "Сломанная ручка, брак"}
+				]
+			}`
+			if params.LastId == "3" {
+				response = `{
+					"has_next": false,
+					"reviews": [
+						{"id": "4", "rating": 4, "sku": 200, "published_at": "2023-01-20T10:00:00Z", "status": "UNPROCESSED", "text": "Хорошо"},
+						{"id": "5", "rating": 1, "sku": 200, "published_at": "2022-12-20T10:00:00Z", "status": "PROCESSED", "text": "Старый отзыв"}
+					]
+				}`
+			}
+		case "/v1/review/comment/list":
+			params := ListCommentsParams{}
+			json.NewDecoder(r.Body).Decode(&params)
+
+			switch params.ReviewId {
+			case "1":
+				response = `{"comments": [
+					{"is_owner": false, "published_at": "2023-01-05T11:00:00Z"},
+					{"is_owner": true, "published_at": "2023-01-05T12:00:00Z"}
+				]}`
+			case "2":
+				response = `{"comments": [{"is_owner": true, "published_at": "2023-01-10T14:00:00Z"}]}`
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(response))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	analytics, err := c.Reviews().GetAnalytics(ctx, &GetReviewAnalyticsParams{
+		Since:        time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		LoadComments: true,
+		TopTerms:     3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if analytics.Total != 5 || analytics.Unprocessed != 2 {
+		t.Errorf("wrong counts: %+v", analytics)
+	}
+
+	if len(analytics.SKUs) != 2 {
+		t.Fatalf("expected 2 products, got: %+v", analytics.SKUs)
+	}
+	stats := analytics.SKUs[0]
+	if stats.SKU != 100 || stats.Reviews != 3 || stats.Ratings != [5]int{1, 1, 0, 0, 1} {
+		t.Errorf("wrong product stats: %+v", stats)
+	}
+	if !almostEqual(stats.AverageRating, 8.0/3) || stats.Answered != 2 || stats.Unanswered != 1 || !almostEqual(stats.AnswerRatio, 2.0/3) {
+		t.Errorf("wrong product stats: %+v", stats)
+	}
+	if stats.AverageResponseTime != 3*time.Hour || stats.MedianResponseTime != 3*time.Hour {
+		t.Errorf("wrong response time: %s %s", stats.AverageResponseTime, stats.MedianResponseTime)
+	}
+
+	if len(analytics.Periods) != 3 {
+		t.Fatalf("expected 3 periods, got: %+v", analytics.Periods)
+	}
+	if period := analytics.Periods[1]; period.SKU != 100 || !period.Period.Equal(time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)) || period.Reviews != 1 {
+		t.Errorf("wrong period stats: %+v", period)
+	}
+
+	terms := map[string]ReviewTerm{}
+	for _, term := range analytics.Terms {
+		if term.SKU == 100 && term.Period.Month() == time.January {
+			terms[term.Term] = term
+		}
+	}
+	if len(terms) != 3 {
+		t.Errorf("expected top 3 terms, got: %+v", terms)
+	}
+	if term := terms["слома"]; term.Count != 2 || term.Words != 1 {
+		t.Errorf("wrong term: %+v", term)
+	}
+	if term := terms["пришел слома"]; term.Count != 1 || term.Words != 2 || term.Example != "пришел сломанный" {
+		t.Errorf("wrong bigram: %+v", term)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := analytics.WriteStatsCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 || strings.Join(records[1], ",") != "100,,3,1,1,0,0,1,2.67,2,1,0.67,3.0,3.0" {
+		t.Errorf("wrong stats CSV: %v", records)
+	}
+
+	buf.Reset()
+	if err := analytics.WriteTermsCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err = csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(analytics.Terms)+1 || strings.Join(records[1], ",") != "100,2023-01-01,слома,сломанная,1,2" {
+		t.Errorf("wrong terms CSV: %v", records)
+	}
+}
+
+func TestReviewTermsNegation(t *testing.T) {
+	t.Parallel()
+
+	counter := newReviewTermCounter()
+	counter.add("Чайник не работает. Не пришел чек, нет инструкции", 2)
+
+	examples := map[string]bool{}
+	for _, term := range counter.top(100) {
+		examples[term.Example] = true
+	}
+	for _, example := range []string{"не работает", "чайник не работает", "не пришел", "нет инструкции"} {
+		if !examples[example] {
+			t.Errorf("term %q is not found in %v", example, examples)
+		}
+	}
+	for _, example := range []string{"работает", "пришел", "инструкции"} {
+		if examples[example] {
+			t.Errorf("negation must not be dropped from %q", example)
+		}
+	}
+}
+
+func TestReviewPeriodStart(t *testing.T) {
+	t.Parallel()
+
+	date := time.Date(2023, 3, 16, 15, 30, 0, 0, time.UTC)
+	tests := map[ReviewPeriod]time.Time{
+		ReviewPeriodDay:   time.Date(2023, 3, 16, 0, 0, 0, 0, time.UTC),
+		ReviewPeriodWeek:  time.Date(2023, 3, 13, 0, 0, 0, 0, time.UTC),
+		ReviewPeriodMonth: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	for period, expected := range tests {
+		if got := period.Start(date); !got.Equal(expected) {
+			t.Errorf("wrong %s start: got: %s, expected: %s", period, got, expected)
+		}
+	}
+}
@@ -0,0 +1,588 @@
+package ozon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+const (
+	// Review is not processed by the seller
+	ReviewStatusUnprocessed = "UNPROCESSED"
+
+	// Review is processed by the seller
+	ReviewStatusProcessed = "PROCESSED"
+
+	// Reviews with any status
+	ReviewStatusAll = "ALL"
+)
+
+// Maximum number of reviews in list requests
+const reviewsBatchSize = 100
+
+// Maximum number of comments in list requests
+const reviewCommentsBatchSize = 100
+
+// Reply language used when none is set
+const defaultReviewLanguage = "ru"
+
+// Conditions a review must satisfy to be answered with the rule templates
+type ReviewRule struct {
+	// Rule name
+	Name string
+
+	// Minimal review rating. Not limited if 0
+	MinRating int32
+
+	// Maximal review rating. Not limited if 0
+	MaxRating int32
+
+	// Match only reviews of these products. Any product if empty
+	SKUs []int64
+
+	// Review text must contain at least one of the keywords. Case insensitive
+	Keywords []string
+
+	// Review text must not contain any of the keywords. Case insensitive
+	ExcludeKeywords []string
+
+	// If set, review must have or must not have photos
+	HasPhotos *bool
+
+	// Reply templates in text/template format by language.
+	// Templates are executed with ReviewReplyData
+	Templates map[string]string
+
+	// Replies by this rule are added to the approval queue
+	// even if the replier isn't in the approval mode
+	RequireApproval bool
+}
+
+// Checks if the review satisfies the rule conditions
+func (r ReviewRule) Matches(review *ReviewDetails) bool {
+	if r.MinRating > 0 && review.Rating < r.MinRating {
+		return false
+	}
+	if r.MaxRating > 0 && review.Rating > r.MaxRating {
+		return false
+	}
+	if r.HasPhotos != nil && (review.PhotosAmount > 0) != *r.HasPhotos {
+		return false
+	}
+
+	if len(r.SKUs) > 0 {
+		found := false
+		for _, sku := range r.SKUs {
+			if sku == review.SKU {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	text := strings.ToLower(review.Text)
+	for _, keyword := range r.ExcludeKeywords {
+		if strings.Contains(text, strings.ToLower(keyword)) {
+			return false
+		}
+	}
+	if len(r.Keywords) == 0 {
+		return true
+	}
+	for _, keyword := range r.Keywords {
+		if strings.Contains(text, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Customer who left a review
+type ReviewCustomer struct {
+	// Customer name
+	Name string
+}
+
+// Data reply templates are executed with
+type ReviewReplyData struct {
+	// Review details
+	Review ReviewDetails
+
+	// Reviewed product. Filled if products are set with WithReviewProducts
+	Product ProductDetails
+
+	// Review author. Filled if customer resolver is set with WithReviewCustomerResolver
+	Customer ReviewCustomer
+}
+
+// Status of a reply
+type ReviewReplyStatus string
+
+const (
+	// Reply is posted
+	ReviewReplyPosted ReviewReplyStatus = "posted"
+
+	// Reply isn't posted because of dry-run mode
+	ReviewReplyDryRun ReviewReplyStatus = "dry_run"
+
+	// Reply is waiting for approval
+	ReviewReplyPending ReviewReplyStatus = "pending"
+)
+
+// Reply to a review
+type ReviewReply struct {
+	// Review identifier
+	ReviewId string
+
+	// Reviewed product SKU
+	SKU int64
+
+	// Review rating
+	Rating int32
+
+	// Name of the rule the review is matched by
+	Rule string
+
+	// Reply text
+	Text string
+
+	// Reply status
+	Status ReviewReplyStatus
+
+	// Identifier of the posted comment
+	CommentId string
+}
+
+// Replies waiting for approval
+type ReviewApprovalQueue interface {
+	// Adds a reply to the queue
+	Add(reply ReviewReply) error
+
+	// Returns a reply by review identifier
+	Get(reviewId string) (*ReviewReply, error)
+
+	// Returns all replies in the queue
+	Pending() ([]ReviewReply, error)
+
+	// Removes a reply from the queue
+	Remove(reviewId string) error
+}
+
+// Stores replies waiting for approval in memory
+type MemoryReviewApprovalQueue struct {
+	mu      sync.Mutex
+	replies map[string]ReviewReply
+}
+
+func NewMemoryReviewApprovalQueue() *MemoryReviewApprovalQueue {
+	return &MemoryReviewApprovalQueue{replies: map[string]ReviewReply{}}
+}
+
+func (q *MemoryReviewApprovalQueue) Add(reply ReviewReply) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.replies[reply.ReviewId] = reply
+	return nil
+}
+
+func (q *MemoryReviewApprovalQueue) Get(reviewId string) (*ReviewReply, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	reply, ok := q.replies[reviewId]
+	if !ok {
+		return nil, nil
+	}
+	return &reply, nil
+}
+
+func (q *MemoryReviewApprovalQueue) Pending() ([]ReviewReply, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	replies := make([]ReviewReply, 0, len(q.replies))
+	for _, reply := range q.replies {
+		replies = append(replies, reply)
+	}
+	sort.Slice(replies, func(i, j int) bool {
+		return replies[i].ReviewId < replies[j].ReviewId
+	})
+	return replies, nil
+}
+
+func (q *MemoryReviewApprovalQueue) Remove(reviewId string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.replies, reviewId)
+	return nil
+}
+
+// How replies are handled after they're generated
+type ReviewReplyMode string
+
+const (
+	// Replies are posted right away
+	ReviewReplyModeAuto ReviewReplyMode = "auto"
+
+	// Replies are only returned
+	ReviewReplyModeDryRun ReviewReplyMode = "dry_run"
+
+	// Replies are added to the approval queue
+	ReviewReplyModeApproval ReviewReplyMode = "approval"
+)
+
+type ReviewReplierOption func(r *ReviewReplier)
+
+// How replies are handled. Default is ReviewReplyModeAuto
+func WithReviewReplyMode(mode ReviewReplyMode) ReviewReplierOption {
+	return func(r *ReviewReplier) {
+		r.mode = mode
+	}
+}
+
+// Language of reply templates. If a rule has no template in this language,
+// template in Russian is used. Default is "ru"
+func WithReviewLanguage(language string) ReviewReplierOption {
+	return func(r *ReviewReplier) {
+		r.language = language
+	}
+}
+
+// Queue for replies waiting for approval.
+//
+// Default is MemoryReviewApprovalQueue
+func WithReviewApprovalQueue(queue ReviewApprovalQueue) ReviewReplierOption {
+	return func(r *ReviewReplier) {
+		r.queue = queue
+	}
+}
+
+// Products service used to fill product details in templates
+func WithReviewProducts(products *Products) ReviewReplierOption {
+	return func(r *ReviewReplier) {
+		r.products = products
+	}
+}
+
+// Function used to fill customer details in templates
+func WithReviewCustomerResolver(resolver func(ctx context.Context, review *ReviewDetails) (ReviewCustomer, error)) ReviewReplierOption {
+	return func(r *ReviewReplier) {
+		r.resolveCustomer = resolver
+	}
+}
+
+// Change status of answered reviews to PROCESSED together with the reply. Default is true
+func WithMarkReviewsProcessed(mark bool) ReviewReplierOption {
+	return func(r *ReviewReplier) {
+		r.markProcessed = mark
+	}
+}
+
+// Answers reviews by rules. Each review is answered
+// with templates of the first matching rule
+type ReviewReplier struct {
+	reviews *Reviews
+	rules   []ReviewRule
+
+	// Compiled templates by rule index and language
+	templates []map[string]*template.Template
+
+	mode            ReviewReplyMode
+	language        string
+	queue           ReviewApprovalQueue
+	products        *Products
+	resolveCustomer func(ctx context.Context, review *ReviewDetails) (ReviewCustomer, error)
+	markProcessed   bool
+
+	productsMu    sync.Mutex
+	productsCache map[int64]ProductDetails
+}
+
+// Creates a replier. Returns an error if any of the templates is invalid
+func NewReviewReplier(reviews *Reviews, rules []ReviewRule, opts ...ReviewReplierOption) (*ReviewReplier, error) {
+	r := &ReviewReplier{
+		reviews:       reviews,
+		rules:         rules,
+		mode:          ReviewReplyModeAuto,
+		language:      defaultReviewLanguage,
+		queue:         NewMemoryReviewApprovalQueue(),
+		markProcessed: true,
+		productsCache: map[int64]ProductDetails{},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	for i, rule := range rules {
+		templates := map[string]*template.Template{}
+		for language, text := range rule.Templates {
+			tmpl, err := template.New(rule.Name + "/" + language).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d %s: %w", i, rule.Name, err)
+			}
+			templates[language] = tmpl
+		}
+		r.templates = append(r.templates, templates)
+	}
+
+	return r, nil
+}
+
+// Answers all unprocessed reviews once. Returns generated replies.
+// Reviews are marked as processed with the reply, and reviews that
+// already have a seller comment are skipped, so they aren't answered twice
+func (r *ReviewReplier) Process(ctx context.Context) ([]ReviewReply, error) {
+	replies := []ReviewReply{}
+
+	params := &ListReviewsParams{
+		Limit:   reviewsBatchSize,
+		SortDir: Ascending,
+		Status:  ReviewStatusUnprocessed,
+	}
+	for {
+		resp, err := r.reviews.List(ctx, params)
+		if err != nil {
+			return replies, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return replies, fmt.Errorf("list reviews: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		for i := range resp.Reviews {
+			reply, err := r.reply(ctx, &resp.Reviews[i])
+			if err != nil {
+				return replies, err
+			}
+			if reply == nil {
+				continue
+			}
+
+			replies = append(replies, *reply)
+		}
+
+		if !resp.HasNext || resp.LastId == "" {
+			break
+		}
+		params.LastId = resp.LastId
+	}
+
+	return replies, nil
+}
+
+// Answers a single review, e.g. a review received in a notification.
+// Returns nil if no rule matches the review
+func (r *ReviewReplier) ProcessReview(ctx context.Context, reviewId string) (*ReviewReply, error) {
+	resp, err := r.reviews.Get(ctx, &GetReviewParams{ReviewId: reviewId})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get review %s: %d %s", reviewId, resp.StatusCode, resp.Message)
+	}
+
+	reply, err := r.reply(ctx, &resp.ReviewDetails)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Returns replies waiting for approval
+func (r *ReviewReplier) Pending() ([]ReviewReply, error) {
+	return r.queue.Pending()
+}
+
+// Posts a reply from the approval queue. If text isn't empty,
+// it's posted instead of the generated one
+func (r *ReviewReplier) Approve(ctx context.Context, reviewId string, text string) (*ReviewReply, error) {
+	reply, err := r.queue.Get(reviewId)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, fmt.Errorf("review %s is not waiting for approval", reviewId)
+	}
+	if text != "" {
+		reply.Text = text
+	}
+
+	if err := r.post(ctx, reply); err != nil {
+		return nil, err
+	}
+	return reply, r.queue.Remove(reviewId)
+}
+
+// Removes a reply from the approval queue without posting it
+func (r *ReviewReplier) Reject(reviewId string) error {
+	return r.queue.Remove(reviewId)
+}
+
+func (r *ReviewReplier) reply(ctx context.Context, review *ReviewDetails) (*ReviewReply, error) {
+	pending, err := r.queue.Get(review.Id)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, nil
+	}
+
+	if review.CommentsAmount > 0 {
+		answered, err := r.isAnswered(ctx, review.Id)
+		if err != nil || answered {
+			return nil, err
+		}
+	}
+
+	for i, rule := range r.rules {
+		if !rule.Matches(review) {
+			continue
+		}
+
+		text, err := r.render(ctx, i, review)
+		if err != nil {
+			return nil, err
+		}
+
+		reply := &ReviewReply{
+			ReviewId: review.Id,
+			SKU:      review.SKU,
+			Rating:   review.Rating,
+			Rule:     rule.Name,
+			Text:     text,
+		}
+
+		switch {
+		case r.mode == ReviewReplyModeDryRun:
+			reply.Status = ReviewReplyDryRun
+		case r.mode == ReviewReplyModeApproval || rule.RequireApproval:
+			reply.Status = ReviewReplyPending
+			if err := r.queue.Add(*reply); err != nil {
+				return nil, err
+			}
+		default:
+			if err := r.post(ctx, reply); err != nil {
+				return nil, err
+			}
+		}
+
+		return reply, nil
+	}
+
+	return nil, nil
+}
+
+func (r *ReviewReplier) render(ctx context.Context, ruleIndex int, review *ReviewDetails) (string, error) {
+	templates := r.templates[ruleIndex]
+	tmpl, ok := templates[r.language]
+	if !ok {
+		tmpl, ok = templates[defaultReviewLanguage]
+	}
+	if !ok {
+		return "", fmt.Errorf("rule %s has no template for language %s", r.rules[ruleIndex].Name, r.language)
+	}
+
+	data := ReviewReplyData{Review: *review}
+
+	if r.products != nil {
+		product, err := r.product(ctx, review.SKU)
+		if err != nil {
+			return "", err
+		}
+		data.Product = product
+	}
+
+	if r.resolveCustomer != nil {
+		customer, err := r.resolveCustomer(ctx, review)
+		if err != nil {
+			return "", err
+		}
+		data.Customer = customer
+	}
+
+	text := &strings.Builder{}
+	if err := tmpl.Execute(text, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+func (r *ReviewReplier) product(ctx context.Context, sku int64) (ProductDetails, error) {
+	r.productsMu.Lock()
+	defer r.productsMu.Unlock()
+
+	if product, ok := r.productsCache[sku]; ok {
+		return product, nil
+	}
+
+	resp, err := r.products.ListProductsByIDs(ctx, &ListProductsByIDsParams{SKU: []int64{sku}})
+	if err != nil {
+		return ProductDetails{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ProductDetails{}, fmt.Errorf("get product %d: %d %s", sku, resp.StatusCode, resp.Message)
+	}
+
+	product := ProductDetails{SKU: sku}
+	if len(resp.Items) > 0 {
+		product = resp.Items[0]
+	}
+	r.productsCache[sku] = product
+	return product, nil
+}
+
+func (r *ReviewReplier) post(ctx context.Context, reply *ReviewReply) error {
+	resp, err := r.reviews.LeaveComment(ctx, &LeaveCommentParams{
+		MarkReviewAsProcesses: r.markProcessed,
+		ReviewId:              reply.ReviewId,
+		Text:                  reply.Text,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("leave comment on review %s: %d %s", reply.ReviewId, resp.StatusCode, resp.Message)
+	}
+
+	reply.Status = ReviewReplyPosted
+	reply.CommentId = resp.CommentId
+	return nil
+}
+
+// Checks if the review has a seller comment, e.g. if it wasn't marked
+// as processed after the reply or it was answered in the seller account
+func (r *ReviewReplier) isAnswered(ctx context.Context, reviewId string) (bool, error) {
+	params := &ListCommentsParams{
+		Limit:    reviewCommentsBatchSize,
+		ReviewId: reviewId,
+		SortDir:  Ascending,
+	}
+	for {
+		resp, err := r.reviews.ListComments(ctx, params)
+		if err != nil {
+			return false, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return false, fmt.Errorf("list comments of review %s: %d %s", reviewId, resp.StatusCode, resp.Message)
+		}
+
+		for _, comment := range resp.Comments {
+			if comment.IsOwner {
+				return true, nil
+			}
+		}
+		if len(resp.Comments) < int(params.Limit) {
+			return false, nil
+		}
+		params.Offset += int32(len(resp.Comments))
+	}
+}
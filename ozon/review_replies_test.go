@@ -0,0 +1,324 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type reviewRepliesMock struct {
+	mu       sync.Mutex
+	lists    []ListReviewsParams
+	comments []LeaveCommentParams
+	statuses []ChangeStatusParams
+
+	// Comments to this review fail
+	failReviewId string
+}
+
+func (m *reviewRepliesMock) handler(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var response string
+	switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+	case "/v1/review/list":
+		params := ListReviewsParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+		m.lists = append(m.lists, params)
+
+		response = `{
+			"has_next": true,
+			"last_id": "2",
+			"reviews": [
+				` + m.review("1", `"rating": 5, "sku": 100, "photos_amount": 2, "text": "Отличный товар"`) + `,
+				` + m.review("2", `"rating": 1, "sku": 200, "text": "Пришел БРАК, верните деньги"`) + `
+			]
+		}`
+		if params.LastId == "2" {
+			response = `{
+				"has_next": false,
+				"reviews": [
+					` + m.review("3", `"rating": 3, "sku": 100, "text": "Нормально"`) + `,
+					` + m.review("4", `"rating": 5, "sku": 100, "text": "Хорошо"`) + `
+				]
+			}`
+		}
+	case "/v1/review/info":
+		response = m.review("5", `"rating": 5, "sku": 100, "text": "Супер"`)
+	case "/v1/review/comment/list":
+		params := ListCommentsParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+		comments := []string{`{"id": "customer-comment", "is_owner": false}`}
+		for _, comment := range m.comments {
+			if comment.ReviewId == params.ReviewId {
+				comments = append(comments, `{"id": "comment-`+comment.ReviewId+`", "is_owner": true}`)
+			}
+		}
+		response = `{"comments": [` + strings.Join(comments, ",") + `]}`
+	case "/v1/review/comment/create":
+		params := LeaveCommentParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+		if params.ReviewId == m.failReviewId {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"code": 13, "message": "internal error"}`))
+			return
+		}
+		m.comments = append(m.comments, params)
+		response = `{"comment_id": "comment-` + params.ReviewId + `"}`
+	case "/v1/review/change-status":
+		params := ChangeStatusParams{}
+		json.NewDecoder(r.Body).Decode(&params)
+		m.statuses = append(m.statuses, params)
+		response = `{}`
+	case "/v3/product/info/list":
+		response = `{"items": [{"name": "Чайник", "offer_id": "kettle", "sku": 100}]}`
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(response))
+}
+
+// Review with the number of posted comments. Reviews stay
+// unprocessed, as if their status wasn't changed
+func (m *reviewRepliesMock) review(id string, fields string) string {
+	comments := 0
+	for _, comment := range m.comments {
+		if comment.ReviewId == id {
+			comments++
+		}
+	}
+	return fmt.Sprintf(`{"id": %q, "comments_amount": %d, %s}`, id, comments, fields)
+}
+
+func reviewRepliesRules() []ReviewRule {
+	withPhotos := true
+	return []ReviewRule{
+		{
+			Name:      "positive with photos",
+			MinRating: 4,
+			HasPhotos: &withPhotos,
+			Templates: map[string]string{
+				"ru": "{{.Customer.Name}}, спасибо за фото! Рады, что {{.Product.Name}} понравился",
+				"en": "Thank you for the photos, {{.Customer.Name}}!",
+			},
+		},
+		{
+			Name:            "defect",
+			MaxRating:       2,
+			Keywords:        []string{"брак", "сломан"},
+			RequireApproval: true,
+			Templates: map[string]string{
+				"ru": "Сожалеем! Напишите нам в чат по заказу",
+			},
+		},
+		{
+			Name:      "positive",
+			MinRating: 5,
+			Templates: map[string]string{
+				"ru": "Спасибо за оценку {{.Review.Rating}}!",
+			},
+		},
+	}
+}
+
+func TestReviewReplier(t *testing.T) {
+	t.Parallel()
+
+	mock := &reviewRepliesMock{}
+	c := NewMockClient(mock.handler)
+
+	replier, err := NewReviewReplier(c.Reviews(), reviewRepliesRules(),
+		WithReviewProducts(c.Products()),
+		WithReviewCustomerResolver(func(ctx context.Context, review *ReviewDetails) (ReviewCustomer, error) {
+			return ReviewCustomer{Name: "Анна"}, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	replies, err := replier.Process(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ReviewReply{
+		{ReviewId: "1", SKU: 100, Rating: 5, Rule: "positive with photos", Text: "Анна, спасибо за фото! Рады, что Чайник понравился", Status: ReviewReplyPosted, CommentId: "comment-1"},
+		{ReviewId: "2", SKU: 200, Rating: 1, Rule: "defect", Text: "Сожалеем! Напишите нам в чат по заказу", Status: ReviewReplyPending},
+		{ReviewId: "4", SKU: 100, Rating: 5, Rule: "positive", Text: "Спасибо за оценку 5!", Status: ReviewReplyPosted, CommentId: "comment-4"},
+	}
+	if len(replies) != len(expected) {
+		t.Fatalf("wrong replies: got: %+v, expected: %+v", replies, expected)
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("wrong reply: got: %+v, expected: %+v", replies[i], expected[i])
+		}
+	}
+
+	mock.mu.Lock()
+	if len(mock.lists) != 2 || mock.lists[0].Status != ReviewStatusUnprocessed || mock.lists[1].LastId != "2" {
+		t.Errorf("reviews must be listed with cursor, got: %+v", mock.lists)
+	}
+	if len(mock.comments) != 2 {
+		t.Errorf("expected 2 comments, got: %+v", mock.comments)
+	}
+	for _, comment := range mock.comments {
+		if !comment.MarkReviewAsProcesses {
+			t.Errorf("answered reviews must be processed with the reply, got: %+v", comment)
+		}
+	}
+	if len(mock.statuses) != 0 {
+		t.Errorf("status must not be changed separately, got: %+v", mock.statuses)
+	}
+	mock.mu.Unlock()
+
+	// Pending reviews are not answered twice
+	pending, _ := replier.Pending()
+	if len(pending) != 1 || pending[0].ReviewId != "2" {
+		t.Fatalf("wrong pending replies: %+v", pending)
+	}
+
+	reply, err := replier.Approve(ctx, "2", "Сожалеем! Мы вернем деньги")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Status != ReviewReplyPosted || reply.CommentId != "comment-2" {
+		t.Errorf("wrong approved reply: %+v", reply)
+	}
+	if pending, _ := replier.Pending(); len(pending) != 0 {
+		t.Errorf("approved reply must be removed from the queue, got: %+v", pending)
+	}
+
+	mock.mu.Lock()
+	if comment := mock.comments[len(mock.comments)-1]; comment.ReviewId != "2" || comment.Text != "Сожалеем! Мы вернем деньги" {
+		t.Errorf("wrong approved comment: %+v", comment)
+	}
+	mock.mu.Unlock()
+
+	if _, err := replier.Approve(ctx, "3", ""); err == nil {
+		t.Errorf("expected error for review not waiting for approval")
+	}
+}
+
+func TestReviewReplierDryRun(t *testing.T) {
+	t.Parallel()
+
+	mock := &reviewRepliesMock{}
+	c := NewMockClient(mock.handler)
+
+	replier, err := NewReviewReplier(c.Reviews(), reviewRepliesRules(),
+		WithReviewReplyMode(ReviewReplyModeDryRun),
+		WithReviewLanguage("en"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	replies, err := replier.Process(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 3 || replies[0].Text != "Thank you for the photos, !" || replies[2].Text != "Спасибо за оценку 5!" {
+		t.Errorf("wrong replies: %+v", replies)
+	}
+	for _, reply := range replies {
+		if reply.Status != ReviewReplyDryRun {
+			t.Errorf("wrong reply status: %+v", reply)
+		}
+	}
+
+	reply, err := replier.ProcessReview(ctx, "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply == nil || reply.Rule != "positive" || reply.Status != ReviewReplyDryRun {
+		t.Errorf("wrong reply: %+v", reply)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.comments) != 0 || len(mock.statuses) != 0 {
+		t.Errorf("nothing must be posted in dry-run mode, got: %+v %+v", mock.comments, mock.statuses)
+	}
+
+	if _, err := NewReviewReplier(c.Reviews(), []ReviewRule{{Templates: map[string]string{"ru": "{{.Review"}}}); err == nil {
+		t.Errorf("expected error for invalid template")
+	}
+}
+
+func TestReviewReplierPostFailed(t *testing.T) {
+	t.Parallel()
+
+	mock := &reviewRepliesMock{failReviewId: "4"}
+	c := NewMockClient(mock.handler)
+
+	replier, err := NewReviewReplier(c.Reviews(), reviewRepliesRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	if _, err := replier.Process(ctx); err == nil {
+		t.Fatal("expected error of the second post")
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.comments) != 1 || mock.comments[0].ReviewId != "1" {
+		t.Errorf("expected the first review to be answered, got: %+v", mock.comments)
+	}
+	if !mock.comments[0].MarkReviewAsProcesses {
+		t.Errorf("answered review must be processed with the reply, got: %+v", mock.comments[0])
+	}
+}
+
+func TestReviewReplierStatusNotChanged(t *testing.T) {
+	t.Parallel()
+
+	mock := &reviewRepliesMock{}
+	c := NewMockClient(mock.handler)
+
+	replier, err := NewReviewReplier(c.Reviews(), reviewRepliesRules(), WithMarkReviewsProcessed(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	if _, err := replier.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Answered reviews are still listed as unprocessed
+	replies, err := replier.Process(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 0 {
+		t.Errorf("answered reviews must be skipped, got: %+v", replies)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.comments) != 2 {
+		t.Errorf("reviews must be answered once, got: %+v", mock.comments)
+	}
+}
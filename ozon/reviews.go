@@ -282,7 +282,7 @@ func (c Reviews) Get(ctx context.Context, params *GetReviewParams) (*GetReviewRe
 
 	resp := &GetReviewResponse{}
 
-	response, err := c.client.Request(ctx, http.MethodPost, url, nil, resp, nil)
+	response, err := c.client.Request(ctx, http.MethodPost, url, params, resp, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -324,7 +324,7 @@ func (c Reviews) List(ctx context.Context, params *ListReviewsParams) (*ListRevi
 
 	resp := &ListReviewsResponse{}
 
-	response, err := c.client.Request(ctx, http.MethodPost, url, nil, resp, nil)
+	response, err := c.client.Request(ctx, http.MethodPost, url, params, resp, nil)
 	if err != nil {
 		return nil, err
 	}
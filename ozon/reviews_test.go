@@ -2,7 +2,10 @@ package ozon
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
 
 	core "github.com/diphantxm/ozon-api-client"
@@ -414,3 +417,40 @@ func TestListReviews(t *testing.T) {
 		}
 	}
 }
+
+func TestReviewsRequestParams(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	bodies := map[string]map[string]interface{}{}
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies["/"+strings.TrimPrefix(r.URL.Path, "/")] = body
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	if _, err := c.Reviews().Get(ctx, &GetReviewParams{ReviewId: "review-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Reviews().List(ctx, &ListReviewsParams{LastId: "review-2", Limit: 20, Status: "UNPROCESSED"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if body := bodies["/v1/review/info"]; body["review_id"] != "review-1" {
+		t.Errorf("review identifier must be sent, got: %v", body)
+	}
+	if body := bodies["/v1/review/list"]; body["last_id"] != "review-2" || body["limit"] != 20.0 || body["status"] != "UNPROCESSED" {
+		t.Errorf("list parameters must be sent, got: %v", body)
+	}
+}
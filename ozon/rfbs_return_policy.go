@@ -0,0 +1,603 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	core "github.com/diphantxm/ozon-api-client"
+)
+
+// Maximum number of return requests in a list request
+const rfbsReturnsBatchSize = 100
+
+// Action taken on an rFBS return request
+type RFBSReturnAction string
+
+const (
+	// Approve the request and agree to receive the product for verification
+	RFBSReturnActionApprove RFBSReturnAction = "approve"
+
+	// Reject the request
+	RFBSReturnActionReject RFBSReturnAction = "reject"
+
+	// Compensate part of the price and leave the product with the customer
+	RFBSReturnActionCompensate RFBSReturnAction = "compensate"
+
+	// Confirm receipt of the product
+	RFBSReturnActionReceive RFBSReturnAction = "receive"
+
+	// Refund the full product cost
+	RFBSReturnActionRefund RFBSReturnAction = "refund"
+
+	// Leave the request for manual review
+	RFBSReturnActionManual RFBSReturnAction = "manual"
+)
+
+// Conditions a return request must satisfy for the rule action to be taken
+type RFBSReturnRule struct {
+	// Rule name
+	Name string
+
+	// Maximum number of days since delivery. Not limited if 0.
+	// Requests with unknown delivery date are left for manual review
+	MaxDaysSinceDelivery int
+
+	// Minimal product price. Not limited if 0
+	MinPrice float64
+
+	// Maximum product price. Not limited if 0
+	MaxPrice float64
+
+	// Return reason identifiers. Any reason if empty
+	ReasonIds []int32
+
+	// If set, the product must be or must not be defective according to the return reason
+	Defect *bool
+
+	// If set, the customer must have or must not have attached photos
+	HasPhotos *bool
+
+	// Action taken on matching requests
+	Action RFBSReturnAction
+
+	// Decision must be approved manually before the action is taken
+	RequireApproval bool
+
+	// Rejection reason identifier for RFBSReturnActionReject
+	RejectionReasonId int64
+
+	// Comment for RFBSReturnActionReject
+	Comment string
+
+	// Method of product return for RFBSReturnActionApprove
+	ReturnMethodDescription string
+
+	// Compensation in percent of the product price for RFBSReturnActionCompensate
+	CompensationPercent float64
+
+	// Refund amount for shipping the product for RFBSReturnActionRefund
+	ReturnForBackWay int64
+}
+
+// Return request with details used by rules
+type RFBSReturnCase struct {
+	GetRFBSReturn
+
+	// Return request identifier
+	ReturnId int64
+
+	// Product price
+	Price float64
+
+	// Delivery date. Zero if unknown
+	DeliveredAt time.Time
+}
+
+// Returns number of full days since delivery and false if delivery date is unknown
+func (c *RFBSReturnCase) DaysSinceDelivery(now time.Time) (int, bool) {
+	if c.DeliveredAt.IsZero() {
+		return 0, false
+	}
+	return int(now.Sub(c.DeliveredAt) / (24 * time.Hour)), true
+}
+
+// Checks if the return request satisfies the rule conditions.
+// The rule doesn't match if the delivery date is required but unknown
+func (r RFBSReturnRule) Matches(c *RFBSReturnCase, now time.Time) bool {
+	if r.MaxDaysSinceDelivery > 0 {
+		days, ok := c.DaysSinceDelivery(now)
+		if !ok || days > r.MaxDaysSinceDelivery {
+			return false
+		}
+	}
+	return r.matchesCase(c)
+}
+
+// Checks the rule conditions except the delivery date
+func (r RFBSReturnRule) matchesCase(c *RFBSReturnCase) bool {
+	if r.MinPrice > 0 && c.Price < r.MinPrice {
+		return false
+	}
+	if r.MaxPrice > 0 && c.Price > r.MaxPrice {
+		return false
+	}
+	if r.Defect != nil && c.ReturnReason.IsDefect != *r.Defect {
+		return false
+	}
+	if r.HasPhotos != nil && (len(c.ClientPhoto) > 0) != *r.HasPhotos {
+		return false
+	}
+
+	if len(r.ReasonIds) == 0 {
+		return true
+	}
+	for _, id := range r.ReasonIds {
+		if id == c.ReturnReason.Id {
+			return true
+		}
+	}
+	return false
+}
+
+// Decision made on a return request
+type RFBSReturnDecision struct {
+	// Decision time
+	Time time.Time `json:"time"`
+
+	// Return request identifier
+	ReturnId int64 `json:"return_id"`
+
+	// Return request number
+	ReturnNumber string `json:"return_number"`
+
+	// Shipment number
+	PostingNumber string `json:"posting_number"`
+
+	// Name of the matched rule. Empty if no rule matched
+	Rule string `json:"rule,omitempty"`
+
+	// Action taken or proposed
+	Action RFBSReturnAction `json:"action"`
+
+	// true, if the decision is waiting for manual review
+	Manual bool `json:"manual"`
+
+	// Why the decision was made
+	Reason string `json:"reason"`
+
+	// true, if the action was taken
+	Executed bool `json:"executed"`
+
+	// true, if the action wasn't taken because of dry-run mode
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Error of taking the action
+	Error string `json:"error,omitempty"`
+
+	rule *RFBSReturnRule
+	c    *RFBSReturnCase
+}
+
+// Log of all decisions made by the policy engine
+type RFBSReturnAuditLog interface {
+	Record(decision RFBSReturnDecision) error
+}
+
+// Appends decisions to a file as JSON lines
+type FileRFBSReturnAuditLog struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (l *FileRFBSReturnAuditLog) Record(decision RFBSReturnDecision) error {
+	content, err := json.Marshal(decision)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Keeps decisions in memory
+type MemoryRFBSReturnAuditLog struct {
+	mu        sync.Mutex
+	decisions []RFBSReturnDecision
+}
+
+func (l *MemoryRFBSReturnAuditLog) Record(decision RFBSReturnDecision) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.decisions = append(l.decisions, decision)
+	return nil
+}
+
+// Returns all recorded decisions
+func (l *MemoryRFBSReturnAuditLog) Decisions() []RFBSReturnDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]RFBSReturnDecision{}, l.decisions...)
+}
+
+type RFBSReturnPolicyOption func(p *RFBSReturnPolicy)
+
+// Log of all decisions.
+//
+// Default is MemoryRFBSReturnAuditLog
+func WithRFBSReturnAuditLog(log RFBSReturnAuditLog) RFBSReturnPolicyOption {
+	return func(p *RFBSReturnPolicy) {
+		p.audit = log
+	}
+}
+
+// FBS service used to get delivery dates of shipments. A shipment is
+// delivered when the courier code is verified, so the delivery date is
+// unknown for shipments without the code. If neither shipments
+// nor the delivery date function are set, return requests matching
+// rules with MaxDaysSinceDelivery are left for manual review
+func WithRFBSReturnShipments(fbs *FBS) RFBSReturnPolicyOption {
+	return func(p *RFBSReturnPolicy) {
+		p.fbs = fbs
+	}
+}
+
+// Function returning the delivery date of the return request shipment,
+// e.g. from the seller's delivery service. Zero date means unknown.
+// It's used instead of shipments
+func WithRFBSReturnDeliveryDate(deliveredAt func(ctx context.Context, c *RFBSReturnCase) (time.Time, error)) RFBSReturnPolicyOption {
+	return func(p *RFBSReturnPolicy) {
+		p.deliveredAt = deliveredAt
+	}
+}
+
+// Identifiers of `available_actions` of a return request that allow each action.
+// Actions without identifiers are never taken automatically,
+// requests matching their rules are queued for manual review
+func WithRFBSReturnActionIds(ids map[RFBSReturnAction][]int32) RFBSReturnPolicyOption {
+	return func(p *RFBSReturnPolicy) {
+		p.actionIds = ids
+	}
+}
+
+// Make decisions without taking actions
+func WithRFBSReturnDryRun(dryRun bool) RFBSReturnPolicyOption {
+	return func(p *RFBSReturnPolicy) {
+		p.dryRun = dryRun
+	}
+}
+
+// Evaluates pending rFBS return requests against rules. The action of
+// the first matching rule is taken, if it's available for the request.
+// Otherwise the request is queued for manual review
+type RFBSReturnPolicy struct {
+	returns *Returns
+	rules   []RFBSReturnRule
+
+	fbs         *FBS
+	deliveredAt func(ctx context.Context, c *RFBSReturnCase) (time.Time, error)
+	audit       RFBSReturnAuditLog
+	actionIds   map[RFBSReturnAction][]int32
+	dryRun      bool
+	now         func() time.Time
+
+	mu     sync.Mutex
+	queued map[int64]RFBSReturnDecision
+}
+
+func NewRFBSReturnPolicy(returns *Returns, rules []RFBSReturnRule, opts ...RFBSReturnPolicyOption) *RFBSReturnPolicy {
+	p := &RFBSReturnPolicy{
+		returns: returns,
+		rules:   rules,
+		audit:   &MemoryRFBSReturnAuditLog{},
+		now:     time.Now,
+		queued:  map[int64]RFBSReturnDecision{},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Evaluates all new return requests once. Requests already
+// waiting for manual review are skipped
+func (p *RFBSReturnPolicy) Process(ctx context.Context) ([]RFBSReturnDecision, error) {
+	decisions := []RFBSReturnDecision{}
+
+	params := &GetRFBSReturnsParams{
+		Filter: &GetRFBSReturnsFilter{GroupState: []RFBSReturnsGroupState{RFBSReturnsGroupStateNew}},
+		Limit:  rfbsReturnsBatchSize,
+	}
+	for {
+		resp, err := p.returns.GetRFBSReturns(ctx, params)
+		if err != nil {
+			return decisions, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return decisions, fmt.Errorf("get rFBS returns: %d %s", resp.StatusCode, resp.Message)
+		}
+
+		for _, item := range resp.Returns {
+			if p.isQueued(item.ReturnId) {
+				continue
+			}
+
+			decision, err := p.Evaluate(ctx, item.ReturnId)
+			if err != nil {
+				return decisions, err
+			}
+			decisions = append(decisions, *decision)
+		}
+
+		if len(resp.Returns) < rfbsReturnsBatchSize {
+			break
+		}
+		params.LastId = int32(resp.Returns[len(resp.Returns)-1].ReturnId)
+	}
+
+	return decisions, nil
+}
+
+// Evaluates a single return request and takes the action
+// or queues it for manual review. Every decision is recorded to the audit log
+func (p *RFBSReturnPolicy) Evaluate(ctx context.Context, returnId int64) (*RFBSReturnDecision, error) {
+	c, err := p.loadCase(ctx, returnId)
+	if err != nil {
+		return nil, err
+	}
+
+	decision := p.decide(c)
+	if !decision.Manual {
+		p.execute(ctx, &decision)
+	} else {
+		p.mu.Lock()
+		p.queued[returnId] = decision
+		p.mu.Unlock()
+	}
+
+	if err := p.audit.Record(decision); err != nil {
+		return &decision, err
+	}
+	return &decision, nil
+}
+
+// Returns decisions waiting for manual review
+func (p *RFBSReturnPolicy) Queued() []RFBSReturnDecision {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	decisions := make([]RFBSReturnDecision, 0, len(p.queued))
+	for _, decision := range p.queued {
+		decisions = append(decisions, decision)
+	}
+	sort.Slice(decisions, func(i, j int) bool {
+		return decisions[i].ReturnId < decisions[j].ReturnId
+	})
+	return decisions
+}
+
+// Takes the proposed action of a decision waiting for manual review
+func (p *RFBSReturnPolicy) Approve(ctx context.Context, returnId int64) (*RFBSReturnDecision, error) {
+	p.mu.Lock()
+	decision, ok := p.queued[returnId]
+	p.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("return %d is not waiting for manual review", returnId)
+	}
+	if decision.rule == nil || decision.Action == RFBSReturnActionManual {
+		return nil, fmt.Errorf("return %d has no proposed action", returnId)
+	}
+
+	decision.Time = p.now()
+	decision.Manual = false
+	decision.Reason = "approved manually"
+	p.execute(ctx, &decision)
+
+	if decision.Error == "" {
+		p.Dismiss(returnId)
+	}
+	if err := p.audit.Record(decision); err != nil {
+		return &decision, err
+	}
+	return &decision, nil
+}
+
+// Removes a decision from the manual review queue without taking the action,
+// e.g. when the request is handled in the seller account
+func (p *RFBSReturnPolicy) Dismiss(returnId int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.queued, returnId)
+}
+
+func (p *RFBSReturnPolicy) isQueued(returnId int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.queued[returnId]
+	return ok
+}
+
+func (p *RFBSReturnPolicy) loadCase(ctx context.Context, returnId int64) (*RFBSReturnCase, error) {
+	resp, err := p.returns.GetRFBSReturn(ctx, &GetRFBSReturnParams{ReturnId: returnId})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get rFBS return %d: %d %s", returnId, resp.StatusCode, resp.Message)
+	}
+
+	c := &RFBSReturnCase{GetRFBSReturn: resp.Returns, ReturnId: returnId}
+	c.Price, _ = strconv.ParseFloat(resp.Returns.Product.Price, 64)
+
+	switch {
+	case p.deliveredAt != nil:
+		c.DeliveredAt, err = p.deliveredAt(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("get delivery date of %s: %w", c.PostingNumber, err)
+		}
+	case p.fbs != nil && c.PostingNumber != "":
+		shipment, err := p.fbs.GetShipmentDataByIdentifier(ctx, &GetShipmentDataByIdentifierParams{PostingNumber: c.PostingNumber})
+		if err != nil {
+			return nil, err
+		}
+		if shipment.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("get shipment %s: %d %s", c.PostingNumber, shipment.StatusCode, shipment.Message)
+		}
+		// Delivering date is the date of transfer to delivery, not the delivery itself
+		c.DeliveredAt = shipment.Result.PickupCodeVerifiedAt
+	}
+
+	return c, nil
+}
+
+func (p *RFBSReturnPolicy) decide(c *RFBSReturnCase) RFBSReturnDecision {
+	decision := RFBSReturnDecision{
+		Time:          p.now(),
+		ReturnId:      c.ReturnId,
+		ReturnNumber:  c.ReturnNumber,
+		PostingNumber: c.PostingNumber,
+		Action:        RFBSReturnActionManual,
+		Manual:        true,
+		Reason:        "no rule matched",
+		c:             c,
+	}
+
+	for i := range p.rules {
+		rule := &p.rules[i]
+		if !rule.matchesCase(c) {
+			continue
+		}
+
+		// Later rules may be more permissive, so the evaluation stops
+		// if it's unknown whether the delivery period is exceeded
+		days, delivered := c.DaysSinceDelivery(decision.Time)
+		if rule.MaxDaysSinceDelivery > 0 && delivered && days > rule.MaxDaysSinceDelivery {
+			continue
+		}
+
+		decision.Rule = rule.Name
+		decision.Action = rule.Action
+		decision.rule = rule
+
+		switch {
+		case rule.MaxDaysSinceDelivery > 0 && !delivered:
+			decision.Reason = "delivery date is unknown"
+		case rule.Action == RFBSReturnActionManual:
+			decision.Reason = "rule requires manual review"
+		case !p.isAvailable(rule.Action, c.AvailableActions):
+			decision.Reason = fmt.Sprintf("action %s is not available", rule.Action)
+		case rule.RequireApproval:
+			decision.Reason = "rule requires approval"
+		default:
+			decision.Manual = false
+			decision.Reason = "matched rule"
+		}
+		return decision
+	}
+
+	return decision
+}
+
+func (p *RFBSReturnPolicy) isAvailable(action RFBSReturnAction, available []GetRFBSReturnAction) bool {
+	for _, id := range p.actionIds[action] {
+		for _, a := range available {
+			if a.Id == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *RFBSReturnPolicy) execute(ctx context.Context, decision *RFBSReturnDecision) {
+	if p.dryRun {
+		decision.DryRun = true
+		return
+	}
+
+	if err := p.takeAction(ctx, decision.rule, decision.c); err != nil {
+		decision.Error = err.Error()
+		return
+	}
+	decision.Executed = true
+}
+
+func (p *RFBSReturnPolicy) takeAction(ctx context.Context, rule *RFBSReturnRule, c *RFBSReturnCase) error {
+	var common core.CommonResponse
+
+	switch rule.Action {
+	case RFBSReturnActionApprove:
+		resp, err := p.returns.ApproveRFBSReturn(ctx, &ApproveRFBSReturnParams{
+			ReturnId:                c.ReturnId,
+			ReturnMethodDescription: rule.ReturnMethodDescription,
+		})
+		if err != nil {
+			return err
+		}
+		common = resp.CommonResponse
+	case RFBSReturnActionReject:
+		resp, err := p.returns.RejectRFBSReturn(ctx, &RejectRFBSReturnParams{
+			ReturnId:          c.ReturnId,
+			Comment:           rule.Comment,
+			RejectionReasonId: rule.RejectionReasonId,
+		})
+		if err != nil {
+			return err
+		}
+		common = resp.CommonResponse
+	case RFBSReturnActionCompensate:
+		resp, err := p.returns.CompensateRFBSReturn(ctx, &CompensateRFBSReturnParams{
+			ReturnId:           c.ReturnId,
+			CompensationAmount: strconv.FormatFloat(c.Price*rule.CompensationPercent/100, 'f', 2, 64),
+		})
+		if err != nil {
+			return err
+		}
+		common = resp.CommonResponse
+	case RFBSReturnActionReceive:
+		resp, err := p.returns.ReceiveRFBSReturn(ctx, &ReceiveRFBSReturnParams{ReturnId: c.ReturnId})
+		if err != nil {
+			return err
+		}
+		common = resp.CommonResponse
+	case RFBSReturnActionRefund:
+		resp, err := p.returns.RefundRFBS(ctx, &RefundRFBSParams{
+			ReturnId:         c.ReturnId,
+			ReturnForBackWay: rule.ReturnForBackWay,
+		})
+		if err != nil {
+			return err
+		}
+		common = resp.CommonResponse
+	default:
+		return fmt.Errorf("unknown action: %s", rule.Action)
+	}
+
+	if common.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s rFBS return %d: %d %s", rule.Action, c.ReturnId, common.StatusCode, common.Message)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package ozon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type rfbsReturnsMock struct {
+	mu      sync.Mutex
+	actions []string
+}
+
+func (m *rfbsReturnsMock) handler(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivered := time.Now().Add(-3 * 24 * time.Hour).Format(time.RFC3339)
+	params := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&params)
+
+	var response string
+	path := "/" + strings.TrimPrefix(r.URL.Path, "/")
+	switch path {
+	case "/v2/returns/rfbs/list":
+		response = `{"returns": [{"return_id": 1}, {"return_id": 2}, {"return_id": 3}, {"return_id": 4}]}`
+	case "/v2/returns/rfbs/get":
+		switch params["return_id"] {
+		// Cheap product
+		case 1.0:
+			response = `{"returns": {"available_actions": [{"id": 1}], "posting_number": "1-1", "product": {"price": "300"}, "return_reason": {"id": 10}}}`
+		// Defect with photos
+		case 2.0:
+			response = `{"returns": {"available_actions": [{"id": 2}], "client_photo": ["https://ozon.ru/photo.jpg"], "posting_number": "2-1", "product": {"price": "5000"}, "return_reason": {"id": 20, "is_defect": true}}}`
+		// Defect without photos
+		case 3.0:
+			response = `{"returns": {"available_actions": [{"id": 1}, {"id": 2}], "posting_number": "3-1", "product": {"price": "5000"}, "return_reason": {"id": 20, "is_defect": true}}}`
+		// Expensive product
+		case 4.0:
+			response = `{"returns": {"available_actions": [{"id": 1}], "posting_number": "4-1", "product": {"price": "50000"}, "return_reason": {"id": 10}}}`
+		}
+	case "/v3/posting/fbs/get":
+		// Transfer to delivery is too long ago for the cheap product rule
+		response = `{"result": {"delivering_date": "2020-01-01T00:00:00Z", "pickup_code_verified_at": "` + delivered + `"}}`
+	case "/v2/returns/rfbs/return-money", "/v2/returns/rfbs/compensate", "/v2/returns/rfbs/verify", "/v2/returns/rfbs/reject", "/v2/returns/rfbs/receive-return":
+		m.actions = append(m.actions, fmt.Sprintf("%s %v %v", path, params["return_id"], params["compensation_amount"]))
+		response = `{}`
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(response))
+}
+
+func rfbsReturnRules() []RFBSReturnRule {
+	defect, photos := true, true
+	return []RFBSReturnRule{
+		{
+			Name:                 "cheap",
+			MaxPrice:             1000,
+			MaxDaysSinceDelivery: 7,
+			Action:               RFBSReturnActionRefund,
+		},
+		{
+			Name:                "defect with photos",
+			Defect:              &defect,
+			HasPhotos:           &photos,
+			Action:              RFBSReturnActionCompensate,
+			CompensationPercent: 20,
+		},
+		{
+			Name:            "defect",
+			Defect:          &defect,
+			Action:          RFBSReturnActionApprove,
+			RequireApproval: true,
+		},
+	}
+}
+
+func TestRFBSReturnPolicy(t *testing.T) {
+	t.Parallel()
+
+	mock := &rfbsReturnsMock{}
+	c := NewMockClient(mock.handler)
+
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	policy := NewRFBSReturnPolicy(c.Returns(), rfbsReturnRules(),
+		WithRFBSReturnShipments(c.FBS()),
+		WithRFBSReturnAuditLog(&FileRFBSReturnAuditLog{Path: auditPath}),
+		WithRFBSReturnActionIds(map[RFBSReturnAction][]int32{
+			RFBSReturnActionRefund:     {1},
+			RFBSReturnActionCompensate: {2},
+			RFBSReturnActionApprove:    {1},
+		}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	decisions, err := policy.Process(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		rule     string
+		action   RFBSReturnAction
+		manual   bool
+		executed bool
+	}{
+		{"cheap", RFBSReturnActionRefund, false, true},
+		{"defect with photos", RFBSReturnActionCompensate, false, true},
+		{"defect", RFBSReturnActionApprove, true, false},
+		{"", RFBSReturnActionManual, true, false},
+	}
+	if len(decisions) != len(expected) {
+		t.Fatalf("wrong decisions: %+v", decisions)
+	}
+	for i, e := range expected {
+		d := decisions[i]
+		if d.Rule != e.rule || d.Action != e.action || d.Manual != e.manual || d.Executed != e.executed || d.Error != "" {
+			t.Errorf("wrong decision for return %d: %+v", d.ReturnId, d)
+		}
+	}
+
+	mock.mu.Lock()
+	if strings.Join(mock.actions, ",") != "/v2/returns/rfbs/return-money 1 <nil>,/v2/returns/rfbs/compensate 2 1000.00" {
+		t.Errorf("wrong actions: %v", mock.actions)
+	}
+	mock.mu.Unlock()
+
+	queued := policy.Queued()
+	if len(queued) != 2 || queued[0].ReturnId != 3 || queued[1].ReturnId != 4 {
+		t.Fatalf("wrong queue: %+v", queued)
+	}
+
+	// Queued requests are not evaluated again
+	decisions, err = policy.Process(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 2 {
+		t.Errorf("only not queued requests must be evaluated, got: %+v", decisions)
+	}
+
+	decision, err := policy.Approve(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decision.Executed || decision.Manual {
+		t.Errorf("wrong approved decision: %+v", decision)
+	}
+	if _, err := policy.Approve(ctx, 4); err == nil {
+		t.Errorf("expected error for decision without action")
+	}
+	if len(policy.Queued()) != 1 {
+		t.Errorf("approved decision must be removed from the queue")
+	}
+
+	file, err := os.Open(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		decision := RFBSReturnDecision{}
+		if err := json.Unmarshal(scanner.Bytes(), &decision); err != nil {
+			t.Fatal(err)
+		}
+		records++
+	}
+	if records != 7 {
+		t.Errorf("every decision must be recorded, got: %d", records)
+	}
+}
+
+func TestRFBSReturnPolicyDryRun(t *testing.T) {
+	t.Parallel()
+
+	mock := &rfbsReturnsMock{}
+	c := NewMockClient(mock.handler)
+
+	audit := &MemoryRFBSReturnAuditLog{}
+	policy := NewRFBSReturnPolicy(c.Returns(), rfbsReturnRules(),
+		WithRFBSReturnAuditLog(audit),
+		WithRFBSReturnDryRun(true),
+		WithRFBSReturnActionIds(map[RFBSReturnAction][]int32{RFBSReturnActionCompensate: {2}}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	decision, err := policy.Evaluate(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decision.DryRun || decision.Executed || decision.Action != RFBSReturnActionCompensate {
+		t.Errorf("wrong decision: %+v", decision)
+	}
+
+	// Delivery date is unknown without shipments
+	decision, err = policy.Evaluate(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decision.Manual || decision.Rule != "cheap" || decision.Reason != "delivery date is unknown" {
+		t.Errorf("wrong decision: %+v", decision)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.actions) != 0 {
+		t.Errorf("actions must not be taken in dry-run mode, got: %v", mock.actions)
+	}
+	if len(audit.Decisions()) != 2 {
+		t.Errorf("wrong audit log: %+v", audit.Decisions())
+	}
+}
+
+func TestRFBSReturnPolicyUnmappedAction(t *testing.T) {
+	t.Parallel()
+
+	mock := &rfbsReturnsMock{}
+	c := NewMockClient(mock.handler)
+
+	deliveredAt := time.Now().Add(-24 * time.Hour)
+	policy := NewRFBSReturnPolicy(c.Returns(), rfbsReturnRules(),
+		WithRFBSReturnDeliveryDate(func(ctx context.Context, c *RFBSReturnCase) (time.Time, error) {
+			return deliveredAt, nil
+		}),
+		WithRFBSReturnActionIds(map[RFBSReturnAction][]int32{RFBSReturnActionCompensate: {2}}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// Refund isn't mapped to action identifiers, so it isn't taken
+	decision, err := policy.Evaluate(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Rule != "cheap" || !decision.Manual || decision.Executed {
+		t.Errorf("unmapped action must be left for manual review, got: %+v", decision)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.actions) != 0 {
+		t.Errorf("no actions must be taken, got: %v", mock.actions)
+	}
+}
+
+func TestRFBSReturnPolicyUnknownDeliveryDate(t *testing.T) {
+	t.Parallel()
+
+	mock := &rfbsReturnsMock{}
+	c := NewMockClient(mock.handler)
+
+	rules := append(rfbsReturnRules(), RFBSReturnRule{
+		Name:   "any",
+		Action: RFBSReturnActionRefund,
+	})
+	policy := NewRFBSReturnPolicy(c.Returns(), rules,
+		WithRFBSReturnDeliveryDate(func(ctx context.Context, c *RFBSReturnCase) (time.Time, error) {
+			return time.Time{}, nil
+		}),
+		WithRFBSReturnActionIds(map[RFBSReturnAction][]int32{RFBSReturnActionRefund: {1}}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// The delivery period of the first rule can't be checked,
+	// so the request isn't refunded by the last rule
+	decision, err := policy.Evaluate(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Rule != "cheap" || !decision.Manual || decision.Executed || decision.Reason != "delivery date is unknown" {
+		t.Errorf("request with unknown delivery date must be left for manual review, got: %+v", decision)
+	}
+
+	// Rule without the delivery period matches as usual
+	decision, err = policy.Evaluate(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Rule != "any" || decision.Manual || !decision.Executed {
+		t.Errorf("wrong decision: %+v", decision)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.actions) != 1 || !strings.HasPrefix(mock.actions[0], "/v2/returns/rfbs/return-money 4 ") {
+		t.Errorf("wrong actions: %v", mock.actions)
+	}
+}
@@ -0,0 +1,146 @@
+package ozon
+
+import (
+	"strings"
+)
+
+// Endings of the Snowball stemming algorithm for Russian.
+// Endings in `*Preceded` groups must follow "а" or "я"
+var (
+	russianPerfectiveGerundPreceded = []string{"в", "вши", "вшись"}
+	russianPerfectiveGerund         = []string{"ив", "ивши", "ившись", "ыв", "ывши", "ывшись"}
+
+	russianAdjective = []string{
+		"ее", "ие", "ые", "ое", "ими", "ыми", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом",
+		"его", "ого", "ему", "ому", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею",
+	}
+
+	russianParticiplePreceded = []string{"ем", "нн", "вш", "ющ", "щ"}
+	russianParticiple         = []string{"ивш", "ывш", "ующ"}
+
+	russianReflexive = []string{"ся", "сь"}
+
+	russianVerbPreceded = []string{"ла", "на", "ете", "йте", "ли", "й", "л", "ем", "н", "ло", "но", "ет", "ют", "ны", "ть", "ешь", "нно"}
+	russianVerb         = []string{
+		"ила", "ыла", "ена", "ейте", "уйте", "ите", "или", "ыли", "ей", "уй", "ил", "ыл", "им", "ым", "ен",
+		"ило", "ыло", "ено", "ят", "ует", "уют", "ит", "ыт", "ены", "ить", "ыть", "ишь", "ую", "ю",
+	}
+
+	russianNoun = []string{
+		"а", "ев", "ов", "ие", "ье", "е", "иями", "ями", "ами", "еи", "ии", "и", "ией", "ей", "ой", "ий", "й",
+		"иям", "ям", "ием", "ем", "ам", "ом", "о", "у", "ах", "иях", "ях", "ы", "ь", "ию", "ью", "ю", "ия", "ья", "я",
+	}
+
+	russianSuperlative  = []string{"ейш", "ейше"}
+	russianDerivational = []string{"ост", "ость"}
+)
+
+func isRussianVowel(r rune) bool {
+	return strings.ContainsRune("аеиоуыэюя", r)
+}
+
+// Returns the stem of a Russian word using the Snowball algorithm.
+// Words with non-Cyrillic letters are only lowercased
+func stemRussian(word string) string {
+	word = strings.ReplaceAll(strings.ToLower(word), "ё", "е")
+	w := []rune(word)
+	for _, r := range w {
+		if r < 'а' || r > 'я' {
+			return word
+		}
+	}
+
+	rv, r2 := russianRegions(w)
+
+	// Step 1
+	if n := russianEnding(w, rv, russianPerfectiveGerundPreceded, russianPerfectiveGerund); n > 0 {
+		w = w[:len(w)-n]
+	} else {
+		if n := russianEnding(w, rv, nil, russianReflexive); n > 0 {
+			w = w[:len(w)-n]
+		}
+
+		if n := russianEnding(w, rv, nil, russianAdjective); n > 0 {
+			w = w[:len(w)-n]
+			if n := russianEnding(w, rv, russianParticiplePreceded, russianParticiple); n > 0 {
+				w = w[:len(w)-n]
+			}
+		} else if n := russianEnding(w, rv, russianVerbPreceded, russianVerb); n > 0 {
+			w = w[:len(w)-n]
+		} else if n := russianEnding(w, rv, nil, russianNoun); n > 0 {
+			w = w[:len(w)-n]
+		}
+	}
+
+	// Step 2
+	if n := russianEnding(w, rv, nil, []string{"и"}); n > 0 {
+		w = w[:len(w)-n]
+	}
+
+	// Step 3
+	if n := russianEnding(w, r2, nil, russianDerivational); n > 0 {
+		w = w[:len(w)-n]
+	}
+
+	// Step 4
+	if n := russianEnding(w, rv, nil, russianSuperlative); n > 0 {
+		w = w[:len(w)-n]
+		if russianEnding(w, rv, nil, []string{"нн"}) > 0 {
+			w = w[:len(w)-1]
+		}
+	} else if russianEnding(w, rv, nil, []string{"нн"}) > 0 {
+		w = w[:len(w)-1]
+	} else if n := russianEnding(w, rv, nil, []string{"ь"}); n > 0 {
+		w = w[:len(w)-n]
+	}
+
+	return string(w)
+}
+
+// Returns RV and R2 regions starts
+func russianRegions(w []rune) (int, int) {
+	rv := len(w)
+	for i, r := range w {
+		if isRussianVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+
+	afterVowelConsonant := func(start int) int {
+		for i := start + 1; i < len(w); i++ {
+			if !isRussianVowel(w[i]) && isRussianVowel(w[i-1]) {
+				return i + 1
+			}
+		}
+		return len(w)
+	}
+	r1 := afterVowelConsonant(0)
+	r2 := afterVowelConsonant(r1)
+
+	return rv, r2
+}
+
+// Returns length of the longest ending from both groups that ends the word
+// within the region. Endings from the preceded group must follow "а" or "я",
+// otherwise the word has no ending
+func russianEnding(w []rune, start int, preceded []string, other []string) int {
+	longest, isPreceded := 0, false
+	for i, group := range [][]string{preceded, other} {
+		for _, ending := range group {
+			n := len([]rune(ending))
+			if n <= longest || len(w)-n < start || string(w[len(w)-n:]) != ending {
+				continue
+			}
+			longest, isPreceded = n, i == 0
+		}
+	}
+
+	if isPreceded {
+		i := len(w) - longest - 1
+		if i < start || (w[i] != 'а' && w[i] != 'я') {
+			return 0
+		}
+	}
+	return longest
+}
@@ -0,0 +1,35 @@
+package ozon
+
+import (
+	"testing"
+)
+
+func TestStemRussian(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		word     string
+		expected string
+	}{
+		{"брак", "брак"},
+		{"браком", "брак"},
+		{"бракованный", "бракова"},
+		{"доставка", "доставк"},
+		{"доставкой", "доставк"},
+		{"Сломался", "слома"},
+		{"сломанный", "слома"},
+		{"качественный", "качествен"},
+		{"красивейший", "красив"},
+		{"говорила", "говор"},
+		{"ужасно", "ужасн"},
+		{"ужасный", "ужасн"},
+		{"пришёл", "пришел"},
+		{"iphone", "iphone"},
+	}
+
+	for _, test := range tests {
+		if got := stemRussian(test.word); got != test.expected {
+			t.Errorf("wrong stem of %s: got: %s, expected: %s", test.word, got, test.expected)
+		}
+	}
+}
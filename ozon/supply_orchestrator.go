@@ -0,0 +1,624 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	draftStatusSuccess    = "CALCULATION_STATUS_SUCCESS"
+	draftStatusInProgress = "CALCULATION_STATUS_IN_PROGRESS"
+
+	supplyStatusSuccess    = "DraftSupplyCreateStatusSuccess"
+	supplyStatusInProgress = "DraftSupplyCreateStatusInProgress"
+
+	// Maximum period for supply time slots
+	draftTimeslotsMaxDays = 28
+)
+
+// Supply request creation was interrupted before its operation identifier was saved,
+// so it's unknown if the request was created. Check supply requests, then set
+// the operation identifier or set the step to SupplyFlowStepTimeslotSelected to create it again
+var ErrSupplyCreationInterrupted = errors.New("supply request creation was interrupted")
+
+type SupplyFlowStep string
+
+const (
+	// Supply draft is not created yet
+	SupplyFlowStepNew SupplyFlowStep = "new"
+
+	// Supply draft creation has started
+	SupplyFlowStepDraftCreating SupplyFlowStep = "draft_creating"
+
+	// Supply draft is created, warehouse and time slot are not selected
+	SupplyFlowStepDraftCreated SupplyFlowStep = "draft_created"
+
+	// Warehouse and time slot are selected
+	SupplyFlowStepTimeslotSelected SupplyFlowStep = "timeslot_selected"
+
+	// Supply request creation has started. If the operation identifier
+	// is empty, the flow was interrupted before the request was answered
+	SupplyFlowStepSupplyCreating SupplyFlowStep = "supply_creating"
+
+	// Supply request is created
+	SupplyFlowStepSupplyCreated SupplyFlowStep = "supply_created"
+
+	// Supply request details are received
+	SupplyFlowStepDone SupplyFlowStep = "done"
+)
+
+// State of supply creation. It's saved after each step,
+// so the flow can be resumed if it was interrupted
+type SupplyFlowState struct {
+	// Current step
+	Step SupplyFlowStep `json:"step"`
+
+	// Parameters of the supply draft
+	DraftParams *CreateSupplyDraftParams `json:"draft_params"`
+
+	// Identifier of the supply draft creation operation
+	DraftOperationId string `json:"draft_operation_id,omitempty"`
+
+	// Identifier of the supply request draft
+	DraftId int64 `json:"draft_id,omitempty"`
+
+	// Selected warehouse identifier
+	WarehouseId int64 `json:"warehouse_id,omitempty"`
+
+	// Selected supply time slot
+	Timeslot *CreateSupplyFromDraftTimeslot `json:"timeslot,omitempty"`
+
+	// Identifier of the supply request creation operation
+	SupplyOperationId string `json:"supply_operation_id,omitempty"`
+
+	// Supply requests identifiers
+	OrderIds []int64 `json:"order_ids,omitempty"`
+
+	// Supply requests details
+	Orders []SupplyOrder `json:"orders,omitempty"`
+
+	// Date and time of the last state update
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Saves supply flow state after each step
+type SupplyFlowStore interface {
+	Save(state *SupplyFlowState) error
+}
+
+// Stores supply flow state in a JSON file
+type FileSupplyFlowStore struct {
+	Path string
+}
+
+func (s FileSupplyFlowStore) Save(state *SupplyFlowState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, content)
+}
+
+// Writes to a temporary file first, so the file isn't corrupted
+// if the process is interrupted while writing
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Loads supply flow state saved by FileSupplyFlowStore
+func (s FileSupplyFlowStore) Load() (*SupplyFlowState, error) {
+	content, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &SupplyFlowState{}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Orders warehouses available for the supply by preference
+type WarehouseSelector interface {
+	SelectWarehouses(ctx context.Context, warehouses []SupplyDraftWarehouse) ([]SupplyDraftWarehouse, error)
+}
+
+// Orders warehouses by their rank in a cluster
+type RankedWarehouses struct{}
+
+func (RankedWarehouses) SelectWarehouses(ctx context.Context, warehouses []SupplyDraftWarehouse) ([]SupplyDraftWarehouse, error) {
+	sorted := append([]SupplyDraftWarehouse{}, warehouses...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].TotalRank < sorted[j].TotalRank
+	})
+	return sorted, nil
+}
+
+// Selects only the listed warehouses in the order of the list
+type PreferredWarehouses struct {
+	// Warehouses identifiers
+	WarehouseIds []int64
+}
+
+func (s PreferredWarehouses) SelectWarehouses(ctx context.Context, warehouses []SupplyDraftWarehouse) ([]SupplyDraftWarehouse, error) {
+	selected := []SupplyDraftWarehouse{}
+	for _, id := range s.WarehouseIds {
+		for _, warehouse := range warehouses {
+			if warehouse.Id == id {
+				selected = append(selected, warehouse)
+				break
+			}
+		}
+	}
+	return selected, nil
+}
+
+// Orders warehouses by the number of products they can accept per day
+// in the nearest period, the least loaded first
+type LeastLoadedWarehouses struct {
+	FBO *FBO
+}
+
+func (s LeastLoadedWarehouses) SelectWarehouses(ctx context.Context, warehouses []SupplyDraftWarehouse) ([]SupplyDraftWarehouse, error) {
+	workload, err := s.FBO.GetWarehouseWorkload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if workload.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get warehouse workload: %d %s", workload.StatusCode, workload.Message)
+	}
+
+	capacity := map[string]int32{}
+	for _, result := range workload.Result {
+		if len(result.Schedule.Capacity) > 0 {
+			capacity[result.Warehouse.Id] = result.Schedule.Capacity[0].Value
+		}
+	}
+
+	sorted := append([]SupplyDraftWarehouse{}, warehouses...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return capacity[strconv.FormatInt(sorted[i].Id, 10)] > capacity[strconv.FormatInt(sorted[j].Id, 10)]
+	})
+	return sorted, nil
+}
+
+// Selects supply warehouse and time slot.
+// Time slots are passed in the order of warehouses preference
+type TimeslotSelector interface {
+	SelectTimeslot(timeslots []DraftTimeslot) (warehouseId int64, timeslot *DraftTimeslotDayTimeslot)
+}
+
+// Selects the earliest time slot of the most preferred warehouse with time slots
+type FirstWarehouseTimeslot struct{}
+
+func (FirstWarehouseTimeslot) SelectTimeslot(timeslots []DraftTimeslot) (int64, *DraftTimeslotDayTimeslot) {
+	for _, warehouse := range timeslots {
+		if timeslot := earliestTimeslot(warehouse); timeslot != nil {
+			return warehouse.DropoffWarehouseId, timeslot
+		}
+	}
+	return 0, nil
+}
+
+// Selects the earliest time slot among all warehouses
+type EarliestTimeslot struct{}
+
+func (EarliestTimeslot) SelectTimeslot(timeslots []DraftTimeslot) (int64, *DraftTimeslotDayTimeslot) {
+	var warehouseId int64
+	var earliest *DraftTimeslotDayTimeslot
+	for _, warehouse := range timeslots {
+		timeslot := earliestTimeslot(warehouse)
+		if timeslot != nil && (earliest == nil || timeslot.FromInTimezone.Before(earliest.FromInTimezone)) {
+			warehouseId = warehouse.DropoffWarehouseId
+			earliest = timeslot
+		}
+	}
+	return warehouseId, earliest
+}
+
+func earliestTimeslot(warehouse DraftTimeslot) *DraftTimeslotDayTimeslot {
+	var earliest *DraftTimeslotDayTimeslot
+	for i := range warehouse.Days {
+		for j := range warehouse.Days[i].Timeslots {
+			timeslot := &warehouse.Days[i].Timeslots[j]
+			if earliest == nil || timeslot.FromInTimezone.Before(earliest.FromInTimezone) {
+				earliest = timeslot
+			}
+		}
+	}
+	return earliest
+}
+
+type SupplyOrchestratorOption func(o *SupplyOrchestrator)
+
+// Warehouse selection strategy.
+//
+// Default is RankedWarehouses
+func WithWarehouseSelector(selector WarehouseSelector) SupplyOrchestratorOption {
+	return func(o *SupplyOrchestrator) {
+		o.warehouseSelector = selector
+	}
+}
+
+// Time slot selection strategy.
+//
+// Default is FirstWarehouseTimeslot
+func WithTimeslotSelector(selector TimeslotSelector) SupplyOrchestratorOption {
+	return func(o *SupplyOrchestrator) {
+		o.timeslotSelector = selector
+	}
+}
+
+// Store for the flow state
+func WithSupplyFlowStore(store SupplyFlowStore) SupplyOrchestratorOption {
+	return func(o *SupplyOrchestrator) {
+		o.store = store
+	}
+}
+
+// Callback invoked after each step
+func WithSupplyProgress(progress func(state *SupplyFlowState)) SupplyOrchestratorOption {
+	return func(o *SupplyOrchestrator) {
+		o.progress = progress
+	}
+}
+
+// Interval between status requests.
+//
+// Default is 5 seconds
+func WithPollInterval(interval time.Duration) SupplyOrchestratorOption {
+	return func(o *SupplyOrchestrator) {
+		o.pollInterval = interval
+	}
+}
+
+// Number of days to search supply time slots for.
+//
+// Default and maximum is 28
+func WithTimeslotDays(days int) SupplyOrchestratorOption {
+	return func(o *SupplyOrchestrator) {
+		o.timeslotDays = days
+	}
+}
+
+// Creates FBO supply requests: creates a draft, selects a warehouse
+// and a time slot, creates a supply request from the draft
+// and gets its details
+type SupplyOrchestrator struct {
+	fbo *FBO
+
+	warehouseSelector WarehouseSelector
+	timeslotSelector  TimeslotSelector
+	store             SupplyFlowStore
+	progress          func(state *SupplyFlowState)
+	pollInterval      time.Duration
+	timeslotDays      int
+
+	now func() time.Time
+}
+
+func NewSupplyOrchestrator(fbo *FBO, opts ...SupplyOrchestratorOption) *SupplyOrchestrator {
+	o := &SupplyOrchestrator{
+		fbo:               fbo,
+		warehouseSelector: RankedWarehouses{},
+		timeslotSelector:  FirstWarehouseTimeslot{},
+		pollInterval:      5 * time.Second,
+		timeslotDays:      draftTimeslotsMaxDays,
+		now:               time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.timeslotDays <= 0 || o.timeslotDays > draftTimeslotsMaxDays {
+		o.timeslotDays = draftTimeslotsMaxDays
+	}
+
+	return o
+}
+
+// Starts a new supply flow
+func (o *SupplyOrchestrator) Run(ctx context.Context, params *CreateSupplyDraftParams) (*SupplyFlowState, error) {
+	state := &SupplyFlowState{
+		Step:        SupplyFlowStepNew,
+		DraftParams: params,
+	}
+	return state, o.Resume(ctx, state)
+}
+
+// Continues the supply flow from the state step.
+// State is updated in place, so it can be saved if an error occurs
+func (o *SupplyOrchestrator) Resume(ctx context.Context, state *SupplyFlowState) error {
+	for state.Step != SupplyFlowStepDone {
+		var err error
+
+		switch state.Step {
+		case SupplyFlowStepNew:
+			err = o.createDraft(ctx, state)
+		case SupplyFlowStepDraftCreating:
+			err = o.waitDraft(ctx, state)
+		case SupplyFlowStepDraftCreated:
+			err = o.selectTimeslot(ctx, state)
+		case SupplyFlowStepTimeslotSelected:
+			err = o.createSupply(ctx, state)
+		case SupplyFlowStepSupplyCreating:
+			err = o.waitSupply(ctx, state)
+		case SupplyFlowStepSupplyCreated:
+			err = o.getSupply(ctx, state)
+		default:
+			err = fmt.Errorf("unknown supply flow step: %s", state.Step)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := o.save(state); err != nil {
+			return err
+		}
+		if o.progress != nil {
+			o.progress(state)
+		}
+	}
+
+	return nil
+}
+
+func (o *SupplyOrchestrator) save(state *SupplyFlowState) error {
+	state.UpdatedAt = o.now()
+	if o.store != nil {
+		return o.store.Save(state)
+	}
+	return nil
+}
+
+func (o *SupplyOrchestrator) createDraft(ctx context.Context, state *SupplyFlowState) error {
+	if state.DraftParams == nil {
+		return fmt.Errorf("supply draft parameters are required")
+	}
+
+	resp, err := o.fbo.CreateSupplyDraft(ctx, state.DraftParams)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("create supply draft: %d %s", resp.StatusCode, resp.Message)
+	}
+
+	state.DraftOperationId = resp.OperationId
+	state.Step = SupplyFlowStepDraftCreating
+	return nil
+}
+
+func (o *SupplyOrchestrator) waitDraft(ctx context.Context, state *SupplyFlowState) error {
+	var info *GetSupplyDraftInfoResponse
+	err := o.poll(ctx, func() (bool, error) {
+		var err error
+		info, err = o.fbo.GetSupplyDraftInfo(ctx, &GetSupplyDraftInfoParams{OperationId: state.DraftOperationId})
+		if err != nil {
+			return false, err
+		}
+		if info.StatusCode != http.StatusOK {
+			return false, fmt.Errorf("get supply draft info: %d %s", info.StatusCode, info.Message)
+		}
+		return info.Status != draftStatusInProgress, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if info.Status != draftStatusSuccess {
+		messages := []string{}
+		for _, e := range info.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("supply draft is not created: %s: %s", info.Status, strings.Join(messages, "; "))
+	}
+
+	state.DraftId = info.DraftId
+	state.Step = SupplyFlowStepDraftCreated
+	return nil
+}
+
+func (o *SupplyOrchestrator) selectTimeslot(ctx context.Context, state *SupplyFlowState) error {
+	// Draft info contains available warehouses,
+	// it's requested again in case the flow is resumed
+	info, err := o.fbo.GetSupplyDraftInfo(ctx, &GetSupplyDraftInfoParams{OperationId: state.DraftOperationId})
+	if err != nil {
+		return err
+	}
+	if info.StatusCode != http.StatusOK {
+		return fmt.Errorf("get supply draft info: %d %s", info.StatusCode, info.Message)
+	}
+
+	available := []SupplyDraftWarehouse{}
+	for _, cluster := range info.Clusters {
+		for _, warehouse := range cluster.Warehouses {
+			if warehouse.Status.IsAvailable {
+				available = append(available, warehouse)
+			}
+		}
+	}
+
+	warehouses, err := o.warehouseSelector.SelectWarehouses(ctx, available)
+	if err != nil {
+		return err
+	}
+	if len(warehouses) == 0 {
+		return fmt.Errorf("no warehouses available for supply draft %d", state.DraftId)
+	}
+
+	warehouseIds := make([]string, 0, len(warehouses))
+	for _, warehouse := range warehouses {
+		warehouseIds = append(warehouseIds, strconv.FormatInt(warehouse.Id, 10))
+	}
+
+	now := o.now()
+	resp, err := o.fbo.GetDraftTimeslots(ctx, &GetDraftTimeslotsParams{
+		DateFrom:     now,
+		DateTo:       now.AddDate(0, 0, o.timeslotDays),
+		DraftId:      state.DraftId,
+		WarehouseIds: warehouseIds,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get draft timeslots: %d %s", resp.StatusCode, resp.Message)
+	}
+
+	// Keep the order of selected warehouses
+	order := map[int64]int{}
+	for i, warehouse := range warehouses {
+		order[warehouse.Id] = i
+	}
+	timeslots := []DraftTimeslot{}
+	for _, timeslot := range resp.DropoffWarehouseTimeslots {
+		if _, ok := order[timeslot.DropoffWarehouseId]; ok {
+			timeslots = append(timeslots, timeslot)
+		}
+	}
+	sort.SliceStable(timeslots, func(i, j int) bool {
+		return order[timeslots[i].DropoffWarehouseId] < order[timeslots[j].DropoffWarehouseId]
+	})
+
+	warehouseId, timeslot := o.timeslotSelector.SelectTimeslot(timeslots)
+	if timeslot == nil {
+		return fmt.Errorf("no time slots available for supply draft %d", state.DraftId)
+	}
+
+	state.WarehouseId = warehouseId
+	state.Timeslot = &CreateSupplyFromDraftTimeslot{
+		FromInTimezone: timeslot.FromInTimezone,
+		ToInTimezone:   timeslot.ToInTimezone,
+	}
+	state.Step = SupplyFlowStepTimeslotSelected
+	return nil
+}
+
+// The step is saved before the request and the operation identifier right
+// after it, so a resumed flow never creates a duplicate supply request
+func (o *SupplyOrchestrator) createSupply(ctx context.Context, state *SupplyFlowState) error {
+	if state.Timeslot == nil {
+		return fmt.Errorf("supply time slot is not selected")
+	}
+
+	state.Step = SupplyFlowStepSupplyCreating
+	state.SupplyOperationId = ""
+	if err := o.save(state); err != nil {
+		return err
+	}
+
+	resp, err := o.fbo.CreateSupplyFromDraft(ctx, &CreateSupplyFromDraftParams{
+		DraftId:     state.DraftId,
+		Timeslot:    *state.Timeslot,
+		WarehouseId: state.WarehouseId,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("create supply from draft: %d %s", resp.StatusCode, resp.Message)
+	}
+
+	state.SupplyOperationId = resp.OperationId
+	return o.save(state)
+}
+
+func (o *SupplyOrchestrator) waitSupply(ctx context.Context, state *SupplyFlowState) error {
+	if state.SupplyOperationId == "" {
+		return ErrSupplyCreationInterrupted
+	}
+
+	var status *GetSupplyFromDraftStatusResponse
+	err := o.poll(ctx, func() (bool, error) {
+		var err error
+		status, err = o.fbo.GetSupplyFromDraftStatus(ctx, &GetSupplyFromDraftStatusParams{OperationId: state.SupplyOperationId})
+		if err != nil {
+			return false, err
+		}
+		if status.StatusCode != http.StatusOK {
+			return false, fmt.Errorf("get supply from draft status: %d %s", status.StatusCode, status.Message)
+		}
+		return status.Status != supplyStatusInProgress, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if status.Status != supplyStatusSuccess {
+		return fmt.Errorf("supply request is not created: %s: %s", status.Status, strings.Join(status.ErrorMessages, "; "))
+	}
+
+	state.OrderIds = status.Result.OrderIds
+	state.Step = SupplyFlowStepSupplyCreated
+	return nil
+}
+
+func (o *SupplyOrchestrator) getSupply(ctx context.Context, state *SupplyFlowState) error {
+	orderIds := make([]string, 0, len(state.OrderIds))
+	for _, id := range state.OrderIds {
+		orderIds = append(orderIds, strconv.FormatInt(id, 10))
+	}
+
+	var info *GetSupplyRequestInfoResponse
+	err := o.poll(ctx, func() (bool, error) {
+		var err error
+		info, err = o.fbo.GetSupplyRequestInfo(ctx, &GetSupplyRequestInfoParams{OrderIds: orderIds})
+		if err != nil {
+			return false, err
+		}
+		if info.StatusCode != http.StatusOK {
+			return false, fmt.Errorf("get supply request info: %d %s", info.StatusCode, info.Message)
+		}
+		return len(info.Orders) >= len(orderIds), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	state.Orders = info.Orders
+	state.Step = SupplyFlowStepDone
+	return nil
+}
+
+// Calls fn until it's done, waiting poll interval between calls
+func (o *SupplyOrchestrator) poll(ctx context.Context, fn func() (bool, error)) error {
+	for {
+		done, err := fn()
+		if err != nil || done {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(o.pollInterval):
+		}
+	}
+}
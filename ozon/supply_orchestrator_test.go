@@ -0,0 +1,377 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSupplyFlowHandler(t *testing.T) (http.HandlerFunc, func() []string) {
+	var mu sync.Mutex
+	paths := []string{}
+	draftInfoCalls := 0
+
+	routes := map[string]string{
+		"/v1/draft/create": `{"operation_id": "draft-operation"}`,
+		"/v1/draft/timeslot/info": `{
+			"drop_off_warehouse_timeslots": [
+				{
+					"days": [
+						{
+							"timeslots": [
+								{"from_in_timezone": "2023-01-05T10:00:00Z", "to_in_timezone": "2023-01-05T11:00:00Z"}
+							]
+						}
+					],
+					"drop_off_warehouse_id": 10
+				},
+				{
+					"days": [
+						{
+							"timeslots": [
+								{"from_in_timezone": "2023-01-03T10:00:00Z", "to_in_timezone": "2023-01-03T11:00:00Z"},
+								{"from_in_timezone": "2023-01-02T10:00:00Z", "to_in_timezone": "2023-01-02T11:00:00Z"}
+							]
+						}
+					],
+					"drop_off_warehouse_id": 20
+				}
+			]
+		}`,
+		"/v1/draft/supply/create":        `{"operation_id": "supply-operation"}`,
+		"/v1/draft/supply/create/status": `{"result": {"order_ids": [100]}, "status": "DraftSupplyCreateStatusSuccess"}`,
+		"/v2/supply-order/get":           `{"orders": [{"supply_order_id": 100, "state": "DATA_FILLING"}]}`,
+		"/v1/supplier/available_warehouses": `{
+			"result": [
+				{"schedule": {"capacity": [{"value": 10}]}, "warehouse": {"id": "10"}},
+				{"schedule": {"capacity": [{"value": 50}]}, "warehouse": {"id": "20"}}
+			]
+		}`,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+			path := "/" + strings.TrimPrefix(r.URL.Path, "/")
+
+			mu.Lock()
+			paths = append(paths, path)
+			mu.Unlock()
+
+			if path == "/v1/draft/create/info" {
+				mu.Lock()
+				draftInfoCalls++
+				status := "CALCULATION_STATUS_SUCCESS"
+				if draftInfoCalls == 1 {
+					status = "CALCULATION_STATUS_IN_PROGRESS"
+				}
+				mu.Unlock()
+
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{
+				"clusters": [
+					{
+						"cluster_id": 1,
+						"warehouses": [
+							{"status": {"is_available": true}, "total_rank": 2, "warehouse_id": 20},
+							{"status": {"is_available": true}, "total_rank": 1, "warehouse_id": 10},
+							{"status": {"is_available": false}, "total_rank": 0, "warehouse_id": 30}
+						]
+					}
+				],
+				"draft_id": 5,
+				"status": "` + status + `"
+			}`))
+				return
+			}
+
+			response, ok := routes[path]
+			if !ok {
+				t.Errorf("unexpected request: %s", path)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(response))
+		}, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string{}, paths...)
+		}
+}
+
+func TestSupplyOrchestrator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		opts        func(c *Client) []SupplyOrchestratorOption
+		warehouseId int64
+		from        string
+	}{
+		// Warehouse with the best rank and its earliest time slot
+		{
+			func(c *Client) []SupplyOrchestratorOption { return nil },
+			10,
+			"2023-01-05T10:00:00Z",
+		},
+		// The earliest time slot among all warehouses
+		{
+			func(c *Client) []SupplyOrchestratorOption {
+				return []SupplyOrchestratorOption{WithTimeslotSelector(EarliestTimeslot{})}
+			},
+			20,
+			"2023-01-02T10:00:00Z",
+		},
+		// The least loaded warehouse
+		{
+			func(c *Client) []SupplyOrchestratorOption {
+				return []SupplyOrchestratorOption{WithWarehouseSelector(LeastLoadedWarehouses{FBO: c.FBO()})}
+			},
+			20,
+			"2023-01-02T10:00:00Z",
+		},
+		// Preferred warehouse
+		{
+			func(c *Client) []SupplyOrchestratorOption {
+				return []SupplyOrchestratorOption{WithWarehouseSelector(PreferredWarehouses{WarehouseIds: []int64{30, 20}})}
+			},
+			20,
+			"2023-01-02T10:00:00Z",
+		},
+	}
+
+	for _, test := range tests {
+		handler, paths := newSupplyFlowHandler(t)
+		c := NewMockClient(handler)
+
+		steps := []SupplyFlowStep{}
+		opts := append([]SupplyOrchestratorOption{
+			WithPollInterval(time.Millisecond),
+			WithSupplyProgress(func(state *SupplyFlowState) {
+				steps = append(steps, state.Step)
+			}),
+		}, test.opts(c)...)
+		orchestrator := NewSupplyOrchestrator(c.FBO(), opts...)
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+
+		state, err := orchestrator.Run(ctx, &CreateSupplyDraftParams{
+			ClusterIds: []string{"1"},
+			Items:      []CreateSupplyDraftItem{{Quantity: 10, SKU: 123}},
+			Type:       "CREATE_TYPE_DIRECT",
+		})
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if state.Step != SupplyFlowStepDone {
+			t.Errorf("expected step %s, got: %s", SupplyFlowStepDone, state.Step)
+		}
+		if len(steps) != 6 {
+			t.Errorf("expected 6 progress reports, got: %v", steps)
+		}
+		if state.DraftId != 5 || state.WarehouseId != test.warehouseId {
+			t.Errorf("wrong draft or warehouse: %+v", state)
+		}
+		if state.Timeslot == nil || state.Timeslot.FromInTimezone.Format(time.RFC3339) != test.from {
+			t.Errorf("wrong time slot: got: %v, expected: %s", state.Timeslot, test.from)
+		}
+		if len(state.Orders) != 1 || state.Orders[0].Id != 100 {
+			t.Errorf("wrong orders: %+v", state.Orders)
+		}
+
+		draftInfoRequests := 0
+		for _, path := range paths() {
+			if path == "/v1/draft/create/info" {
+				draftInfoRequests++
+			}
+		}
+		if draftInfoRequests != 3 {
+			t.Errorf("expected draft info to be polled twice and requested for warehouses, got: %d", draftInfoRequests)
+		}
+	}
+}
+
+func TestSupplyOrchestratorResume(t *testing.T) {
+	t.Parallel()
+
+	handler, paths := newSupplyFlowHandler(t)
+	c := NewMockClient(handler)
+
+	store := FileSupplyFlowStore{Path: filepath.Join(t.TempDir(), "state.json")}
+	timeslot := &CreateSupplyFromDraftTimeslot{
+		FromInTimezone: time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC),
+		ToInTimezone:   time.Date(2023, 1, 2, 11, 0, 0, 0, time.UTC),
+	}
+	if err := store.Save(&SupplyFlowState{
+		Step:             SupplyFlowStepTimeslotSelected,
+		DraftOperationId: "draft-operation",
+		DraftId:          5,
+		WarehouseId:      20,
+		Timeslot:         timeslot,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orchestrator := NewSupplyOrchestrator(c.FBO(), WithSupplyFlowStore(store), WithPollInterval(time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	if err := orchestrator.Resume(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/v1/draft/supply/create", "/v1/draft/supply/create/status", "/v2/supply-order/get"}
+	if got := paths(); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("wrong requests: got: %v, expected: %v", got, expected)
+	}
+
+	saved, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Step != SupplyFlowStepDone || len(saved.OrderIds) != 1 {
+		t.Errorf("final state must be saved, got: %+v", saved)
+	}
+
+	content, _ := json.Marshal(saved.Timeslot)
+	if expected, _ := json.Marshal(timeslot); string(content) != string(expected) {
+		t.Errorf("time slot must be kept, got: %s", content)
+	}
+}
+
+// Fails to save the state, as if the process was stopped
+type crashingSupplyFlowStore struct {
+	FileSupplyFlowStore
+
+	crash func(state *SupplyFlowState) bool
+}
+
+func (s crashingSupplyFlowStore) Save(state *SupplyFlowState) error {
+	if s.crash(state) {
+		return errors.New("process stopped")
+	}
+	return s.FileSupplyFlowStore.Save(state)
+}
+
+func TestSupplyOrchestratorResumeAfterCrash(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		crash       func(state *SupplyFlowState) bool
+		operationId string
+		err         error
+	}{
+		// Stopped while waiting for the supply request, the operation is checked again
+		{
+			func(state *SupplyFlowState) bool { return len(state.OrderIds) != 0 },
+			"supply-operation",
+			nil,
+		},
+		// Stopped before the response was saved, the request isn't created again
+		{
+			func(state *SupplyFlowState) bool { return state.SupplyOperationId != "" },
+			"",
+			ErrSupplyCreationInterrupted,
+		},
+	}
+
+	for _, test := range tests {
+		var mu sync.Mutex
+		creates := 0
+		c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			w.WriteHeader(http.StatusOK)
+			switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+			case "/v1/draft/supply/create":
+				creates++
+				w.Write([]byte(`{"operation_id": "supply-operation"}`))
+			case "/v1/draft/supply/create/status":
+				w.Write([]byte(`{"result": {"order_ids": [100]}, "status": "DraftSupplyCreateStatusSuccess"}`))
+			case "/v2/supply-order/get":
+				w.Write([]byte(`{"orders": [{"supply_order_id": 100, "dropoff_warehouse_id": 20}]}`))
+			default:
+				t.Errorf("unexpected request: %s", r.URL.Path)
+			}
+		})
+
+		store := FileSupplyFlowStore{Path: filepath.Join(t.TempDir(), "state.json")}
+		state := &SupplyFlowState{
+			Step:        SupplyFlowStepTimeslotSelected,
+			DraftId:     5,
+			WarehouseId: 20,
+			Timeslot: &CreateSupplyFromDraftTimeslot{
+				FromInTimezone: time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC),
+				ToInTimezone:   time.Date(2023, 1, 2, 11, 0, 0, 0, time.UTC),
+			},
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+
+		crashing := NewSupplyOrchestrator(c.FBO(), WithSupplyFlowStore(crashingSupplyFlowStore{store, test.crash}), WithPollInterval(time.Millisecond))
+		if err := crashing.Resume(ctx, state); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		saved, err := store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Step != SupplyFlowStepSupplyCreating || saved.SupplyOperationId != test.operationId {
+			t.Fatalf("wrong saved state: %+v", saved)
+		}
+
+		orchestrator := NewSupplyOrchestrator(c.FBO(), WithSupplyFlowStore(store), WithPollInterval(time.Millisecond))
+		err = orchestrator.Resume(ctx, saved)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("expected error %v, got: %v", test.err, err)
+		}
+
+		mu.Lock()
+		if creates != 1 {
+			t.Errorf("supply request must be created once, got: %d", creates)
+		}
+		mu.Unlock()
+		if test.err == nil && (saved.Step != SupplyFlowStepDone || len(saved.OrderIds) != 1 || saved.OrderIds[0] != 100) {
+			t.Errorf("wrong final state: %+v", saved)
+		}
+	}
+}
+
+func TestSupplyOrchestratorDraftFailed(t *testing.T) {
+	t.Parallel()
+
+	c := NewMockClient(newMockRouter(map[string]string{
+		"/v1/draft/create": `{"operation_id": "draft-operation"}`,
+		"/v1/draft/create/info": `{
+			"errors": [{"error_message": "invalid items"}],
+			"status": "CALCULATION_STATUS_FAILED"
+		}`,
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	state, err := NewSupplyOrchestrator(c.FBO()).Run(ctx, &CreateSupplyDraftParams{})
+	if err == nil || !strings.Contains(err.Error(), "invalid items") {
+		t.Errorf("expected error with draft error message, got: %v", err)
+	}
+	if state.Step != SupplyFlowStepDraftCreating || state.DraftOperationId != "draft-operation" {
+		t.Errorf("state must be left at the failed step, got: %+v", state)
+	}
+}
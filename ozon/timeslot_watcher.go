@@ -0,0 +1,354 @@
+package ozon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Time slot update operation is still running
+const timeslotStatusInProgress = "IN_PROGRESS"
+
+// Time slots that can be booked by the watcher.
+// Days and hours are checked in the warehouse time zone
+type TimeslotConstraints struct {
+	// Allowed days of week. Any day is allowed if empty
+	Weekdays []time.Weekday
+
+	// Time slot must start not earlier than this hour
+	FromHour int
+
+	// Time slot must end not later than this hour. Any hour is allowed if 0
+	ToHour int
+
+	// Watch only supply requests to these warehouses. Any warehouse is allowed if empty
+	WarehouseIds []int64
+
+	// Time slot must start after this date and time
+	NotBefore time.Time
+
+	// Minimal difference between the current time slot and a new one
+	MinImprovement time.Duration
+}
+
+func (c TimeslotConstraints) allowsWarehouse(warehouseId int64) bool {
+	if len(c.WarehouseIds) == 0 {
+		return true
+	}
+	for _, id := range c.WarehouseIds {
+		if id == warehouseId {
+			return true
+		}
+	}
+	return false
+}
+
+func (c TimeslotConstraints) allows(timeslot SupplyTimeslotValueTimeslot, location *time.Location) bool {
+	if !c.NotBefore.IsZero() && timeslot.From.Before(c.NotBefore) {
+		return false
+	}
+
+	timeslot.From = timeslot.From.In(location)
+	timeslot.To = timeslot.To.In(location)
+
+	if len(c.Weekdays) > 0 {
+		allowed := false
+		for _, day := range c.Weekdays {
+			if timeslot.From.Weekday() == day {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if timeslot.From.Hour() < c.FromHour {
+		return false
+	}
+	if c.ToHour > 0 {
+		from := timeslot.From
+		dayStart := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+		if timeslot.To.After(dayStart.Add(time.Duration(c.ToHour) * time.Hour)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Information about moving a supply request to an earlier time slot
+type TimeslotRebooking struct {
+	// Supply request identifier
+	SupplyOrderId int64
+
+	// Time slot before rebooking
+	OldTimeslot SupplyTimeslotValueTimeslot
+
+	// New time slot
+	NewTimeslot SupplyTimeslotValueTimeslot
+
+	// true, if the time slot wasn't updated because of dry-run mode
+	DryRun bool
+
+	// Time slot update operation identifier
+	OperationId string
+
+	// Time slot update status
+	Status string
+
+	// Time slot update errors
+	Errors []string
+}
+
+type TimeslotWatcherOption func(w *TimeslotWatcher)
+
+// Constraints for new time slots
+func WithTimeslotConstraints(constraints TimeslotConstraints) TimeslotWatcherOption {
+	return func(w *TimeslotWatcher) {
+		w.constraints = constraints
+	}
+}
+
+// Interval between time slots checks.
+//
+// Default is 1 minute
+func WithWatchInterval(interval time.Duration) TimeslotWatcherOption {
+	return func(w *TimeslotWatcher) {
+		w.interval = interval
+	}
+}
+
+// Interval between time slot update status requests.
+//
+// Default is 2 seconds
+func WithTimeslotStatusInterval(interval time.Duration) TimeslotWatcherOption {
+	return func(w *TimeslotWatcher) {
+		w.statusInterval = interval
+	}
+}
+
+// Find earlier time slots without updating supply requests
+func WithTimeslotDryRun(dryRun bool) TimeslotWatcherOption {
+	return func(w *TimeslotWatcher) {
+		w.dryRun = dryRun
+	}
+}
+
+// Callback invoked for each rebooking
+func WithRebookingCallback(callback func(rebooking TimeslotRebooking)) TimeslotWatcherOption {
+	return func(w *TimeslotWatcher) {
+		w.onRebooking = callback
+	}
+}
+
+// Callback invoked when a check fails.
+//
+// By default errors are logged
+func WithWatchErrorHandler(handler func(err error)) TimeslotWatcherOption {
+	return func(w *TimeslotWatcher) {
+		w.onError = handler
+	}
+}
+
+// Watches time slots of supply requests and moves
+// them to earlier time slots as soon as they appear
+type TimeslotWatcher struct {
+	fbo      *FBO
+	orderIds []int64
+
+	constraints    TimeslotConstraints
+	interval       time.Duration
+	statusInterval time.Duration
+	dryRun         bool
+	onRebooking    func(rebooking TimeslotRebooking)
+	onError        func(err error)
+}
+
+func NewTimeslotWatcher(fbo *FBO, orderIds []int64, opts ...TimeslotWatcherOption) *TimeslotWatcher {
+	w := &TimeslotWatcher{
+		fbo:            fbo,
+		orderIds:       orderIds,
+		interval:       time.Minute,
+		statusInterval: 2 * time.Second,
+		onError: func(err error) {
+			log.Print(err)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Checks time slots periodically until the context is canceled
+func (w *TimeslotWatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Check(ctx); err != nil && ctx.Err() == nil {
+			w.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Checks time slots of all supply requests once and
+// rebooks supply requests for which an earlier time slot is found.
+// A failed supply request doesn't stop the check of the others,
+// errors of all supply requests are joined
+func (w *TimeslotWatcher) Check(ctx context.Context) ([]TimeslotRebooking, error) {
+	orderIds := make([]string, 0, len(w.orderIds))
+	for _, id := range w.orderIds {
+		orderIds = append(orderIds, strconv.FormatInt(id, 10))
+	}
+
+	info, err := w.fbo.GetSupplyRequestInfo(ctx, &GetSupplyRequestInfoParams{OrderIds: orderIds})
+	if err != nil {
+		return nil, err
+	}
+	if info.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get supply request info: %d %s", info.StatusCode, info.Message)
+	}
+
+	rebookings := []TimeslotRebooking{}
+	var errs []error
+	for _, order := range info.Orders {
+		current, ok := currentTimeslot(order)
+		if !ok || !w.constraints.allowsWarehouse(order.DropoffWarehouseId) {
+			continue
+		}
+
+		rebooking, err := w.checkOrder(ctx, order.Id, current)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("check supply request %d: %w", order.Id, err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if rebooking == nil {
+			continue
+		}
+
+		rebookings = append(rebookings, *rebooking)
+		if w.onRebooking != nil {
+			w.onRebooking(*rebooking)
+		}
+	}
+
+	return rebookings, errors.Join(errs...)
+}
+
+func (w *TimeslotWatcher) checkOrder(ctx context.Context, orderId int64, current SupplyTimeslotValueTimeslot) (*TimeslotRebooking, error) {
+	timeslots, err := w.fbo.GetSupplyTimeslots(ctx, &GetSupplyTimeslotsParams{SupplyOrderId: orderId})
+	if err != nil {
+		return nil, err
+	}
+	if timeslots.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get supply timeslots of %d: %d %s", orderId, timeslots.StatusCode, timeslots.Message)
+	}
+
+	location := timeslotsLocation(timeslots.Timezones)
+	var earliest *SupplyTimeslotValueTimeslot
+	for i := range timeslots.Timeslots {
+		timeslot := &timeslots.Timeslots[i]
+		if !timeslot.From.Before(current.From.Add(-w.constraints.MinImprovement)) || !w.constraints.allows(*timeslot, location) {
+			continue
+		}
+		if earliest == nil || timeslot.From.Before(earliest.From) {
+			earliest = timeslot
+		}
+	}
+	if earliest == nil {
+		return nil, nil
+	}
+
+	rebooking := &TimeslotRebooking{
+		SupplyOrderId: orderId,
+		OldTimeslot:   current,
+		NewTimeslot:   *earliest,
+		DryRun:        w.dryRun,
+	}
+	if w.dryRun {
+		return rebooking, nil
+	}
+
+	update, err := w.fbo.UpdateSupplyTimeslot(ctx, &UpdateSupplyTimeslotParams{
+		SupplyOrderId: orderId,
+		Timeslot:      *earliest,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if update.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("update supply timeslot of %d: %d %s", orderId, update.StatusCode, update.Message)
+	}
+	rebooking.OperationId = update.OperationId
+	rebooking.Errors = update.Errors
+	if len(update.Errors) > 0 || update.OperationId == "" {
+		return rebooking, nil
+	}
+
+	for {
+		status, err := w.fbo.GetSupplyTimeslotStatus(ctx, &GetSupplyTimeslotStatusParams{OperationId: update.OperationId})
+		if err != nil {
+			return nil, err
+		}
+		if status.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("get supply timeslot status of %d: %d %s", orderId, status.StatusCode, status.Message)
+		}
+
+		rebooking.Status = status.Status
+		rebooking.Errors = status.Errors
+		if status.Status != timeslotStatusInProgress {
+			return rebooking, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(w.statusInterval):
+		}
+	}
+}
+
+func currentTimeslot(order SupplyOrder) (SupplyTimeslotValueTimeslot, bool) {
+	for _, timeslot := range order.Timeslot {
+		if !timeslot.CanSet {
+			continue
+		}
+		if len(timeslot.Value.Timeslot) > 0 {
+			return timeslot.Value.Timeslot[0], true
+		}
+	}
+	return SupplyTimeslotValueTimeslot{}, false
+}
+
+// Warehouse time zone. The offset is used if the zone name is unknown, UTC if there is no time zone
+func timeslotsLocation(timezones []SupplyTimeslotValueTimezone) *time.Location {
+	for _, timezone := range timezones {
+		if timezone.Name != "" {
+			if location, err := time.LoadLocation(timezone.Name); err == nil {
+				return location
+			}
+		}
+		if offset, err := strconv.Atoi(timezone.Offset); err == nil {
+			return time.FixedZone(timezone.Name, offset)
+		}
+	}
+	return time.UTC
+}
@@ -0,0 +1,323 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const timeslotWatcherSupplyOrder = `{
+	"orders": [
+		{
+			"dropoff_warehouse_id": 10,
+			"supply_order_id": 1,
+			"timeslot": [
+				{
+					"can_set": true,
+					"value": {
+						"timeslot": [
+							{"from": "2023-01-20T10:00:00Z", "to": "2023-01-20T11:00:00Z"}
+						]
+					}
+				}
+			]
+		}
+	]
+}`
+
+const timeslotWatcherTimeslots = `{
+	"timeslots": [
+		{"from": "2023-01-21T10:00:00Z", "to": "2023-01-21T11:00:00Z"},
+		{"from": "2023-01-15T20:00:00Z", "to": "2023-01-15T21:00:00Z"},
+		{"from": "2023-01-16T09:00:00Z", "to": "2023-01-16T10:00:00Z"},
+		{"from": "2023-01-18T09:00:00Z", "to": "2023-01-18T10:00:00Z"}
+	]
+}`
+
+func TestTimeslotWatcher(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	statusCalls := 0
+	updated := ""
+
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var response string
+		switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+		case "/v2/supply-order/get":
+			response = timeslotWatcherSupplyOrder
+		case "/v1/supply-order/timeslot/get":
+			response = timeslotWatcherTimeslots
+		case "/v1/supply-order/timeslot/update":
+			params := &UpdateSupplyTimeslotParams{}
+			json.NewDecoder(r.Body).Decode(params)
+			updated = params.Timeslot.From.Format(time.RFC3339)
+			response = `{"operation_id": "operation"}`
+		case "/v1/supply-order/timeslot/status":
+			statusCalls++
+			response = `{"status": "SUCCESS"}`
+			if statusCalls == 1 {
+				response = `{"status": "IN_PROGRESS"}`
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(response))
+	})
+
+	tests := []struct {
+		constraints TimeslotConstraints
+		dryRun      bool
+		expected    string
+	}{
+		// The earliest time slot
+		{
+			TimeslotConstraints{},
+			true,
+			"2023-01-15T20:00:00Z",
+		},
+		// Working hours only
+		{
+			TimeslotConstraints{FromHour: 8, ToHour: 18},
+			true,
+			"2023-01-16T09:00:00Z",
+		},
+		// Wednesday only
+		{
+			TimeslotConstraints{Weekdays: []time.Weekday{time.Wednesday}},
+			true,
+			"2023-01-18T09:00:00Z",
+		},
+		// Not earlier than date
+		{
+			TimeslotConstraints{NotBefore: time.Date(2023, 1, 17, 0, 0, 0, 0, time.UTC)},
+			false,
+			"2023-01-18T09:00:00Z",
+		},
+		// Improvement is too small
+		{
+			TimeslotConstraints{NotBefore: time.Date(2023, 1, 17, 0, 0, 0, 0, time.UTC), MinImprovement: 72 * time.Hour},
+			true,
+			"",
+		},
+		// Other warehouse
+		{
+			TimeslotConstraints{WarehouseIds: []int64{20}},
+			true,
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		callbacks := []TimeslotRebooking{}
+		watcher := NewTimeslotWatcher(c.FBO(), []int64{1},
+			WithTimeslotConstraints(test.constraints),
+			WithTimeslotDryRun(test.dryRun),
+			WithTimeslotStatusInterval(time.Millisecond),
+			WithRebookingCallback(func(rebooking TimeslotRebooking) {
+				callbacks = append(callbacks, rebooking)
+			}),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+
+		rebookings, err := watcher.Check(ctx)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if test.expected == "" {
+			if len(rebookings) != 0 {
+				t.Errorf("expected no rebookings, got: %+v", rebookings)
+			}
+			continue
+		}
+
+		if len(rebookings) != 1 || len(callbacks) != 1 {
+			t.Errorf("expected 1 rebooking and callback, got: %d and %d", len(rebookings), len(callbacks))
+			continue
+		}
+		rebooking := rebookings[0]
+		if got := rebooking.NewTimeslot.From.Format(time.RFC3339); got != test.expected {
+			t.Errorf("wrong time slot: got: %s, expected: %s", got, test.expected)
+		}
+		if rebooking.OldTimeslot.From.Format(time.RFC3339) != "2023-01-20T10:00:00Z" {
+			t.Errorf("wrong old time slot: %v", rebooking.OldTimeslot)
+		}
+		if rebooking.DryRun != test.dryRun {
+			t.Errorf("wrong dry run flag: %v", rebooking.DryRun)
+		}
+
+		mu.Lock()
+		if test.dryRun && updated != "" {
+			t.Errorf("time slot must not be updated in dry-run mode")
+		}
+		if !test.dryRun {
+			if updated != test.expected {
+				t.Errorf("wrong updated time slot: got: %s, expected: %s", updated, test.expected)
+			}
+			if rebooking.OperationId != "operation" || rebooking.Status != "SUCCESS" || statusCalls != 2 {
+				t.Errorf("update status must be polled until finished, got: %+v after %d calls", rebooking, statusCalls)
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+func TestTimeslotWatcherRun(t *testing.T) {
+	t.Parallel()
+
+	c := NewMockClient(newMockRouter(map[string]string{
+		"/v2/supply-order/get":          timeslotWatcherSupplyOrder,
+		"/v1/supply-order/timeslot/get": timeslotWatcherTimeslots,
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rebookings := make(chan TimeslotRebooking, 10)
+	watcher := NewTimeslotWatcher(c.FBO(), []int64{1},
+		WithTimeslotDryRun(true),
+		WithWatchInterval(time.Millisecond),
+		WithRebookingCallback(func(rebooking TimeslotRebooking) {
+			rebookings <- rebooking
+			if len(rebookings) >= 2 {
+				cancel()
+			}
+		}),
+	)
+
+	done := make(chan error)
+	go func() {
+		done <- watcher.Run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("expected context canceled error, got: %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("watcher is not stopped")
+	}
+
+	if len(rebookings) < 2 {
+		t.Errorf("expected at least 2 checks, got: %d", len(rebookings))
+	}
+}
+
+func TestTimeslotWatcherTimezone(t *testing.T) {
+	t.Parallel()
+
+	c := NewMockClient(newMockRouter(map[string]string{
+		"/v2/supply-order/get": timeslotWatcherSupplyOrder,
+		"/v1/supply-order/timeslot/get": `{
+			"timeslots": [
+				{"from": "2023-01-17T22:00:00Z", "to": "2023-01-17T23:00:00Z"},
+				{"from": "2023-01-18T09:00:00Z", "to": "2023-01-18T10:00:00Z"}
+			],
+			"timezone": [{"iana_name": "Europe/Moscow", "offset": "10800"}]
+		}`,
+	}))
+
+	tests := []struct {
+		constraints TimeslotConstraints
+		expected    string
+	}{
+		// Tuesday in UTC is Wednesday in Moscow
+		{
+			TimeslotConstraints{Weekdays: []time.Weekday{time.Wednesday}},
+			"2023-01-17T22:00:00Z",
+		},
+		// 9:00 in UTC is 12:00 in Moscow
+		{
+			TimeslotConstraints{FromHour: 11, ToHour: 14},
+			"2023-01-18T09:00:00Z",
+		},
+	}
+
+	for _, test := range tests {
+		watcher := NewTimeslotWatcher(c.FBO(), []int64{1},
+			WithTimeslotConstraints(test.constraints),
+			WithTimeslotDryRun(true),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+
+		rebookings, err := watcher.Check(ctx)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if len(rebookings) != 1 {
+			t.Errorf("expected 1 rebooking, got: %+v", rebookings)
+			continue
+		}
+		if got := rebookings[0].NewTimeslot.From.UTC().Format(time.RFC3339); got != test.expected {
+			t.Errorf("wrong time slot: got: %s, expected: %s", got, test.expected)
+		}
+	}
+}
+
+func TestTimeslotWatcherOrderErrors(t *testing.T) {
+	t.Parallel()
+
+	c := NewMockClient(func(w http.ResponseWriter, r *http.Request) {
+		var response string
+		switch "/" + strings.TrimPrefix(r.URL.Path, "/") {
+		case "/v2/supply-order/get":
+			response = `{
+				"orders": [
+					{
+						"supply_order_id": 1,
+						"timeslot": [{"can_set": true, "value": {"timeslot": [{"from": "2023-01-20T10:00:00Z", "to": "2023-01-20T11:00:00Z"}]}}]
+					},
+					{
+						"supply_order_id": 2,
+						"timeslot": [{"can_set": true, "value": {"timeslot": [{"from": "2023-01-20T10:00:00Z", "to": "2023-01-20T11:00:00Z"}]}}]
+					}
+				]
+			}`
+		case "/v1/supply-order/timeslot/get":
+			params := &GetSupplyTimeslotsParams{}
+			json.NewDecoder(r.Body).Decode(params)
+			if params.SupplyOrderId == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"code": 13, "message": "internal error"}`))
+				return
+			}
+			response = timeslotWatcherTimeslots
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(response))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	watcher := NewTimeslotWatcher(c.FBO(), []int64{1, 2}, WithTimeslotDryRun(true))
+	rebookings, err := watcher.Check(ctx)
+	if err == nil || !strings.Contains(err.Error(), "supply request 1") {
+		t.Errorf("error of the first supply request must be returned, got: %v", err)
+	}
+	if len(rebookings) != 1 || rebookings[0].SupplyOrderId != 2 {
+		t.Errorf("other supply requests must be checked, got: %+v", rebookings)
+	}
+}